@@ -0,0 +1,152 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/controllers"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
+)
+
+// api serves the admin handlers used by sebctl in-process, so commands get exactly the
+// validation, term scoping and database side effects of the HTTP API. Websocket pushes
+// are skipped: the hubs of a running server live in its own process, so its dashboards
+// only see sebctl changes on their next reload or status update.
+type api struct {
+    db     *gorm.DB
+    engine *gin.Engine
+}
+
+func newAPI(db *gorm.DB, cfg *config.Config, actorEmail string) (*api, error) {
+    var actor models.User
+    q := db.Where("role = ? AND active = ?", "admin", true)
+    if actorEmail != "" {
+        q = q.Where("email = ?", actorEmail)
+    }
+    if err := q.Order("created_at").First(&actor).Error; err != nil {
+        if actorEmail != "" || !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, fmt.Errorf("acting admin %s (must be an active admin): %w", actorEmail, err)
+        }
+    }
+
+    // nil hubs: broadcasts are no-ops (see api)
+    var hubs *ws.Hubs
+
+    gin.SetMode(gin.ReleaseMode)
+    r := gin.New()
+    r.Use(func(c *gin.Context) {
+        // Without any admin (fresh install) only `admin create` works
+        if actor.ID == "" && c.FullPath() != "/admin/users" {
+            c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "no active admin; run `sebctl admin create` first"})
+            return
+        }
+        c.Set("user", actor)
+    })
+    authCtrl := &controllers.AuthController{DB: db, Cfg: cfg, Hubs: hubs}
+    adminCtrl := &controllers.AdminController{DB: db}
+    assignCtrl := &controllers.AssignmentController{DB: db, Cfg: cfg, Hubs: hubs}
+    exitCtrl := &controllers.ExitCodeController{DB: db, Hubs: hubs}
+    monCtrl := &controllers.MonitoringController{DB: db, Hubs: hubs}
+
+    r.POST("/admin/users", authCtrl.Register)
+    r.PUT("/admin/users/:user_id", adminCtrl.UpdateUser)
+    r.POST("/admin/users/import", adminCtrl.ImportUsers)
+    r.POST("/admin/rooms/:id/students", assignCtrl.AssignStudent)
+    r.POST("/admin/rooms/:id/supervisors", assignCtrl.AssignSupervisor)
+    r.POST("/exit-codes/generate", exitCtrl.Generate)
+    r.POST("/exit-codes/:id/revoke", exitCtrl.Revoke)
+    r.GET("/monitoring/students", monCtrl.ListStudents)
+    return &api{db: db, engine: r}, nil
+}
+
+func (a *api) do(req *http.Request) (int, []byte) {
+    rec := httptest.NewRecorder()
+    a.engine.ServeHTTP(rec, req)
+    return rec.Code, rec.Body.Bytes()
+}
+
+// call sends a JSON body and decodes the response into out; error responses become errors.
+func (a *api) call(method, path string, body interface{}, out interface{}) error {
+    var r io.Reader
+    if body != nil {
+        b, err := json.Marshal(body)
+        if err != nil {
+            return err
+        }
+        r = bytes.NewReader(b)
+    }
+    req := httptest.NewRequest(method, path, r)
+    req.Header.Set("Content-Type", "application/json")
+    return decode(a.do(req))(out)
+}
+
+// print is call with the response written to stdout as indented JSON.
+func (a *api) print(method, path string, body interface{}) error {
+    var out interface{}
+    if err := a.call(method, path, body, &out); err != nil {
+        return err
+    }
+    return printJSON(out)
+}
+
+// printUpload posts file as the multipart field "file" and prints the response.
+func (a *api) printUpload(path, file string) error {
+    f, err := os.Open(file)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    var buf bytes.Buffer
+    mw := multipart.NewWriter(&buf)
+    part, err := mw.CreateFormFile("file", filepath.Base(file))
+    if err != nil {
+        return err
+    }
+    if _, err := io.Copy(part, f); err != nil {
+        return err
+    }
+    if err := mw.Close(); err != nil {
+        return err
+    }
+    req := httptest.NewRequest("POST", path, &buf)
+    req.Header.Set("Content-Type", mw.FormDataContentType())
+    var out interface{}
+    if err := decode(a.do(req))(&out); err != nil {
+        return err
+    }
+    return printJSON(out)
+}
+
+func decode(status int, body []byte) func(out interface{}) error {
+    return func(out interface{}) error {
+        if status >= http.StatusBadRequest {
+            var e struct {
+                Error string `json:"error"`
+            }
+            if json.Unmarshal(body, &e) == nil && e.Error != "" {
+                return fmt.Errorf("%d: %s", status, e.Error)
+            }
+            return fmt.Errorf("%d: %s", status, body)
+        }
+        return json.Unmarshal(body, out)
+    }
+}
+
+func printJSON(v interface{}) error {
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    return enc.Encode(v)
+}
@@ -0,0 +1,299 @@
+// Command sebctl runs admin operations against the database without going through the
+// HTTP API: it serves the same controller handlers in-process, acting as an admin user.
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "text/tabwriter"
+
+    "github.com/joho/godotenv"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/database"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+const usage = `usage: sebctl [-as EMAIL] <command> [flags]
+
+commands:
+  admin create -email E [-name N]
+  admin reset-password -email E
+  users import FILE.csv
+  rooms assign -room NAME -user EMAIL|NIS
+  exit-codes generate -room NAME (-all | -students EMAIL|NIS,... | -single) [-length N]
+  exit-codes revoke CODE|ID
+  migrate up [n] | down [n] | status
+  monitoring status [-room NAME]
+
+-as picks the active admin the command acts as (default: the oldest active admin).
+Passwords are read from $SEBCTL_PASSWORD, or else from the first line of stdin.
+`
+
+func main() {
+    log.SetFlags(0)
+    _ = godotenv.Load()
+
+    global := flag.NewFlagSet("sebctl", flag.ExitOnError)
+    global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+    actorEmail := global.String("as", "", "admin email to act as")
+    _ = global.Parse(os.Args[1:])
+    args := global.Args()
+    if len(args) == 0 {
+        global.Usage()
+        os.Exit(2)
+    }
+
+    cfg := config.Load()
+    db, err := database.Connect(cfg)
+    if err != nil {
+        log.Fatalf("database connection failed: %v", err)
+    }
+
+    if args[0] == "migrate" {
+        if err := database.RunMigrateCommand(db, args[1:], os.Stdout); err != nil {
+            log.Fatalf("migrate: %v", err)
+        }
+        return
+    }
+
+    api, err := newAPI(db, cfg, *actorEmail)
+    if err != nil {
+        log.Fatal(err)
+    }
+    cmd := strings.Join(args[:min(2, len(args))], " ")
+    rest := args[min(2, len(args)):]
+    switch cmd {
+    case "admin create":
+        err = adminCreate(api, rest)
+    case "admin reset-password":
+        err = adminResetPassword(api, rest)
+    case "users import":
+        err = usersImport(api, rest)
+    case "rooms assign":
+        err = roomsAssign(api, rest)
+    case "exit-codes generate":
+        err = exitCodesGenerate(api, rest)
+    case "exit-codes revoke":
+        err = exitCodesRevoke(api, rest)
+    case "monitoring status":
+        err = monitoringStatus(api, rest)
+    default:
+        global.Usage()
+        os.Exit(2)
+    }
+    if err != nil {
+        log.Fatal(err)
+    }
+}
+
+func adminCreate(api *api, args []string) error {
+    fs := flag.NewFlagSet("admin create", flag.ExitOnError)
+    email := fs.String("email", "", "admin email")
+    name := fs.String("name", "Administrator", "full name")
+    _ = fs.Parse(args)
+    if *email == "" {
+        return fmt.Errorf("admin create: -email is required")
+    }
+    // The initial password must be changed at first login
+    password, err := readPassword()
+    if err != nil {
+        return fmt.Errorf("admin create: %w", err)
+    }
+    return api.print("POST", "/admin/users", map[string]interface{}{
+        "full_name": *name,
+        "email":     *email,
+        "password":  password,
+        "role":      "admin",
+    })
+}
+
+func adminResetPassword(api *api, args []string) error {
+    fs := flag.NewFlagSet("admin reset-password", flag.ExitOnError)
+    email := fs.String("email", "", "admin email")
+    _ = fs.Parse(args)
+    if *email == "" {
+        return fmt.Errorf("admin reset-password: -email is required")
+    }
+    // The new password must be changed at next login
+    password, err := readPassword()
+    if err != nil {
+        return fmt.Errorf("admin reset-password: %w", err)
+    }
+    var user models.User
+    if err := api.db.Where("email = ? AND role = ?", *email, "admin").First(&user).Error; err != nil {
+        return fmt.Errorf("admin %s: %w", *email, err)
+    }
+    // Also reactivates the account; the update revokes existing sessions
+    return api.print("PUT", "/admin/users/"+user.ID, map[string]interface{}{
+        "password": password,
+        "active":   true,
+    })
+}
+
+// readPassword takes the password from SEBCTL_PASSWORD or the first line of stdin, so
+// it never shows up in the shell history or the process list.
+func readPassword() (string, error) {
+    if p := os.Getenv("SEBCTL_PASSWORD"); p != "" {
+        return p, nil
+    }
+    fmt.Fprint(os.Stderr, "password: ")
+    line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+    fmt.Fprintln(os.Stderr)
+    if p := strings.TrimRight(line, "\r\n"); p != "" {
+        return p, nil
+    }
+    if err != nil && err != io.EOF {
+        return "", err
+    }
+    return "", fmt.Errorf("no password on stdin or in SEBCTL_PASSWORD")
+}
+
+func usersImport(api *api, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("users import: expected one CSV file")
+    }
+    return api.printUpload("/admin/users/import", args[0])
+}
+
+func roomsAssign(api *api, args []string) error {
+    fs := flag.NewFlagSet("rooms assign", flag.ExitOnError)
+    roomName := fs.String("room", "", "room name")
+    login := fs.String("user", "", "email or NIS of a siswa or pengawas")
+    _ = fs.Parse(args)
+    room, err := findRoom(api.db, *roomName)
+    if err != nil {
+        return err
+    }
+    user, err := findUser(api.db, *login)
+    if err != nil {
+        return err
+    }
+    switch user.Role {
+    case "siswa":
+        return api.print("POST", "/admin/rooms/"+room.ID+"/students", map[string]interface{}{"user_id": user.ID})
+    case "pengawas":
+        return api.print("POST", "/admin/rooms/"+room.ID+"/supervisors", map[string]interface{}{"user_id": user.ID})
+    default:
+        return fmt.Errorf("rooms assign: %s is %s, not siswa or pengawas", *login, user.Role)
+    }
+}
+
+func exitCodesGenerate(api *api, args []string) error {
+    fs := flag.NewFlagSet("exit-codes generate", flag.ExitOnError)
+    roomName := fs.String("room", "", "room name")
+    all := fs.Bool("all", false, "one code per student of the room")
+    students := fs.String("students", "", "comma-separated emails or NIS of students in the room")
+    single := fs.Bool("single", false, "one reusable code for the whole room")
+    length := fs.Int("length", 0, "code length (default 6)")
+    _ = fs.Parse(args)
+    room, err := findRoom(api.db, *roomName)
+    if err != nil {
+        return err
+    }
+    body := map[string]interface{}{
+        "room_id":         room.ID,
+        "all_students":    *all,
+        "single_for_room": *single,
+        "length":          *length,
+    }
+    if *students != "" {
+        ids := []string{}
+        for _, login := range strings.Split(*students, ",") {
+            user, err := findUser(api.db, login)
+            if err != nil {
+                return err
+            }
+            ids = append(ids, user.ID)
+        }
+        body["student_ids"] = ids
+    }
+    return api.print("POST", "/exit-codes/generate", body)
+}
+
+func exitCodesRevoke(api *api, args []string) error {
+    if len(args) != 1 {
+        return fmt.Errorf("exit-codes revoke: expected a code or id")
+    }
+    var rec models.ExitCode
+    if err := api.db.Where("code = ? OR id::text = ?", args[0], args[0]).First(&rec).Error; err != nil {
+        return fmt.Errorf("exit code %s: %w", args[0], err)
+    }
+    return api.print("POST", "/exit-codes/"+rec.ID+"/revoke", nil)
+}
+
+func monitoringStatus(api *api, args []string) error {
+    fs := flag.NewFlagSet("monitoring status", flag.ExitOnError)
+    roomName := fs.String("room", "", "only students of this room")
+    _ = fs.Parse(args)
+    path := "/monitoring/students?all=true&sort_by=full_name&sort_dir=ASC"
+    if *roomName != "" {
+        room, err := findRoom(api.db, *roomName)
+        if err != nil {
+            return err
+        }
+        path += "&room_id=" + room.ID
+    }
+    var resp struct {
+        Data []struct {
+            FullName   string `json:"full_name"`
+            Email      string `json:"email"`
+            Room       struct {
+                RoomName string `json:"room_name"`
+            } `json:"room"`
+            Monitoring struct {
+                AppVersion         string  `json:"app_version"`
+                Locked             bool    `json:"locked"`
+                BlockedFromExam    bool    `json:"blocked_from_exam"`
+                UnauthorizedUnlock bool    `json:"unauthorized_unlock"`
+                UpdatedAt          *string `json:"updated_at"`
+            } `json:"monitoring"`
+        } `json:"data"`
+    }
+    if err := api.call("GET", path, nil, &resp); err != nil {
+        return err
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "NAME\tEMAIL\tROOM\tLOCKED\tBLOCKED\tUNAUTHORIZED\tAPP\tUPDATED")
+    for _, s := range resp.Data {
+        updated := "-"
+        if s.Monitoring.UpdatedAt != nil {
+            updated = *s.Monitoring.UpdatedAt
+        }
+        fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%t\t%t\t%s\t%s\n",
+            s.FullName, s.Email, s.Room.RoomName, s.Monitoring.Locked, s.Monitoring.BlockedFromExam,
+            s.Monitoring.UnauthorizedUnlock, s.Monitoring.AppVersion, updated)
+    }
+    return w.Flush()
+}
+
+func findRoom(db *gorm.DB, name string) (models.Room, error) {
+    var room models.Room
+    name = strings.TrimSpace(name)
+    if name == "" {
+        return room, fmt.Errorf("-room is required")
+    }
+    if err := db.Where("LOWER(name) = LOWER(?)", name).First(&room).Error; err != nil {
+        return room, fmt.Errorf("room %q: %w", name, err)
+    }
+    return room, nil
+}
+
+// findUser looks a user up by email or username (NIS), like the login endpoint.
+func findUser(db *gorm.DB, login string) (models.User, error) {
+    var user models.User
+    login = strings.TrimSpace(login)
+    if login == "" {
+        return user, fmt.Errorf("-user is required")
+    }
+    if err := db.Where("email = ? OR (username <> '' AND LOWER(username) = LOWER(?))", login, login).First(&user).Error; err != nil {
+        return user, fmt.Errorf("user %q: %w", login, err)
+    }
+    return user, nil
+}
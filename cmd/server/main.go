@@ -1,16 +1,24 @@
 package main
 
 import (
+    "context"
+    "errors"
     "log"
+    "net/http"
     "os"
+    "os/signal"
+    "syscall"
+    "time"
 
     "github.com/joho/godotenv"
 
     "github.com/gin-gonic/gin"
 
     "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/controllers"
     "github.com/zaqqye/seb_backend_v1/internal/database"
     "github.com/zaqqye/seb_backend_v1/internal/routes"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
     "github.com/zaqqye/seb_backend_v1/internal/ws"
 )
 
@@ -25,8 +33,26 @@ func main() {
         log.Fatalf("database connection failed: %v", err)
     }
 
-    if err := database.Migrate(db); err != nil {
-        log.Fatalf("database migration failed: %v", err)
+    // `server migrate up [n] | down [n] | status` manages the schema and exits
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := database.RunMigrateCommand(db, os.Args[2:], os.Stdout); err != nil {
+            log.Fatalf("migrate: %v", err)
+        }
+        return
+    }
+
+    if cfg.MigrateOnStart != "false" {
+        if err := database.Migrate(db); err != nil {
+            log.Fatalf("database migration failed: %v", err)
+        }
+    } else if states, err := database.MigrationStatus(db); err != nil {
+        log.Fatalf("database migration status: %v", err)
+    } else {
+        for _, st := range states {
+            if st.AppliedAt == nil {
+                log.Fatalf("migration %04d_%s is pending; run `migrate up` first", st.Version, st.Name)
+            }
+        }
     }
 
     if err := database.SeedAdmin(db, cfg); err != nil {
@@ -37,19 +63,42 @@ func main() {
         log.Fatalf("sdui seed failed: %v", err)
     }
 
+    keys, err := utils.LoadKeySet(cfg.JWTSigningKeys, cfg.JWTAcceptHS256 != "false")
+    if err != nil {
+        log.Fatalf("jwt signing keys: %v", err)
+    }
+
     hubs := ws.NewHubs()
     go hubs.Monitoring.Run()
     go hubs.Student.Run()
 
+    // Background jobs and the HTTP server stop on SIGINT/SIGTERM
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
+
+    // Moodle quiz attempt poller (MOODLE_QUIZ_IDS, MOODLE_QUIZ_POLL_SECONDS)
+    go controllers.NewQuizAttemptController(db, hubs, cfg).RunPoller(ctx)
+    // Purge soft-deleted rows older than SOFT_DELETE_RETENTION_DAYS
+    go controllers.NewPurgeJob(db, cfg).Run(ctx)
+
     r := gin.Default()
-    routes.Register(r, db, cfg, hubs)
+    routes.Register(r, db, cfg, hubs, keys)
 
     port := cfg.Port
     if port == "" {
         port = "8080"
     }
 
-    if err := r.Run(":" + port); err != nil {
+    srv := &http.Server{Addr: ":" + port, Handler: r}
+    go func() {
+        <-ctx.Done()
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        if err := srv.Shutdown(shutdownCtx); err != nil {
+            log.Println("server shutdown:", err)
+        }
+    }()
+    if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
         log.Println("server exited with error:", err)
         os.Exit(1)
     }
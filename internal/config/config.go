@@ -1,6 +1,9 @@
 package config
 
-import "os"
+import (
+    "os"
+    "strings"
+)
 
 type Config struct {
     Port         string
@@ -29,6 +32,57 @@ type Config struct {
     MoodleSSOClientSecret string
     MoodleSSOLoginURL     string
     MoodleSSOSecret       string
+    // Moodle web service (REST) used by the user/cohort sync
+    MoodleURL                string
+    MoodleWSToken            string
+    MoodleSyncCourseIDs      string // comma-separated; empty syncs site users
+    MoodleSyncUserCriteria   string // core_user_get_users criterion key=value, default email=%
+    MoodleRoomCohortPrefix   string
+    MoodleMajorCohortPrefix  string
+    // Quiz attempt ingestion: quizzes to poll, poll interval (0 disables), webhook secret
+    MoodleQuizIDs            string
+    MoodleQuizPollSeconds    string
+    MoodleWebhookSecret      string
+    // Audience of SSO tokens (default: client id) and allowed redirect URL prefixes
+    MoodleSSOAudience          string
+    MoodleSSORedirectAllowlist string
+    // Asymmetric JWT keys: comma-separated kid:path.pem, first one signs
+    JWTSigningKeys        string
+    JWTAcceptHS256        string // "false" rejects HS256 tokens once clients have migrated
+    // Device binding for siswa (off|flag|enforce); window in hours, 0 = until reset
+    DeviceBindingMode        string
+    DeviceBindingWindowHours string
+    // Login throttling: store memory|postgres, failures before lockout, lockout minutes
+    LoginThrottleStore      string
+    LoginAccountMaxFailures string
+    LoginIPMaxFailures      string
+    LoginLockoutMinutes     string
+    // Password policy for user-chosen passwords; deny-list is comma-separated
+    PasswordMinLength  string
+    PasswordMinClasses string
+    PasswordDenyList   string
+    // OpenID Connect providers for staff login (OIDC_PROVIDERS=google,microsoft)
+    OIDCProviders       []OIDCProviderConfig
+    OIDCSuccessRedirect string // optional; tokens are appended as URL fragment
+    // Days soft-deleted users/rooms/majors stay restorable before they are purged (0 keeps them)
+    SoftDeleteRetentionDays string
+    // Apply pending schema migrations when the server starts ("false" leaves it to `migrate up`)
+    MigrateOnStart string
+    // Fallback for AppConfig single_room_per_student (default on)
+    SingleRoomPerStudent string
+}
+
+// OIDCProviderConfig is read from OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL, _SCOPES (space-separated, default "openid email profile") and
+// _TRUST_EMAIL ("true" accepts emails without email_verified, e.g. a single-tenant Microsoft issuer).
+type OIDCProviderConfig struct {
+    Name         string
+    Issuer       string
+    ClientID     string
+    ClientSecret string
+    RedirectURL  string
+    Scopes       string
+    TrustEmail   bool
 }
 
 func Load() *Config {
@@ -62,7 +116,55 @@ func Load() *Config {
         MoodleSSOClientSecret: os.Getenv("MOODLE_SSO_CLIENT_SECRET"),
         MoodleSSOLoginURL:     os.Getenv("MOODLE_SSO_LOGIN_URL"),
         MoodleSSOSecret:       firstNonEmpty(os.Getenv("MOODLE_SSO_SECRET"), os.Getenv("JWT_SECRET")),
+        MoodleURL:               os.Getenv("MOODLE_URL"),
+        MoodleWSToken:           os.Getenv("MOODLE_WS_TOKEN"),
+        MoodleSyncCourseIDs:     os.Getenv("MOODLE_SYNC_COURSE_IDS"),
+        MoodleSyncUserCriteria:  firstNonEmpty(os.Getenv("MOODLE_SYNC_USER_CRITERIA"), "email=%"),
+        MoodleRoomCohortPrefix:  firstNonEmpty(os.Getenv("MOODLE_ROOM_COHORT_PREFIX"), "ROOM-"),
+        MoodleMajorCohortPrefix: firstNonEmpty(os.Getenv("MOODLE_MAJOR_COHORT_PREFIX"), "MAJOR-"),
+        MoodleQuizIDs:           os.Getenv("MOODLE_QUIZ_IDS"),
+        MoodleQuizPollSeconds:   os.Getenv("MOODLE_QUIZ_POLL_SECONDS"),
+        MoodleWebhookSecret:     os.Getenv("MOODLE_WEBHOOK_SECRET"),
+        MoodleSSOAudience:          firstNonEmpty(os.Getenv("MOODLE_SSO_AUDIENCE"), os.Getenv("MOODLE_SSO_CLIENT_ID")),
+        MoodleSSORedirectAllowlist: os.Getenv("MOODLE_SSO_REDIRECT_ALLOWLIST"),
+        JWTSigningKeys:        os.Getenv("JWT_SIGNING_KEYS"),
+        JWTAcceptHS256:        os.Getenv("JWT_ACCEPT_HS256"),
+        DeviceBindingMode:        os.Getenv("DEVICE_BINDING_MODE"),
+        DeviceBindingWindowHours: os.Getenv("DEVICE_BINDING_WINDOW_HOURS"),
+        LoginThrottleStore:      os.Getenv("LOGIN_THROTTLE_STORE"),
+        LoginAccountMaxFailures: os.Getenv("LOGIN_ACCOUNT_MAX_FAILURES"),
+        LoginIPMaxFailures:      os.Getenv("LOGIN_IP_MAX_FAILURES"),
+        LoginLockoutMinutes:     os.Getenv("LOGIN_LOCKOUT_MINUTES"),
+        PasswordMinLength:  os.Getenv("PASSWORD_MIN_LENGTH"),
+        PasswordMinClasses: os.Getenv("PASSWORD_MIN_CLASSES"),
+        PasswordDenyList:   os.Getenv("PASSWORD_DENYLIST"),
+        OIDCProviders:       loadOIDCProviders(os.Getenv("OIDC_PROVIDERS")),
+        OIDCSuccessRedirect: os.Getenv("OIDC_SUCCESS_REDIRECT"),
+        SoftDeleteRetentionDays: firstNonEmpty(os.Getenv("SOFT_DELETE_RETENTION_DAYS"), "30"),
+        MigrateOnStart:          firstNonEmpty(os.Getenv("MIGRATE_ON_START"), "true"),
+        SingleRoomPerStudent:    os.Getenv("SINGLE_ROOM_PER_STUDENT"),
+    }
+}
+
+func loadOIDCProviders(names string) []OIDCProviderConfig {
+    var out []OIDCProviderConfig
+    for _, name := range strings.Split(names, ",") {
+        name = strings.ToLower(strings.TrimSpace(name))
+        if name == "" {
+            continue
+        }
+        prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+        out = append(out, OIDCProviderConfig{
+            Name:         name,
+            Issuer:       os.Getenv(prefix + "ISSUER"),
+            ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+            ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+            RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+            Scopes:       os.Getenv(prefix + "SCOPES"),
+            TrustEmail:   os.Getenv(prefix + "TRUST_EMAIL") == "true",
+        })
     }
+    return out
 }
 
 func firstNonEmpty(values ...string) string {
@@ -0,0 +1,545 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgconn"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// AcademicTermController manages academic terms, switching the active term and
+// rolling over to the next one.
+type AcademicTermController struct {
+    DB *gorm.DB
+}
+
+type termRequest struct {
+    Name         string `json:"name" binding:"required"`
+    AcademicYear string `json:"academic_year" binding:"required"`
+    Semester     int    `json:"semester"`
+    StartsOn     string `json:"starts_on"` // YYYY-MM-DD
+    EndsOn       string `json:"ends_on"`   // YYYY-MM-DD
+}
+
+type createTermRequest struct {
+    termRequest
+    Active bool `json:"active"`
+}
+
+type updateTermRequest struct {
+    Name     *string `json:"name"`
+    Semester *int    `json:"semester"`
+    StartsOn *string `json:"starts_on"` // "" clears
+    EndsOn   *string `json:"ends_on"`   // "" clears
+}
+
+// activeTermID returns the id of the active term, or nil when no term is active.
+func activeTermID(db *gorm.DB) (*string, error) {
+    var t models.AcademicTerm
+    err := db.Select("id").Where("active = ?", true).Take(&t).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &t.ID, nil
+}
+
+// termListFilter reads ?term_id= for listings of term-scoped rows: empty selects the
+// active term, "all" disables the filter, anything else must be a term id.
+func termListFilter(c *gin.Context, column string) (string, []interface{}, error) {
+    v := strings.TrimSpace(c.Query("term_id"))
+    switch {
+    case v == "":
+        return models.CurrentTermCond(column), nil, nil
+    case strings.EqualFold(v, "all"):
+        return "", nil, nil
+    }
+    if _, err := uuid.Parse(v); err != nil {
+        return "", nil, errors.New("invalid term_id")
+    }
+    return column + " = ?", []interface{}{v}, nil
+}
+
+func parseTermDate(field, v string) (*time.Time, error) {
+    v = strings.TrimSpace(v)
+    if v == "" {
+        return nil, nil
+    }
+    t, err := time.Parse("2006-01-02", v)
+    if err != nil {
+        return nil, fmt.Errorf("%s must be YYYY-MM-DD", field)
+    }
+    return &t, nil
+}
+
+func (req termRequest) toTerm() (models.AcademicTerm, error) {
+    t := models.AcademicTerm{
+        Name:         strings.TrimSpace(req.Name),
+        AcademicYear: strings.TrimSpace(req.AcademicYear),
+        Semester:     req.Semester,
+    }
+    if t.Name == "" {
+        return t, errors.New("name is required")
+    }
+    if !academicYearPattern.MatchString(t.AcademicYear) {
+        return t, errors.New("academic_year must look like 2025/2026")
+    }
+    if t.Semester < 0 || t.Semester > 2 {
+        return t, errors.New("semester must be 1, 2 or 0 for a whole year")
+    }
+    var err error
+    if t.StartsOn, err = parseTermDate("starts_on", req.StartsOn); err != nil {
+        return t, err
+    }
+    if t.EndsOn, err = parseTermDate("ends_on", req.EndsOn); err != nil {
+        return t, err
+    }
+    if t.StartsOn != nil && t.EndsOn != nil && t.EndsOn.Before(*t.StartsOn) {
+        return t, errors.New("ends_on must not be before starts_on")
+    }
+    return t, nil
+}
+
+func termJSON(t models.AcademicTerm) gin.H {
+    return gin.H{
+        "id":            t.ID,
+        "name":          t.Name,
+        "academic_year": t.AcademicYear,
+        "semester":      t.Semester,
+        "starts_on":     t.StartsOn,
+        "ends_on":       t.EndsOn,
+        "active":        t.Active,
+        "archived_at":   t.ArchivedAt,
+        "created_at":    t.CreatedAt,
+        "updated_at":    t.UpdatedAt,
+    }
+}
+
+func termConflict(c *gin.Context, err error) bool {
+    var pgErr *pgconn.PgError
+    if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+        c.JSON(http.StatusConflict, gin.H{"error": "term name already exists"})
+        return true
+    }
+    return false
+}
+
+// activateTerm makes t the active term. Assignments and exit codes created before any
+// term existed (term_id_ref NULL) are adopted by it.
+func activateTerm(tx *gorm.DB, t *models.AcademicTerm) error {
+    if err := tx.Model(&models.AcademicTerm{}).Where("active = ? AND id <> ?", true, t.ID).Update("active", false).Error; err != nil {
+        return err
+    }
+    for _, m := range []interface{}{&models.RoomStudent{}, &models.RoomSupervisor{}, &models.ExitCode{}} {
+        if err := tx.Model(m).Where("term_id_ref IS NULL").Update("term_id_ref", t.ID).Error; err != nil {
+            return err
+        }
+    }
+    t.Active = true
+    return tx.Model(t).Update("active", true).Error
+}
+
+func (tc *AcademicTermController) ListTerms(c *gin.Context) {
+    // Filters: academic_year, archived=true|false
+    q := tc.DB.Model(&models.AcademicTerm{})
+    if year := strings.TrimSpace(c.Query("academic_year")); year != "" {
+        q = q.Where("academic_year = ?", year)
+    }
+    switch strings.ToLower(strings.TrimSpace(c.Query("archived"))) {
+    case "true", "1":
+        q = q.Where("archived_at IS NOT NULL")
+    case "false", "0":
+        q = q.Where("archived_at IS NULL")
+    }
+    var terms []models.AcademicTerm
+    if err := q.Order("academic_year DESC, semester DESC, created_at DESC").Find(&terms).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    out := make([]gin.H, 0, len(terms))
+    for _, t := range terms {
+        out = append(out, termJSON(t))
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out, "meta": gin.H{"total": len(out)}})
+}
+
+func (tc *AcademicTermController) CreateTerm(c *gin.Context) {
+    var req createTermRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    t, err := req.toTerm()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := tc.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&t).Error; err != nil {
+            return err
+        }
+        if req.Active {
+            return activateTerm(tx, &t)
+        }
+        return nil
+    }); err != nil {
+        if termConflict(c, err) {
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusCreated, termJSON(t))
+}
+
+func (tc *AcademicTermController) loadTerm(c *gin.Context) (models.AcademicTerm, bool) {
+    var t models.AcademicTerm
+    id := strings.TrimSpace(c.Param("id"))
+    if _, err := uuid.Parse(id); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return t, false
+    }
+    if err := tc.DB.Where("id = ?", id).First(&t).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "term not found"})
+        return t, false
+    }
+    return t, true
+}
+
+// GetTerm returns a term with the number of assignments and exit codes it holds.
+func (tc *AcademicTermController) GetTerm(c *gin.Context) {
+    t, ok := tc.loadTerm(c)
+    if !ok {
+        return
+    }
+    counts := gin.H{}
+    for name, m := range map[string]interface{}{
+        "room_students":    &models.RoomStudent{},
+        "room_supervisors": &models.RoomSupervisor{},
+        "exit_codes":       &models.ExitCode{},
+    } {
+        var n int64
+        if err := tc.DB.Model(m).Where("term_id_ref = ?", t.ID).Count(&n).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        counts[name] = n
+    }
+    out := termJSON(t)
+    out["counts"] = counts
+    c.JSON(http.StatusOK, out)
+}
+
+func (tc *AcademicTermController) UpdateTerm(c *gin.Context) {
+    t, ok := tc.loadTerm(c)
+    if !ok {
+        return
+    }
+    if t.ArchivedAt != nil {
+        c.JSON(http.StatusConflict, gin.H{"error": "term is archived"})
+        return
+    }
+    var req updateTermRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    tr := termRequest{Name: t.Name, AcademicYear: t.AcademicYear, Semester: t.Semester}
+    if t.StartsOn != nil {
+        tr.StartsOn = t.StartsOn.Format("2006-01-02")
+    }
+    if t.EndsOn != nil {
+        tr.EndsOn = t.EndsOn.Format("2006-01-02")
+    }
+    if req.Name != nil {
+        tr.Name = *req.Name
+    }
+    if req.Semester != nil {
+        tr.Semester = *req.Semester
+    }
+    if req.StartsOn != nil {
+        tr.StartsOn = *req.StartsOn
+    }
+    if req.EndsOn != nil {
+        tr.EndsOn = *req.EndsOn
+    }
+    upd, err := tr.toTerm()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := tc.DB.Model(&t).Updates(map[string]interface{}{
+        "name":      upd.Name,
+        "semester":  upd.Semester,
+        "starts_on": upd.StartsOn,
+        "ends_on":   upd.EndsOn,
+    }).Error; err != nil {
+        if termConflict(c, err) {
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// ActivateTerm switches the active term without archiving the previous one (use
+// rollover to close a term).
+func (tc *AcademicTermController) ActivateTerm(c *gin.Context) {
+    t, ok := tc.loadTerm(c)
+    if !ok {
+        return
+    }
+    if t.ArchivedAt != nil {
+        c.JSON(http.StatusConflict, gin.H{"error": "term is archived"})
+        return
+    }
+    if err := tc.DB.Transaction(func(tx *gorm.DB) error {
+        return activateTerm(tx, &t)
+    }); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "activated", "term": termJSON(t)})
+}
+
+type rolloverRequest struct {
+    Apply               bool         `json:"apply"`
+    NextTermID          *string      `json:"next_term_id"` // existing, unarchived term
+    NextTerm            *termRequest `json:"next_term"`    // or a term to create
+    Promote             *bool        `json:"promote"`      // default: when the academic year changes
+    MaxGrade            int          `json:"max_grade"`    // default 12; classes at this grade graduate
+    DeactivateGraduates bool         `json:"deactivate_graduates"`
+}
+
+type rolloverClass struct {
+    ClassID     string  `json:"class_id"`
+    Name        string  `json:"name"`
+    GradeLevel  int     `json:"grade_level"`
+    Students    int64   `json:"students"`
+    ToClassID   *string `json:"to_class_id,omitempty"`
+    ToName      string  `json:"to_name,omitempty"`
+    CreateClass bool    `json:"create_class,omitempty"`
+
+    majorIDRef *string
+}
+
+type rolloverPlan struct {
+    From             models.AcademicTerm `json:"-"`
+    To               models.AcademicTerm `json:"-"`
+    Promote          bool                `json:"promote"`
+    Promoted         []rolloverClass     `json:"promoted"`
+    Graduated        []rolloverClass     `json:"graduated"`
+    Skipped          []rolloverClass     `json:"skipped"`
+    ExpireExitCodes int64               `json:"expire_exit_codes"`
+}
+
+var romanGrades = []string{"", "I", "II", "III", "IV", "V", "VI", "VII", "VIII", "IX", "X", "XI", "XII", "XIII", "XIV"}
+
+// nextClassName replaces the grade token of a class name, in roman or arabic numerals
+// ("X IPA 1" -> "XI IPA 1", "10 A" -> "11 A"); names without one are kept.
+func nextClassName(name string, grade int) string {
+    fields := strings.Fields(name)
+    for i, f := range fields {
+        if n, err := strconv.Atoi(f); err == nil && n == grade {
+            fields[i] = strconv.Itoa(grade + 1)
+            return strings.Join(fields, " ")
+        }
+        if grade+1 < len(romanGrades) && strings.EqualFold(f, romanGrades[grade]) {
+            fields[i] = romanGrades[grade+1]
+            return strings.Join(fields, " ")
+        }
+    }
+    return name
+}
+
+func (tc *AcademicTermController) buildRollover(req rolloverRequest) (*rolloverPlan, int, error) {
+    var from models.AcademicTerm
+    if err := tc.DB.Where("active = ?", true).Take(&from).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, http.StatusConflict, errors.New("no active term to roll over")
+        }
+        return nil, http.StatusInternalServerError, err
+    }
+    plan := &rolloverPlan{From: from}
+    switch {
+    case req.NextTermID != nil && req.NextTerm != nil:
+        return nil, http.StatusBadRequest, errors.New("use either next_term_id or next_term")
+    case req.NextTermID != nil:
+        if err := tc.DB.Where("id = ?", strings.TrimSpace(*req.NextTermID)).First(&plan.To).Error; err != nil {
+            return nil, http.StatusBadRequest, errors.New("next term not found")
+        }
+        if plan.To.ID == from.ID || plan.To.ArchivedAt != nil {
+            return nil, http.StatusConflict, errors.New("next term must be a different, unarchived term")
+        }
+    case req.NextTerm != nil:
+        t, err := req.NextTerm.toTerm()
+        if err != nil {
+            return nil, http.StatusBadRequest, err
+        }
+        plan.To = t
+    default:
+        return nil, http.StatusBadRequest, errors.New("next_term_id or next_term is required")
+    }
+
+    plan.Promote = plan.To.AcademicYear != from.AcademicYear
+    if req.Promote != nil {
+        plan.Promote = *req.Promote
+    }
+    maxGrade := req.MaxGrade
+    if maxGrade <= 0 {
+        maxGrade = 12
+    }
+    if err := tc.DB.Model(&models.ExitCode{}).Where("term_id_ref = ? AND used_at IS NULL", from.ID).Count(&plan.ExpireExitCodes).Error; err != nil {
+        return nil, http.StatusInternalServerError, err
+    }
+    if !plan.Promote {
+        return plan, 0, nil
+    }
+
+    var classes []models.Class
+    if err := tc.DB.Where("academic_year = ?", from.AcademicYear).Order("grade_level DESC, name ASC").Find(&classes).Error; err != nil {
+        return nil, http.StatusInternalServerError, err
+    }
+    for _, cl := range classes {
+        rc := rolloverClass{ClassID: cl.ID, Name: cl.Name, GradeLevel: cl.GradeLevel, majorIDRef: cl.MajorIDRef}
+        if err := tc.DB.Model(&models.User{}).Where("class_id_ref = ? AND role = ?", cl.ID, "siswa").Count(&rc.Students).Error; err != nil {
+            return nil, http.StatusInternalServerError, err
+        }
+        switch {
+        case cl.GradeLevel <= 0:
+            plan.Skipped = append(plan.Skipped, rc)
+        case cl.GradeLevel >= maxGrade:
+            plan.Graduated = append(plan.Graduated, rc)
+        default:
+            rc.ToName = nextClassName(cl.Name, cl.GradeLevel)
+            var target models.Class
+            err := tc.DB.Where("name = ? AND academic_year = ?", rc.ToName, plan.To.AcademicYear).First(&target).Error
+            if err == nil {
+                rc.ToClassID = &target.ID
+            } else if errors.Is(err, gorm.ErrRecordNotFound) {
+                rc.CreateClass = true
+            } else {
+                return nil, http.StatusInternalServerError, err
+            }
+            plan.Promoted = append(plan.Promoted, rc)
+        }
+    }
+    return plan, 0, nil
+}
+
+func (tc *AcademicTermController) applyRollover(plan *rolloverPlan, deactivateGraduates bool) error {
+    return tc.DB.Transaction(func(tx *gorm.DB) error {
+        now := time.Now().UTC()
+        if plan.To.ID == "" {
+            if err := tx.Create(&plan.To).Error; err != nil {
+                return err
+            }
+        }
+        // Graduates leave first, then classes move up from the highest grade, so a
+        // class is emptied before it receives the grade below
+        for _, rc := range plan.Graduated {
+            var ids []string
+            if err := tx.Model(&models.User{}).Where("class_id_ref = ? AND role = ?", rc.ClassID, "siswa").Pluck("id", &ids).Error; err != nil {
+                return err
+            }
+            if len(ids) == 0 {
+                continue
+            }
+            updates := map[string]interface{}{"class_id_ref": nil}
+            if deactivateGraduates {
+                updates["active"] = false
+            }
+            if err := tx.Model(&models.User{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+                return err
+            }
+            if deactivateGraduates {
+                for _, id := range ids {
+                    if err := invalidateUserTokens(tx, id); err != nil {
+                        return err
+                    }
+                }
+            }
+        }
+        for i := range plan.Promoted {
+            rc := &plan.Promoted[i]
+            if rc.CreateClass {
+                target := models.Class{
+                    Name:         rc.ToName,
+                    GradeLevel:   rc.GradeLevel + 1,
+                    MajorIDRef:   rc.majorIDRef,
+                    AcademicYear: plan.To.AcademicYear,
+                }
+                if err := tx.Create(&target).Error; err != nil {
+                    return err
+                }
+                rc.ToClassID = &target.ID
+            }
+            if err := tx.Model(&models.User{}).Where("class_id_ref = ? AND role = ?", rc.ClassID, "siswa").
+                Updates(map[string]interface{}{"class_id_ref": *rc.ToClassID, "kelas": rc.ToName}).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Model(&models.ExitCode{}).Where("term_id_ref = ? AND used_at IS NULL", plan.From.ID).
+            Update("used_at", now).Error; err != nil {
+            return err
+        }
+        if err := tx.Model(&plan.From).Updates(map[string]interface{}{"active": false, "archived_at": now}).Error; err != nil {
+            return err
+        }
+        return activateTerm(tx, &plan.To)
+    })
+}
+
+// Rollover closes the active term: siswa move to the next grade's class (created when
+// missing), the top grade graduates, unused exit codes expire, the term is archived
+// and the next term becomes active. Room assignments are not carried over. Dry run
+// unless {"apply": true}.
+func (tc *AcademicTermController) Rollover(c *gin.Context) {
+    var req rolloverRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    plan, status, err := tc.buildRollover(req)
+    if err != nil {
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Apply {
+        if err := tc.applyRollover(plan, req.DeactivateGraduates); err != nil {
+            if termConflict(c, err) {
+                return
+            }
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+    to := termJSON(plan.To)
+    if plan.To.ID == "" {
+        to["id"] = nil
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "applied":              req.Apply,
+        "from_term":            termJSON(plan.From),
+        "to_term":              to,
+        "promote":              plan.Promote,
+        "promoted":             plan.Promoted,
+        "graduated":            plan.Graduated,
+        "skipped":              plan.Skipped,
+        "expire_exit_codes":    plan.ExpireExitCodes,
+        "deactivate_graduates": req.DeactivateGraduates,
+    })
+}
@@ -1,8 +1,6 @@
 package controllers
 
 import (
-    "bytes"
-    "encoding/csv"
     "errors"
     "fmt"
     "io"
@@ -24,9 +22,10 @@ type AdminController struct {
 }
 
 type userImportError struct {
-    Row   int    `json:"row"`
-    Email string `json:"email,omitempty"`
-    Error string `json:"error"`
+    Row      int    `json:"row"`
+    Email    string `json:"email,omitempty"`
+    Username string `json:"username,omitempty"`
+    Error    string `json:"error"`
 }
 
 func parseBoolDefaultTrue(val string) (bool, bool) {
@@ -45,108 +44,32 @@ func parseBoolDefaultTrue(val string) (bool, bool) {
 
 // ImportUsers allows admin to bulk-create users from a CSV file.
 // Expected header columns (case-insensitive):
-// full_name, email, password, role (optional), kelas (optional), jurusan (optional), active (optional), room_name (optional)
+// full_name, email, password, username or nis (optional), role (optional), kelas (optional), jurusan (optional), active (optional), room_name (optional)
+// email may be empty for siswa rows that have a username/NIS; jurusan must match a major code or name.
 func (a *AdminController) ImportUsers(c *gin.Context) {
-    // Limit max upload size (10MB) to avoid accidental huge files.
-    if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse form"})
-        return
-    }
-    file, fileHeader, err := c.Request.FormFile("file")
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
-        return
-    }
-    defer file.Close()
-
-    if fileHeader == nil || fileHeader.Filename == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file name"})
-        return
-    }
-    filename := strings.ToLower(strings.TrimSpace(fileHeader.Filename))
-    if !strings.HasSuffix(filename, ".csv") {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "only .csv files are allowed"})
-        return
-    }
-
-    data, err := io.ReadAll(file)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
-        return
-    }
-    if len(bytes.TrimSpace(data)) == 0 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
-        return
-    }
-
-    // Normalise line endings so files saved with only CR (Mac classic) or CRLF behave consistently.
-    data = bytes.ReplaceAll(data, []byte{'\r', '\n'}, []byte{'\n'})
-    data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
-
-    delimiter := ','
-    firstLineEnd := bytes.IndexByte(data, '\n')
-    if firstLineEnd == -1 {
-        firstLineEnd = len(data)
-    }
-    firstLine := data[:firstLineEnd]
-    firstLine = bytes.TrimPrefix(firstLine, []byte{0xEF, 0xBB, 0xBF})
-    if bytes.Contains(firstLine, []byte{';'}) && !bytes.Contains(firstLine, []byte{','}) {
-        delimiter = ';'
-    }
-
-    newReader := func() *csv.Reader {
-        r := csv.NewReader(bytes.NewReader(data))
-        r.TrimLeadingSpace = true
-        r.FieldsPerRecord = -1
-        if delimiter != ',' {
-            r.Comma = delimiter
-        }
-        return r
-    }
-
-    reader := newReader()
-    header, err := reader.Read()
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read header"})
+    upload, ok := readCSVUpload(c)
+    if !ok {
         return
     }
-    cleanHeader := func(val string) string {
-        v := strings.TrimSpace(val)
-        for strings.HasPrefix(v, "\ufeff") {
-            v = strings.TrimPrefix(v, "\ufeff")
-        }
-        v = strings.Trim(v, "\"'")
-        return v
-    }
-    for i := range header {
-        header[i] = cleanHeader(header[i])
-    }
-
-    headerIdx := make(map[string]int, len(header))
-    for idx, col := range header {
-        key := strings.ToLower(strings.TrimSpace(col))
-        if key != "" {
-            headerIdx[key] = idx
-        }
-    }
-    log.Printf("import csv headers: %+v", header)
+    reader, headerIdx := upload.reader, upload.headerIdx
+    log.Printf("import csv headers: %+v", upload.header)
 
-    required := []string{"full_name", "email", "password"}
+    required := []string{"full_name", "password"}
     for _, key := range required {
         if _, ok := headerIdx[key]; !ok {
             c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("missing header column: %s", key)})
             return
         }
     }
-
-    getVal := func(record []string, key string) string {
-        idx, ok := headerIdx[key]
-        if !ok || idx >= len(record) {
-            return ""
-        }
-        return strings.TrimSpace(record[idx])
+    _, hasEmail := headerIdx["email"]
+    _, hasUsername := headerIdx["username"]
+    if !hasEmail && !hasUsername {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "missing header column: email or username/nis"})
+        return
     }
 
+    getVal := upload.value
+
     var (
         totalRows   int
         createdRows int
@@ -155,6 +78,7 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
 
     rowNum := 1 // already consumed header line
     roomCache := make(map[string]models.Room)
+    majorCache := make(map[string]*models.Major)
     for {
         row, err := reader.Read()
         if err == io.EOF {
@@ -172,6 +96,7 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
 
         fullName := getVal(row, "full_name")
         email := strings.ToLower(getVal(row, "email"))
+        username := normalizeUsername(getVal(row, "username"))
         password := getVal(row, "password")
         role := strings.ToLower(getVal(row, "role"))
         kelas := getVal(row, "kelas")
@@ -179,11 +104,12 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
         activeStr := getVal(row, "active")
         roomName := getVal(row, "room_name")
 
-        if fullName == "" || email == "" || password == "" {
+        if fullName == "" || password == "" {
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: "full_name, email, and password are required",
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    "full_name and password are required",
             })
             continue
         }
@@ -193,9 +119,10 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
         }
         if !IsValidRole(role) {
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: "invalid role",
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    "invalid role",
             })
             continue
         }
@@ -203,25 +130,40 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
         activeVal, provided := parseBoolDefaultTrue(activeStr)
         if activeStr != "" && !provided {
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: "invalid active value",
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    "invalid active value",
             })
             continue
         }
 
-        if existingErr := a.DB.Where("email = ?", email).First(&models.User{}).Error; existingErr == nil {
-            failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: "email already exists",
-            })
-            continue
-        } else if !errors.Is(existingErr, gorm.ErrRecordNotFound) {
+        major, cached := majorCache[strings.ToLower(jurusan)]
+        if !cached {
+            var majorErr error
+            major, majorErr = resolveMajor(a.DB, jurusan)
+            if majorErr != nil {
+                failures = append(failures, userImportError{
+                    Row:      rowNum,
+                    Email:    email,
+                    Username: username,
+                    Error:    fmt.Sprintf("jurusan '%s': %v", jurusan, majorErr),
+                })
+                continue
+            }
+            majorCache[strings.ToLower(jurusan)] = major
+        }
+
+        if idErr := checkUserIdentifiers(a.DB, role, email, username, ""); idErr != nil {
+            msg := idErr.Error()
+            if identifierErrorStatus(idErr) == http.StatusInternalServerError {
+                msg = fmt.Sprintf("failed to check existing user: %v", idErr)
+            }
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: fmt.Sprintf("failed to check existing user: %v", existingErr),
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    msg,
             })
             continue
         }
@@ -229,9 +171,10 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
         hashed, hashErr := utils.HashPassword(password)
         if hashErr != nil {
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: fmt.Sprintf("failed to hash password: %v", hashErr),
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    fmt.Sprintf("failed to hash password: %v", hashErr),
             })
             continue
         }
@@ -239,12 +182,15 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
         user := models.User{
             FullName: fullName,
             Email:    email,
+            Username: username,
             Password: hashed,
             Role:     role,
             Kelas:    kelas,
-            Jurusan:  jurusan,
             Active:   activeVal,
+            // Imported passwords are admin-chosen (often the NIS)
+            MustChangePassword: true,
         }
+        setUserMajor(&user, major)
 
         if err := a.DB.Transaction(func(tx *gorm.DB) error {
             if err := tx.Create(&user).Error; err != nil {
@@ -267,8 +213,13 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
                     roomCache[normalized] = fetched
                     room = fetched
                 }
-                assignment := models.RoomStudent{UserIDRef: user.ID, RoomIDRef: room.ID}
+                termID, err := activeTermID(tx)
+                if err != nil {
+                    return err
+                }
+                assignment := models.RoomStudent{UserIDRef: user.ID, RoomIDRef: room.ID, TermIDRef: termID}
                 if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", assignment.UserIDRef, assignment.RoomIDRef).
+                    Where(models.CurrentTermCond("term_id_ref")).
                     FirstOrCreate(&assignment).Error; err != nil {
                     return err
                 }
@@ -276,9 +227,10 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
             return nil
         }); err != nil {
             failures = append(failures, userImportError{
-                Row:   rowNum,
-                Email: email,
-                Error: fmt.Sprintf("failed to insert user: %v", err),
+                Row:      rowNum,
+                Email:    email,
+                Username: username,
+                Error:    fmt.Sprintf("failed to insert user: %v", err),
             })
             continue
         }
@@ -297,7 +249,7 @@ func (a *AdminController) ImportUsers(c *gin.Context) {
 }
 
 func (a *AdminController) ListUsers(c *gin.Context) {
-    // Query params: limit, page, all, sort_by, sort_dir, q, role, active
+    // Query params: limit, page, all, sort_by, sort_dir, q, role, active, include_deleted
     all := strings.EqualFold(c.Query("all"), "true") || c.Query("all") == "1"
     limit := 50
     page := 1
@@ -322,6 +274,7 @@ func (a *AdminController) ListUsers(c *gin.Context) {
         "created_at": "created_at",
         "full_name":  "full_name",
         "email":      "email",
+        "username":   "username",
         "role":       "role",
         "kelas":      "kelas",
         "jurusan":    "jurusan",
@@ -339,11 +292,18 @@ func (a *AdminController) ListUsers(c *gin.Context) {
     activeStr := strings.TrimSpace(strings.ToLower(c.Query("active")))
     kelasFilter := strings.TrimSpace(strings.ToLower(c.Query("kelas")))
     jurusanFilter := strings.TrimSpace(strings.ToLower(c.Query("jurusan")))
+    majorFilter := strings.TrimSpace(c.Query("major_id"))
+    // jurusan matches the linked major's code or name, or unreconciled free text
+    jurusanCond := "LOWER(jurusan) = ? OR major_id_ref IN (SELECT id FROM majors WHERE LOWER(code) = ? OR LOWER(name) = ?)"
 
+    withDeleted := includeDeleted(c)
     base := a.DB.Model(&models.User{})
+    if withDeleted {
+        base = base.Unscoped()
+    }
     if qText != "" {
         like := "%" + qText + "%"
-        base = base.Where("full_name ILIKE ? OR email ILIKE ?", like, like)
+        base = base.Where("full_name ILIKE ? OR email ILIKE ? OR username ILIKE ?", like, like, like)
     }
     if role != "" {
         if !IsValidRole(role) {
@@ -356,7 +316,10 @@ func (a *AdminController) ListUsers(c *gin.Context) {
         base = base.Where("LOWER(kelas) = ?", kelasFilter)
     }
     if jurusanFilter != "" {
-        base = base.Where("LOWER(jurusan) = ?", jurusanFilter)
+        base = base.Where(jurusanCond, jurusanFilter, jurusanFilter, jurusanFilter)
+    }
+    if majorFilter != "" {
+        base = base.Where("major_id_ref = ?", majorFilter)
     }
     if activeStr != "" {
         switch activeStr {
@@ -378,10 +341,13 @@ func (a *AdminController) ListUsers(c *gin.Context) {
 
     var users []models.User
     listQ := a.DB.Order(order)
+    if withDeleted {
+        listQ = listQ.Unscoped()
+    }
     // reapply filters to list query
     if qText != "" {
         like := "%" + qText + "%"
-        listQ = listQ.Where("full_name ILIKE ? OR email ILIKE ?", like, like)
+        listQ = listQ.Where("full_name ILIKE ? OR email ILIKE ? OR username ILIKE ?", like, like, like)
     }
     if role != "" {
         listQ = listQ.Where("role = ?", role)
@@ -390,7 +356,10 @@ func (a *AdminController) ListUsers(c *gin.Context) {
         listQ = listQ.Where("LOWER(kelas) = ?", kelasFilter)
     }
     if jurusanFilter != "" {
-        listQ = listQ.Where("LOWER(jurusan) = ?", jurusanFilter)
+        listQ = listQ.Where(jurusanCond, jurusanFilter, jurusanFilter, jurusanFilter)
+    }
+    if majorFilter != "" {
+        listQ = listQ.Where("major_id_ref = ?", majorFilter)
     }
     if activeStr != "" {
         switch activeStr {
@@ -422,6 +391,11 @@ func (a *AdminController) ListUsers(c *gin.Context) {
         }
         uuidUserIDs = append(uuidUserIDs, parsed)
     }
+    majors, err := majorsByID(a.DB, users)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
     type roomRow struct {
         UserID   string
         RoomID   string
@@ -436,7 +410,9 @@ func (a *AdminController) ListUsers(c *gin.Context) {
             Select("rs.user_id_ref AS user_id, r.id AS room_id, r.name AS room_name").
             Joins("JOIN rooms r ON r.id = rs.room_id_ref").
             Where("rs.user_id_ref IN ?", uuidUserIDs).
-            Order("rs.created_at ASC").
+            Where("rs.deleted_at IS NULL").
+            Where(models.CurrentTermCond("rs.term_id_ref")).
+            Order("rs.created_at DESC").
             Scan(&studentRows).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
             return
@@ -452,6 +428,8 @@ func (a *AdminController) ListUsers(c *gin.Context) {
             Select("rs.user_id_ref AS user_id, r.id AS room_id, r.name AS room_name").
             Joins("JOIN rooms r ON r.id = rs.room_id_ref").
             Where("rs.user_id_ref IN ?", uuidUserIDs).
+            Where("rs.deleted_at IS NULL").
+            Where(models.CurrentTermCond("rs.term_id_ref")).
             Order("rs.created_at ASC").
             Scan(&supervisorRows).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -471,6 +449,7 @@ func (a *AdminController) ListUsers(c *gin.Context) {
             "user_id":    u.ID,
             "full_name":  u.FullName,
             "email":      u.Email,
+            "username":   u.Username,
             "role":       u.Role,
             "kelas":      u.Kelas,
             "jurusan":    u.Jurusan,
@@ -478,6 +457,15 @@ func (a *AdminController) ListUsers(c *gin.Context) {
             "created_at": u.CreatedAt,
             "updated_at": u.UpdatedAt,
         }
+        entry["must_change_password"] = u.MustChangePassword
+        entry["class_id"] = u.ClassIDRef
+        entry["major"] = nil
+        if u.MajorIDRef != nil {
+            entry["major"] = majorBlock(majors[*u.MajorIDRef])
+        }
+        if withDeleted {
+            entry["deleted_at"] = u.DeletedAt
+        }
         var room interface{}
         switch strings.ToLower(u.Role) {
         case "siswa":
@@ -521,6 +509,9 @@ func (a *AdminController) ListUsers(c *gin.Context) {
     if jurusanFilter != "" {
         meta["jurusan"] = jurusanFilter
     }
+    if majorFilter != "" {
+        meta["major_id"] = majorFilter
+    }
     c.JSON(http.StatusOK, gin.H{"data": out, "meta": meta})
 }
 
@@ -531,27 +522,42 @@ func (a *AdminController) GetUser(c *gin.Context) {
         c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
         return
     }
+    majors, err := majorsByID(a.DB, []models.User{u})
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var major *models.Major
+    if u.MajorIDRef != nil {
+        major = majors[*u.MajorIDRef]
+    }
     c.JSON(http.StatusOK, gin.H{
-        "id":         u.ID,
-        "user_id":    u.ID,
-        "full_name":  u.FullName,
-        "email":      u.Email,
-        "role":       u.Role,
-        "kelas":      u.Kelas,
-        "jurusan":    u.Jurusan,
-        "active":     u.Active,
-        "created_at": u.CreatedAt,
-        "updated_at": u.UpdatedAt,
+        "id":                   u.ID,
+        "user_id":              u.ID,
+        "full_name":            u.FullName,
+        "email":                u.Email,
+        "username":             u.Username,
+        "role":                 u.Role,
+        "kelas":                u.Kelas,
+        "jurusan":              u.Jurusan,
+        "major":                majorBlock(major),
+        "class_id":             u.ClassIDRef,
+        "active":               u.Active,
+        "must_change_password": u.MustChangePassword,
+        "created_at":           u.CreatedAt,
+        "updated_at":           u.UpdatedAt,
     })
 }
 
 type updateUserRequest struct {
     FullName *string `json:"full_name"`
     Email    *string `json:"email"`
+    Username *string `json:"username"`
     Password *FlexibleString `json:"password"`
     Role     *string `json:"role"`
     Kelas    *FlexibleString `json:"kelas"`
-    Jurusan  *string `json:"jurusan"`
+    Jurusan  *string `json:"jurusan"`  // major code or name; "" clears
+    MajorID  *string `json:"major_id"` // takes precedence over jurusan
     Active   *bool   `json:"active"`
 }
 
@@ -569,28 +575,56 @@ func (a *AdminController) UpdateUser(c *gin.Context) {
         return
     }
 
+    // Password change, role change and deactivation invalidate the user's tokens
+    invalidate := false
     if req.FullName != nil {
         u.FullName = *req.FullName
     }
     if req.Email != nil {
-        u.Email = *req.Email
+        u.Email = strings.TrimSpace(*req.Email)
+    }
+    if req.Username != nil {
+        u.Username = normalizeUsername(*req.Username)
     }
     if req.Role != nil {
         if !IsValidRole(*req.Role) {
             c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
             return
         }
+        if *req.Role != u.Role {
+            invalidate = true
+        }
         u.Role = *req.Role
     }
     if req.Kelas != nil {
         u.Kelas = req.Kelas.String()
     }
-    if req.Jurusan != nil {
-        u.Jurusan = *req.Jurusan
+    if req.MajorID != nil || req.Jurusan != nil {
+        value := ""
+        if req.MajorID != nil {
+            value = *req.MajorID
+        } else {
+            value = *req.Jurusan
+        }
+        major, err := resolveMajor(a.DB, value)
+        if err != nil {
+            c.JSON(majorErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+        setUserMajor(&u, major)
     }
     if req.Active != nil {
+        if u.Active && !*req.Active {
+            invalidate = true
+        }
         u.Active = *req.Active
     }
+    if req.Email != nil || req.Username != nil || req.Role != nil {
+        if err := checkUserIdentifiers(a.DB, u.Role, u.Email, u.Username, u.ID); err != nil {
+            c.JSON(identifierErrorStatus(err), gin.H{"error": err.Error()})
+            return
+        }
+    }
     if req.Password != nil {
         raw := strings.TrimSpace(req.Password.String())
         if raw != "" {
@@ -600,10 +634,21 @@ func (a *AdminController) UpdateUser(c *gin.Context) {
                 return
             }
             u.Password = pw
+            u.MustChangePassword = true
+            invalidate = true
         }
     }
 
-    if err := a.DB.Save(&u).Error; err != nil {
+    if err := a.DB.Transaction(func(tx *gorm.DB) error {
+        // Omit token_version so a concurrent bump is not overwritten by the stale value
+        if err := tx.Omit("token_version").Save(&u).Error; err != nil {
+            return err
+        }
+        if invalidate {
+            return invalidateUserTokens(tx, u.ID)
+        }
+        return nil
+    }); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
@@ -616,34 +661,17 @@ func (a *AdminController) DeleteUser(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
         return
     }
-    err := a.DB.Transaction(func(tx *gorm.DB) error {
-        // Remove monitoring status, assignments, exit codes, refresh tokens referencing the user
-        if err := tx.Where("user_id_ref = ?", userID).Delete(&models.StudentStatus{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("user_id_ref = ?", userID).Delete(&models.RoomSupervisor{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("user_id_ref = ?", userID).Delete(&models.RoomStudent{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("user_id_ref = ?", userID).Delete(&models.ExitCode{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("student_user_id_ref = ?", userID).Delete(&models.ExitCode{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("user_id_ref = ?", userID).Delete(&models.RefreshToken{}).Error; err != nil {
-            return err
-        }
-        if err := tx.Where("id = ?", userID).Delete(&models.User{}).Error; err != nil {
-            return err
-        }
-        return nil
-    })
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if permanentDelete(c) {
+        deleteWithDependencies(c, a.DB, "user", &models.User{}, userID, userDependencies)
         return
     }
-    c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+    // Soft delete keeps exit codes and status history; the user can no longer sign in
+    softDelete(c, a.DB, "user", &models.User{}, userID, "user_id_ref", func(tx *gorm.DB) error {
+        return invalidateUserTokens(tx, userID)
+    })
+}
+
+// RestoreUser undoes a soft delete, including the room assignments deleted with the user.
+func (a *AdminController) RestoreUser(c *gin.Context) {
+    restoreDeleted(c, a.DB, "user", &models.User{}, strings.TrimSpace(c.Param("user_id")), "user_id_ref")
 }
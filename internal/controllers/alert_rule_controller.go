@@ -0,0 +1,220 @@
+package controllers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// AlertRuleController manages the rules evaluated against student status changes.
+type AlertRuleController struct {
+    DB *gorm.DB
+}
+
+type createAlertRuleRequest struct {
+    Name            string   `json:"name" binding:"required"`
+    Condition       string   `json:"condition" binding:"required"`
+    Threshold       int      `json:"threshold"`
+    WindowSeconds   int      `json:"window_seconds"`
+    CooldownSeconds int      `json:"cooldown_seconds"`
+    Actions         []string `json:"actions" binding:"required"`
+    Active          *bool    `json:"active"`
+}
+
+type updateAlertRuleRequest struct {
+    Name            *string   `json:"name"`
+    Condition       *string   `json:"condition"`
+    Threshold       *int      `json:"threshold"`
+    WindowSeconds   *int      `json:"window_seconds"`
+    CooldownSeconds *int      `json:"cooldown_seconds"`
+    Actions         *[]string `json:"actions"`
+    Active          *bool     `json:"active"`
+}
+
+func normalizeRuleActions(actions []string) ([]string, error) {
+    if len(actions) == 0 {
+        return nil, fmt.Errorf("actions must not be empty")
+    }
+    seen := make(map[string]struct{}, len(actions))
+    out := make([]string, 0, len(actions))
+    for _, a := range actions {
+        a = strings.ToLower(strings.TrimSpace(a))
+        if _, ok := validRuleActions[a]; !ok {
+            return nil, fmt.Errorf("invalid action: %s", a)
+        }
+        if _, dup := seen[a]; dup {
+            continue
+        }
+        seen[a] = struct{}{}
+        out = append(out, a)
+    }
+    return out, nil
+}
+
+func alertRuleResponse(r models.AlertRule) gin.H {
+    return gin.H{
+        "id":               r.ID,
+        "name":             r.Name,
+        "condition":        r.Condition,
+        "threshold":        r.Threshold,
+        "window_seconds":   r.WindowSeconds,
+        "cooldown_seconds": r.CooldownSeconds,
+        "actions":          ruleActions(r),
+        "active":           r.Active,
+        "created_at":       r.CreatedAt,
+        "updated_at":       r.UpdatedAt,
+    }
+}
+
+func (ac *AlertRuleController) List(c *gin.Context) {
+    var rules []models.AlertRule
+    q := ac.DB.Order("created_at DESC")
+    switch strings.ToLower(strings.TrimSpace(c.Query("active"))) {
+    case "true", "1":
+        q = q.Where("active = ?", true)
+    case "false", "0":
+        q = q.Where("active = ?", false)
+    }
+    if err := q.Find(&rules).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    out := make([]gin.H, 0, len(rules))
+    for _, r := range rules {
+        out = append(out, alertRuleResponse(r))
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out, "meta": gin.H{"total": len(out)}})
+}
+
+func (ac *AlertRuleController) Create(c *gin.Context) {
+    var req createAlertRuleRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    condition := strings.ToLower(strings.TrimSpace(req.Condition))
+    if _, ok := validRuleConditions[condition]; !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid condition"})
+        return
+    }
+    if req.Threshold < 0 || req.WindowSeconds < 0 || req.CooldownSeconds < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "threshold, window_seconds and cooldown_seconds must not be negative"})
+        return
+    }
+    actions, err := normalizeRuleActions(req.Actions)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    raw, _ := json.Marshal(actions)
+    active := true
+    if req.Active != nil {
+        active = *req.Active
+    }
+    rule := models.AlertRule{
+        Name:            strings.TrimSpace(req.Name),
+        Condition:       condition,
+        Threshold:       req.Threshold,
+        WindowSeconds:   req.WindowSeconds,
+        CooldownSeconds: req.CooldownSeconds,
+        Actions:         raw,
+        Active:          active,
+    }
+    if err := ac.DB.Create(&rule).Error; err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{"message": "created", "id": rule.ID})
+}
+
+func (ac *AlertRuleController) Get(c *gin.Context) {
+    id := strings.TrimSpace(c.Param("id"))
+    if id == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    var rule models.AlertRule
+    if err := ac.DB.Where("id = ?", id).First(&rule).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+        return
+    }
+    c.JSON(http.StatusOK, alertRuleResponse(rule))
+}
+
+func (ac *AlertRuleController) Update(c *gin.Context) {
+    id := strings.TrimSpace(c.Param("id"))
+    if id == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    var rule models.AlertRule
+    if err := ac.DB.Where("id = ?", id).First(&rule).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+        return
+    }
+    var req updateAlertRuleRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Name != nil {
+        rule.Name = strings.TrimSpace(*req.Name)
+    }
+    if req.Condition != nil {
+        condition := strings.ToLower(strings.TrimSpace(*req.Condition))
+        if _, ok := validRuleConditions[condition]; !ok {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid condition"})
+            return
+        }
+        rule.Condition = condition
+    }
+    if req.Threshold != nil {
+        rule.Threshold = *req.Threshold
+    }
+    if req.WindowSeconds != nil {
+        rule.WindowSeconds = *req.WindowSeconds
+    }
+    if req.CooldownSeconds != nil {
+        rule.CooldownSeconds = *req.CooldownSeconds
+    }
+    if rule.Threshold < 0 || rule.WindowSeconds < 0 || rule.CooldownSeconds < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "threshold, window_seconds and cooldown_seconds must not be negative"})
+        return
+    }
+    if req.Actions != nil {
+        actions, err := normalizeRuleActions(*req.Actions)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        raw, _ := json.Marshal(actions)
+        rule.Actions = raw
+    }
+    if req.Active != nil {
+        rule.Active = *req.Active
+    }
+    if err := ac.DB.Save(&rule).Error; err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+func (ac *AlertRuleController) Delete(c *gin.Context) {
+    id := strings.TrimSpace(c.Param("id"))
+    if id == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    if err := ac.DB.Where("id = ?", id).Delete(&models.AlertRule{}).Error; err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
@@ -9,12 +9,17 @@ import (
 
     "github.com/gin-gonic/gin"
     "gorm.io/gorm"
+    "gorm.io/gorm/clause"
 
+    "github.com/zaqqye/seb_backend_v1/internal/config"
     "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
 )
 
 type AssignmentController struct {
-    DB *gorm.DB
+    DB   *gorm.DB
+    Cfg  *config.Config
+    Hubs *ws.Hubs
 }
 
 type assignRequest struct {
@@ -49,8 +54,13 @@ func (ac *AssignmentController) AssignSupervisor(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "user is not pengawas"})
         return
     }
-    rec := models.RoomSupervisor{UserIDRef: user.ID, RoomIDRef: room.ID}
-    if err := ac.DB.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).FirstOrCreate(&rec).Error; err != nil {
+    termID, err := activeTermID(ac.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    rec := models.RoomSupervisor{UserIDRef: user.ID, RoomIDRef: room.ID, TermIDRef: termID}
+    if err := ac.DB.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).FirstOrCreate(&rec).Error; err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
@@ -69,7 +79,7 @@ func (ac *AssignmentController) UnassignSupervisor(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
         return
     }
-    if err := ac.DB.Where("user_id_ref = ? AND room_id_ref = ?", userID, roomID).Delete(&models.RoomSupervisor{}).Error; err != nil {
+    if err := ac.DB.Where("user_id_ref = ? AND room_id_ref = ?", userID, roomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomSupervisor{}).Error; err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
@@ -102,9 +112,27 @@ func (ac *AssignmentController) AssignStudent(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "user is not siswa"})
         return
     }
+    termID, err := activeTermID(ac.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    single, err := singleRoomPerStudent(ac.DB, ac.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
     if err := ac.DB.Transaction(func(tx *gorm.DB) error {
-        rec := models.RoomStudent{UserIDRef: user.ID, RoomIDRef: room.ID}
-        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).FirstOrCreate(&rec).Error; err != nil {
+        if single {
+            if err := checkSingleRoom(tx, user.ID, room.ID); err != nil {
+                return err
+            }
+        }
+        rec := models.RoomStudent{UserIDRef: user.ID, RoomIDRef: room.ID, TermIDRef: termID}
+        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).FirstOrCreate(&rec).Error; err != nil {
+            return err
+        }
+        if err := checkRoomCapacity(tx, room.ID); err != nil {
             return err
         }
         var st models.StudentStatus
@@ -120,12 +148,203 @@ func (ac *AssignmentController) AssignStudent(c *gin.Context) {
         }
         return nil
     }); err != nil {
+        var conflict *studentRoomConflict
+        if errors.As(err, &conflict) {
+            c.JSON(http.StatusConflict, gin.H{"error": conflict.Error(), "room_id": conflict.RoomID})
+            return
+        }
+        var full *roomFullError
+        if errors.As(err, &full) {
+            c.JSON(http.StatusConflict, gin.H{"error": full.Error()})
+            return
+        }
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
     c.JSON(http.StatusOK, gin.H{"message": "assigned"})
 }
 
+type assignClassRequest struct {
+    ClassID string `json:"class_id" binding:"required"`
+}
+
+// AssignClass assigns every siswa of a class to a room
+func (ac *AssignmentController) AssignClass(c *gin.Context) {
+    roomID := strings.TrimSpace(c.Param("id"))
+    if roomID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+        return
+    }
+    var room models.Room
+    if err := ac.DB.Where("id = ?", roomID).First(&room).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+        return
+    }
+    var req assignClassRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    var class models.Class
+    if err := ac.DB.Where("id = ?", strings.TrimSpace(req.ClassID)).First(&class).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "class not found"})
+        return
+    }
+    var studentIDs []string
+    if err := ac.DB.Model(&models.User{}).Where("class_id_ref = ? AND role = ?", class.ID, "siswa").Pluck("id", &studentIDs).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(studentIDs) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "class has no students"})
+        return
+    }
+    termID, err := activeTermID(ac.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    single, err := singleRoomPerStudent(ac.DB, ac.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    assigned := 0
+    skipped := []gin.H{}
+    if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+        locked, occupied, err := roomOccupancy(tx, room.ID)
+        if err != nil {
+            return err
+        }
+        for _, userID := range studentIDs {
+            if single {
+                // Students already seated in another room keep it
+                var conflict *studentRoomConflict
+                if err := checkSingleRoom(tx, userID, room.ID); errors.As(err, &conflict) {
+                    skipped = append(skipped, gin.H{"user_id": userID, "room_id": conflict.RoomID, "room_name": conflict.RoomName, "reason": conflict.Error()})
+                    continue
+                } else if err != nil {
+                    return err
+                }
+            }
+            rec := models.RoomStudent{UserIDRef: userID, RoomIDRef: room.ID, TermIDRef: termID}
+            q := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref"))
+            if locked.Capacity > 0 && occupied >= locked.Capacity {
+                // Full: only students already in the room are kept
+                if err := q.Session(&gorm.Session{}).Take(&rec).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+                    skipped = append(skipped, gin.H{"user_id": userID, "reason": (&roomFullError{RoomName: locked.Name, Capacity: locked.Capacity}).Error()})
+                    continue
+                } else if err != nil {
+                    return err
+                }
+            }
+            res := q.FirstOrCreate(&rec)
+            if res.Error != nil {
+                return res.Error
+            }
+            assigned += int(res.RowsAffected)
+            occupied += int(res.RowsAffected)
+            st := models.StudentStatus{UserIDRef: userID}
+            if err := tx.Where("user_id_ref = ?", userID).FirstOrCreate(&st).Error; err != nil {
+                return err
+            }
+        }
+        return nil
+    }); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "assigned", "class_id": class.ID, "students": len(studentIDs), "newly_assigned": assigned, "skipped": skipped})
+}
+
+type moveStudentRequest struct {
+    RoomID string `json:"room_id" binding:"required"`
+}
+
+var errStudentNotInRoom = errors.New("siswa is not in this room")
+
+// MoveStudent moves a siswa from room :id to the room in the body in one transaction,
+// keeping their monitoring status, and pushes the new room to the monitoring dashboards.
+func (ac *AssignmentController) MoveStudent(c *gin.Context) {
+    fromID := strings.TrimSpace(c.Param("id"))
+    userID := strings.TrimSpace(c.Param("user_id"))
+    if fromID == "" || userID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id or user_id"})
+        return
+    }
+    var req moveStudentRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    toID := strings.TrimSpace(req.RoomID)
+    if toID == fromID {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "siswa is already in this room"})
+        return
+    }
+    var to models.Room
+    if err := ac.DB.Where("id = ?", toID).First(&to).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+        return
+    }
+    termID, err := activeTermID(ac.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    single, err := singleRoomPerStudent(ac.DB, ac.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    err = ac.DB.Transaction(func(tx *gorm.DB) error {
+        // Lock the siswa so concurrent moves and assignments serialize
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ? AND role = ?", userID, "siswa").First(&models.User{}).Error; err != nil {
+            return err
+        }
+        res := tx.Where("user_id_ref = ? AND room_id_ref = ?", userID, fromID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{})
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            return errStudentNotInRoom
+        }
+        if single {
+            // Leftovers from before the constraint was enabled
+            if err := tx.Where("user_id_ref = ? AND room_id_ref <> ?", userID, to.ID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{}).Error; err != nil {
+                return err
+            }
+        }
+        rec := models.RoomStudent{UserIDRef: userID, RoomIDRef: to.ID, TermIDRef: termID}
+        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).FirstOrCreate(&rec).Error; err != nil {
+            return err
+        }
+        if err := checkRoomCapacity(tx, to.ID); err != nil {
+            return err
+        }
+        st := models.StudentStatus{UserIDRef: userID}
+        return tx.Where("user_id_ref = ?", userID).FirstOrCreate(&st).Error
+    })
+    var full *roomFullError
+    switch {
+    case err == nil:
+    case errors.Is(err, gorm.ErrRecordNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": "siswa not found"})
+        return
+    case errors.Is(err, errStudentNotInRoom):
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    case errors.As(err, &full):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+        return
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    go broadcastStudentStatus(ac.DB, ac.Hubs, userID)
+    c.JSON(http.StatusOK, gin.H{"message": "moved", "room_id": to.ID, "room_name": to.Name})
+}
+
 // UnassignStudent removes a siswa from a room
 func (ac *AssignmentController) UnassignStudent(c *gin.Context) {
     roomID := strings.TrimSpace(c.Param("id"))
@@ -139,7 +358,7 @@ func (ac *AssignmentController) UnassignStudent(c *gin.Context) {
         return
     }
     if err := ac.DB.Transaction(func(tx *gorm.DB) error {
-        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", userID, roomID).Delete(&models.RoomStudent{}).Error; err != nil {
+        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", userID, roomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{}).Error; err != nil {
             return err
         }
         if err := tx.Where("user_id_ref = ?", userID).Delete(&models.StudentStatus{}).Error; err != nil {
@@ -177,22 +396,40 @@ func (ac *AssignmentController) ListSupervisors(c *gin.Context) {
     sortCol, ok := allowedSorts[sortBy]; if !ok { sortCol = "rs.created_at" }
     order := fmt.Sprintf("%s %s", sortCol, sortDir)
 
+    termCond, termArgs, err := termListFilter(c, "rs.term_id_ref")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    withDeleted := includeDeleted(c)
+    scoped := func(q *gorm.DB) *gorm.DB {
+        q = q.Where("rs.room_id_ref = ?", roomID)
+        if !withDeleted {
+            q = q.Where("rs.deleted_at IS NULL")
+        }
+        if termCond != "" {
+            q = q.Where(termCond, termArgs...)
+        }
+        return q
+    }
+
     var total int64
-    if err := ac.DB.Model(&models.RoomSupervisor{}).Where("room_id_ref = ?", roomID).Count(&total).Error; err != nil {
+    if err := scoped(ac.DB.Table("room_supervisors AS rs")).Count(&total).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
     type row struct {
-        UserID    string `json:"user_id"`
-        FullName  string `json:"full_name"`
-        Email     string `json:"email"`
-        CreatedAt string `json:"created_at"`
+        UserID    string  `json:"user_id"`
+        FullName  string  `json:"full_name"`
+        Email     string  `json:"email"`
+        CreatedAt string  `json:"created_at"`
+        DeletedAt *string `json:"deleted_at,omitempty"`
     }
     q := ac.DB.Table("room_supervisors AS rs").
-        Select("u.id AS user_id, u.full_name, u.email, rs.created_at").
+        Select("u.id AS user_id, u.full_name, u.email, rs.created_at, rs.deleted_at").
         Joins("JOIN users u ON u.id = rs.user_id_ref").
-        Where("rs.room_id_ref = ?", roomID).
+        Scopes(scoped).
         Order(order)
     if !all { q = q.Offset((page-1)*limit).Limit(limit) }
     var rows []row
@@ -213,22 +450,8 @@ func (ac *AssignmentController) ListStudents(c *gin.Context) {
         return
     }
 
-    uVal, ok := c.Get("user")
-    if ok {
-        user := uVal.(models.User)
-        if strings.ToLower(user.Role) == "pengawas" {
-            var count int64
-            if err := ac.DB.Model(&models.RoomSupervisor{}).
-                Where("user_id_ref = ? AND room_id_ref = ?", user.ID, roomID).
-                Count(&count).Error; err != nil {
-                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-                return
-            }
-            if count == 0 {
-                c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this room"})
-                return
-            }
-        }
+    if !ac.canViewRoom(c, roomID) {
+        return
     }
 
     all := strings.EqualFold(c.Query("all"), "true") || c.Query("all") == "1"
@@ -249,24 +472,42 @@ func (ac *AssignmentController) ListStudents(c *gin.Context) {
     sortCol, ok := allowedSorts[sortBy]; if !ok { sortCol = "rs.created_at" }
     order := fmt.Sprintf("%s %s", sortCol, sortDir)
 
+    termCond, termArgs, err := termListFilter(c, "rs.term_id_ref")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    withDeleted := includeDeleted(c)
+    scoped := func(q *gorm.DB) *gorm.DB {
+        q = q.Where("rs.room_id_ref = ?", roomID)
+        if !withDeleted {
+            q = q.Where("rs.deleted_at IS NULL")
+        }
+        if termCond != "" {
+            q = q.Where(termCond, termArgs...)
+        }
+        return q
+    }
+
     var total int64
-    if err := ac.DB.Model(&models.RoomStudent{}).Where("room_id_ref = ?", roomID).Count(&total).Error; err != nil {
+    if err := scoped(ac.DB.Table("room_students AS rs")).Count(&total).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
     type row struct {
-        UserID    string `json:"user_id"`
-        FullName  string `json:"full_name"`
-        Email     string `json:"email"`
-        Kelas     string `json:"kelas"`
-        Jurusan   string `json:"jurusan"`
-        CreatedAt string `json:"created_at"`
+        UserID    string  `json:"user_id"`
+        FullName  string  `json:"full_name"`
+        Email     string  `json:"email"`
+        Kelas     string  `json:"kelas"`
+        Jurusan   string  `json:"jurusan"`
+        CreatedAt string  `json:"created_at"`
+        DeletedAt *string `json:"deleted_at,omitempty"`
     }
     q := ac.DB.Table("room_students AS rs").
-        Select("u.id AS user_id, u.full_name, u.email, u.kelas, u.jurusan, rs.created_at").
+        Select("u.id AS user_id, u.full_name, u.email, u.kelas, u.jurusan, rs.created_at, rs.deleted_at").
         Joins("JOIN users u ON u.id = rs.user_id_ref").
-        Where("rs.room_id_ref = ?", roomID).
+        Scopes(scoped).
         Order(order)
     if !all { q = q.Offset((page-1)*limit).Limit(limit) }
     var rows []row
@@ -278,3 +519,29 @@ func (ac *AssignmentController) ListStudents(c *gin.Context) {
     if !all { meta["limit"] = limit; meta["page"] = page; meta["sort_by"] = sortBy; meta["sort_dir"] = sortDir }
     c.JSON(http.StatusOK, gin.H{"data": rows, "meta": meta})
 }
+
+// canViewRoom lets admins through and pengawas only for rooms they supervise in the
+// active term; otherwise it writes the error response and returns false.
+func (ac *AssignmentController) canViewRoom(c *gin.Context, roomID string) bool {
+    uVal, ok := c.Get("user")
+    if !ok {
+        return true
+    }
+    user := uVal.(models.User)
+    if strings.ToLower(user.Role) != "pengawas" {
+        return true
+    }
+    var count int64
+    if err := ac.DB.Model(&models.RoomSupervisor{}).
+        Where("user_id_ref = ? AND room_id_ref = ?", user.ID, roomID).
+        Where(models.CurrentTermCond("term_id_ref")).
+        Count(&count).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return false
+    }
+    if count == 0 {
+        c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this room"})
+        return false
+    }
+    return true
+}
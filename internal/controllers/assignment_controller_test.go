@@ -0,0 +1,57 @@
+package controllers
+
+import (
+    "net/http"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func TestMoveStudent(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    lab1 := models.Room{Name: "Lab 1", Active: true}
+    lab2 := models.Room{Name: "Lab 2", Active: true}
+    mustCreate(t, db, &lab1)
+    mustCreate(t, db, &lab2)
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: lab1.ID})
+    move := func(from, user, to string) int {
+        return callHandler(ac.MoveStudent, http.MethodPost, "/", `{"room_id":"`+to+`"}`, nil,
+            gin.Param{Key: "id", Value: from}, gin.Param{Key: "user_id", Value: user}).Code
+    }
+
+    if code := move(lab1.ID, budi.ID, lab2.ID); code != http.StatusOK {
+        t.Fatalf("move: got %d, want 200", code)
+    }
+    for room, want := range map[string]int64{lab1.ID: 0, lab2.ID: 1} {
+        if n := countRows(t, db, "room_students", "user_id_ref = ? AND room_id_ref = ? AND deleted_at IS NULL", budi.ID, room); n != want {
+            t.Fatalf("room %s holds budi %d times, want %d", room, n, want)
+        }
+    }
+    if n := countRows(t, db, "student_statuses", "user_id_ref = ?", budi.ID); n != 1 {
+        t.Fatalf("moved siswa has %d statuses, want 1", n)
+    }
+
+    for _, tc := range []struct {
+        name           string
+        from, user, to string
+        want           int
+    }{
+        {"not in the source room", lab1.ID, budi.ID, lab2.ID, http.StatusNotFound},
+        {"same room", lab2.ID, budi.ID, lab2.ID, http.StatusBadRequest},
+        {"unknown target room", lab2.ID, budi.ID, uuid.NewString(), http.StatusNotFound},
+        {"not a siswa", lab1.ID, guru.ID, lab2.ID, http.StatusNotFound},
+    } {
+        if code := move(tc.from, tc.user, tc.to); code != tc.want {
+            t.Fatalf("%s: got %d, want %d", tc.name, code, tc.want)
+        }
+    }
+    if n := countRows(t, db, "room_students", "user_id_ref = ? AND room_id_ref = ? AND deleted_at IS NULL", budi.ID, lab2.ID); n != 1 {
+        t.Fatal("a rejected move changed the assignment")
+    }
+}
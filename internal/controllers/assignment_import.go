@@ -0,0 +1,434 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// assignmentImportChange is one change planned by ImportAssignments. Row is 0 for
+// removals implied by mode=replace.
+type assignmentImportChange struct {
+    Row       int      `json:"row,omitempty"`
+    UserID    string   `json:"user_id"`
+    FullName  string   `json:"full_name"`
+    Role      string   `json:"role"`
+    RoomID    string   `json:"room_id"`
+    RoomName  string   `json:"room_name"`
+    Action    string   `json:"action"` // create, move or remove
+    FromRooms []string `json:"from_rooms,omitempty"`
+}
+
+// ImportAssignments creates, moves and removes room assignments of existing users from a
+// CSV file (multipart field "file") for the active term.
+// Expected header columns (case-insensitive):
+// email and/or username or nis, room_name, role (optional, must match the user's role), action (optional: assign|remove)
+// With single_room_per_student on, a siswa assigned to another room is moved; otherwise
+// the room is added. Form field mode=replace also removes, for each
+// room and role in the file, the assignments that are not listed. Nothing is written
+// unless form field apply=true; the response is the plan either way.
+func (ac *AssignmentController) ImportAssignments(c *gin.Context) {
+    upload, ok := readCSVUpload(c)
+    if !ok {
+        return
+    }
+    apply := strings.EqualFold(c.PostForm("apply"), "true") || c.PostForm("apply") == "1"
+    mode := strings.ToLower(strings.TrimSpace(c.DefaultPostForm("mode", "merge")))
+    if mode != "merge" && mode != "replace" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode (merge or replace)"})
+        return
+    }
+    if _, ok := upload.headerIdx["room_name"]; !ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "missing header column: room_name"})
+        return
+    }
+    _, hasEmail := upload.headerIdx["email"]
+    _, hasUsername := upload.headerIdx["username"]
+    if !hasEmail && !hasUsername {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "missing header column: email or username/nis"})
+        return
+    }
+
+    type intent struct {
+        row    int
+        user   models.User
+        room   models.Room
+        remove bool
+    }
+    var (
+        intents   []intent
+        failures  []userImportError
+        totalRows int
+    )
+    userCache := map[string]*models.User{}
+    roomCache := map[string]*models.Room{}
+    rowNum := 1 // already consumed header line
+    for {
+        row, err := upload.reader.Read()
+        if err == io.EOF {
+            break
+        }
+        // an unreadable row still counts, so later row numbers match the file
+        rowNum++
+        totalRows++
+        if err != nil {
+            failures = append(failures, userImportError{Row: rowNum, Error: fmt.Sprintf("failed to read row: %v", err)})
+            continue
+        }
+
+        email := strings.ToLower(upload.value(row, "email"))
+        username := normalizeUsername(upload.value(row, "username"))
+        roomName := upload.value(row, "room_name")
+        role := strings.ToLower(upload.value(row, "role"))
+        action := strings.ToLower(upload.value(row, "action"))
+        fail := func(msg string) {
+            failures = append(failures, userImportError{Row: rowNum, Email: email, Username: username, Error: msg})
+        }
+
+        if email == "" && username == "" {
+            fail("email or username/nis is required")
+            continue
+        }
+        if roomName == "" {
+            fail("room_name is required")
+            continue
+        }
+        if action != "" && action != "assign" && action != "remove" {
+            fail("invalid action (assign or remove)")
+            continue
+        }
+
+        key := "e:" + email
+        if email == "" {
+            key = "u:" + username
+        }
+        user, cached := userCache[key]
+        if !cached {
+            var fetched models.User
+            q := ac.DB.Where("email = ?", email)
+            if email == "" {
+                q = ac.DB.Where("LOWER(username) = ?", username)
+            }
+            if err := q.First(&fetched).Error; err != nil {
+                if !errors.Is(err, gorm.ErrRecordNotFound) {
+                    fail(fmt.Sprintf("failed to look up user: %v", err))
+                    continue
+                }
+            } else {
+                user = &fetched
+            }
+            userCache[key] = user
+        }
+        if user == nil {
+            fail("user not found")
+            continue
+        }
+        if user.Role != "siswa" && user.Role != "pengawas" {
+            fail(fmt.Sprintf("user is %s; only siswa and pengawas can be assigned", user.Role))
+            continue
+        }
+        if role != "" && role != user.Role {
+            fail(fmt.Sprintf("role '%s' does not match user role '%s'", role, user.Role))
+            continue
+        }
+
+        normalized := strings.ToLower(roomName)
+        room, cached := roomCache[normalized]
+        if !cached {
+            var fetched models.Room
+            if err := ac.DB.Where("LOWER(name) = ?", normalized).First(&fetched).Error; err != nil {
+                if !errors.Is(err, gorm.ErrRecordNotFound) {
+                    fail(fmt.Sprintf("failed to look up room: %v", err))
+                    continue
+                }
+            } else {
+                room = &fetched
+            }
+            roomCache[normalized] = room
+        }
+        if room == nil {
+            fail(fmt.Sprintf("room '%s' not found", roomName))
+            continue
+        }
+        intents = append(intents, intent{row: rowNum, user: *user, room: *room, remove: action == "remove"})
+    }
+
+    termID, err := activeTermID(ac.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    single, err := singleRoomPerStudent(ac.DB, ac.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    // Current assignments of the users and rooms in the file
+    userIDs := []string{}
+    roomIDs := []string{}
+    for _, in := range intents {
+        userIDs = append(userIDs, in.user.ID)
+        roomIDs = append(roomIDs, in.room.ID)
+    }
+    var students []models.RoomStudent
+    if err := ac.DB.Where("user_id_ref IN ? OR room_id_ref IN ?", userIDs, roomIDs).Where(models.CurrentTermCond("term_id_ref")).Find(&students).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var supervisors []models.RoomSupervisor
+    if err := ac.DB.Where("user_id_ref IN ? OR room_id_ref IN ?", userIDs, roomIDs).Where(models.CurrentTermCond("term_id_ref")).Find(&supervisors).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    current := map[string]map[string]bool{"siswa": {}, "pengawas": {}} // role -> "user|room"
+    studentRooms := map[string][]string{}
+    for _, rs := range students {
+        current["siswa"][rs.UserIDRef+"|"+rs.RoomIDRef] = true
+        studentRooms[rs.UserIDRef] = append(studentRooms[rs.UserIDRef], rs.RoomIDRef)
+    }
+    for _, rs := range supervisors {
+        current["pengawas"][rs.UserIDRef+"|"+rs.RoomIDRef] = true
+    }
+    roomNames := map[string]string{}
+    for _, r := range roomCache {
+        if r != nil {
+            roomNames[r.ID] = r.Name
+        }
+    }
+
+    var changes []assignmentImportChange
+    unchanged := 0
+    seenPair := map[string]int{}
+    studentTarget := map[string]int{}      // siswa -> row assigning them
+    listed := map[string]map[string]bool{} // role|room -> users assigned by the file
+    touched := map[string]bool{}           // user|room removed or left by a planned change
+    for _, in := range intents {
+        pair := in.user.ID + "|" + in.room.ID
+        if prev, dup := seenPair[pair]; dup {
+            failures = append(failures, userImportError{Row: in.row, Email: in.user.Email, Username: in.user.Username, Error: fmt.Sprintf("duplicate of row %d", prev)})
+            continue
+        }
+        seenPair[pair] = in.row
+        change := assignmentImportChange{
+            Row:      in.row,
+            UserID:   in.user.ID,
+            FullName: in.user.FullName,
+            Role:     in.user.Role,
+            RoomID:   in.room.ID,
+            RoomName: in.room.Name,
+        }
+        assigned := current[in.user.Role][pair]
+        if in.remove {
+            if !assigned {
+                unchanged++
+                continue
+            }
+            change.Action = "remove"
+            touched[pair] = true
+            changes = append(changes, change)
+            continue
+        }
+        if single && in.user.Role == "siswa" {
+            if prev, ok := studentTarget[in.user.ID]; ok {
+                failures = append(failures, userImportError{Row: in.row, Email: in.user.Email, Username: in.user.Username, Error: fmt.Sprintf("siswa is already assigned to another room in row %d", prev)})
+                continue
+            }
+            studentTarget[in.user.ID] = in.row
+        }
+        key := in.user.Role + "|" + in.room.ID
+        if listed[key] == nil {
+            listed[key] = map[string]bool{}
+        }
+        listed[key][in.user.ID] = true
+        if single && in.user.Role == "siswa" {
+            for _, roomID := range studentRooms[in.user.ID] {
+                if roomID != in.room.ID {
+                    change.FromRooms = append(change.FromRooms, roomID)
+                    touched[in.user.ID+"|"+roomID] = true
+                }
+            }
+        }
+        switch {
+        case len(change.FromRooms) > 0:
+            change.Action = "move"
+        case assigned:
+            unchanged++
+            continue
+        default:
+            change.Action = "create"
+        }
+        changes = append(changes, change)
+    }
+
+    if mode == "replace" {
+        type stale struct{ userID, roomID, role string }
+        var removals []stale
+        for _, rs := range students {
+            key := "siswa|" + rs.RoomIDRef
+            if listed[key] != nil && !listed[key][rs.UserIDRef] && !touched[rs.UserIDRef+"|"+rs.RoomIDRef] {
+                removals = append(removals, stale{rs.UserIDRef, rs.RoomIDRef, "siswa"})
+            }
+        }
+        for _, rs := range supervisors {
+            key := "pengawas|" + rs.RoomIDRef
+            if listed[key] != nil && !listed[key][rs.UserIDRef] && !touched[rs.UserIDRef+"|"+rs.RoomIDRef] {
+                removals = append(removals, stale{rs.UserIDRef, rs.RoomIDRef, "pengawas"})
+            }
+        }
+        if len(removals) > 0 {
+            ids := make([]string, 0, len(removals))
+            for _, r := range removals {
+                ids = append(ids, r.userID)
+            }
+            var users []models.User
+            if err := ac.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
+            names := map[string]string{}
+            for _, u := range users {
+                names[u.ID] = u.FullName
+            }
+            sort.Slice(removals, func(i, j int) bool {
+                if removals[i].roomID != removals[j].roomID {
+                    return roomNames[removals[i].roomID] < roomNames[removals[j].roomID]
+                }
+                return names[removals[i].userID] < names[removals[j].userID]
+            })
+            for _, r := range removals {
+                changes = append(changes, assignmentImportChange{
+                    UserID:   r.userID,
+                    FullName: names[r.userID],
+                    Role:     r.role,
+                    RoomID:   r.roomID,
+                    RoomName: roomNames[r.roomID],
+                    Action:   "remove",
+                })
+            }
+        }
+    }
+
+    // Names of the rooms moved siswa leave that are not in the file
+    var missing []string
+    for _, ch := range changes {
+        for _, id := range ch.FromRooms {
+            if _, ok := roomNames[id]; !ok {
+                missing = append(missing, id)
+            }
+        }
+    }
+    if len(missing) > 0 {
+        var rooms []models.Room
+        if err := ac.DB.Unscoped().Where("id IN ?", missing).Find(&rooms).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for _, r := range rooms {
+            roomNames[r.ID] = r.Name
+        }
+    }
+    summary := gin.H{"total_rows": totalRows, "unchanged": unchanged, "failed": len(failures)}
+    counts := map[string]int{}
+    for i := range changes {
+        counts[changes[i].Action]++
+        for j, id := range changes[i].FromRooms {
+            changes[i].FromRooms[j] = roomNames[id]
+        }
+    }
+    summary["created"] = counts["create"]
+    summary["moved"] = counts["move"]
+    summary["removed"] = counts["remove"]
+
+    if apply && len(changes) > 0 {
+        if err := ac.DB.Transaction(func(tx *gorm.DB) error {
+            return applyAssignmentChanges(tx, changes, termID)
+        }); err != nil {
+            var full *roomFullError
+            if errors.As(err, &full) {
+                c.JSON(http.StatusConflict, gin.H{"error": full.Error()})
+                return
+            }
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+    if changes == nil {
+        changes = []assignmentImportChange{}
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "dry_run": !apply,
+        "mode":    mode,
+        "summary": summary,
+        "changes": changes,
+        "errors":  failures,
+    })
+}
+
+// applyAssignmentChanges writes a plan of ImportAssignments for the active term. Like
+// UnassignStudent, a siswa left without any room loses their monitoring status. Rooms
+// that end up over capacity fail the whole plan.
+func applyAssignmentChanges(tx *gorm.DB, changes []assignmentImportChange, termID *string) error {
+    removedStudents := map[string]bool{}
+    filledRooms := map[string]bool{}
+    for _, ch := range changes {
+        if ch.Role == "pengawas" {
+            if ch.Action == "remove" {
+                if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", ch.UserID, ch.RoomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomSupervisor{}).Error; err != nil {
+                    return err
+                }
+                continue
+            }
+            if err := tx.Create(&models.RoomSupervisor{UserIDRef: ch.UserID, RoomIDRef: ch.RoomID, TermIDRef: termID}).Error; err != nil {
+                return err
+            }
+            continue
+        }
+        switch ch.Action {
+        case "remove":
+            if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", ch.UserID, ch.RoomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{}).Error; err != nil {
+                return err
+            }
+            removedStudents[ch.UserID] = true
+            continue
+        case "move":
+            if err := tx.Where("user_id_ref = ? AND room_id_ref <> ?", ch.UserID, ch.RoomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{}).Error; err != nil {
+                return err
+            }
+        }
+        rec := models.RoomStudent{UserIDRef: ch.UserID, RoomIDRef: ch.RoomID, TermIDRef: termID}
+        if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).FirstOrCreate(&rec).Error; err != nil {
+            return err
+        }
+        st := models.StudentStatus{UserIDRef: ch.UserID}
+        if err := tx.Where("user_id_ref = ?", ch.UserID).FirstOrCreate(&st).Error; err != nil {
+            return err
+        }
+        filledRooms[ch.RoomID] = true
+    }
+    for roomID := range filledRooms {
+        if err := checkRoomCapacity(tx, roomID); err != nil {
+            return err
+        }
+    }
+    for userID := range removedStudents {
+        var left int64
+        if err := tx.Model(&models.RoomStudent{}).Where("user_id_ref = ?", userID).Where(models.CurrentTermCond("term_id_ref")).Count(&left).Error; err != nil {
+            return err
+        }
+        if left == 0 {
+            if err := tx.Where("user_id_ref = ?", userID).Delete(&models.StudentStatus{}).Error; err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
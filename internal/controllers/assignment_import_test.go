@@ -0,0 +1,145 @@
+package controllers
+
+import (
+    "bytes"
+    "encoding/json"
+    "mime/multipart"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// callCSVUpload posts csv as multipart field "file" with the given form fields.
+func callCSVUpload(t *testing.T, h gin.HandlerFunc, csv string, fields map[string]string) *httptest.ResponseRecorder {
+    t.Helper()
+    var body bytes.Buffer
+    mw := multipart.NewWriter(&body)
+    fw, err := mw.CreateFormFile("file", "upload.csv")
+    if err != nil {
+        t.Fatal(err)
+    }
+    fw.Write([]byte(csv))
+    for k, v := range fields {
+        mw.WriteField(k, v)
+    }
+    if err := mw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    gin.SetMode(gin.TestMode)
+    w := httptest.NewRecorder()
+    c, _ := gin.CreateTestContext(w)
+    c.Request = httptest.NewRequest(http.MethodPost, "/upload", &body)
+    c.Request.Header.Set("Content-Type", mw.FormDataContentType())
+    h(c)
+    return w
+}
+
+type assignmentImportResult struct {
+    DryRun  bool                     `json:"dry_run"`
+    Summary map[string]int           `json:"summary"`
+    Changes []assignmentImportChange `json:"changes"`
+    Errors  []userImportError        `json:"errors"`
+}
+
+func runAssignmentImport(t *testing.T, ac *AssignmentController, csv string, fields map[string]string) assignmentImportResult {
+    t.Helper()
+    w := callCSVUpload(t, ac.ImportAssignments, csv, fields)
+    if w.Code != http.StatusOK {
+        t.Fatalf("import: %d %s", w.Code, w.Body.String())
+    }
+    var res assignmentImportResult
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+        t.Fatal(err)
+    }
+    return res
+}
+
+func TestImportAssignmentsPlan(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    lab1 := models.Room{Name: "Lab 1", Active: true}
+    lab2 := models.Room{Name: "Lab 2", Active: true}
+    mustCreate(t, db, &lab1)
+    mustCreate(t, db, &lab2)
+    user := func(name, role string) models.User {
+        return createTestUser(t, db, models.User{FullName: name, Email: name + "@school.test", Role: role}, "rahasia123")
+    }
+    budi, ani, cici := user("budi", "siswa"), user("ani", "siswa"), user("cici", "siswa")
+    guru, dewi := user("guru", "pengawas"), user("dewi", "pengawas")
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: lab1.ID})
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: ani.ID, RoomIDRef: lab1.ID})
+    mustCreate(t, db, &models.RoomSupervisor{UserIDRef: guru.ID, RoomIDRef: lab1.ID})
+
+    csv := "email,room_name,role\n" +
+        "budi@school.test,Lab 2,\n" + // row 2: move
+        "cici@school.test,Lab 1,\n" + // row 3: create
+        "ani@school.test,Lab 1,\n" + // row 4: unchanged
+        "dewi@school.test,Lab 1,pengawas\n" + // row 5: create
+        "x\"y@school.test,Lab 1,\n" + // row 6: unreadable
+        "ghost@school.test,Lab 1,\n" // row 7: unknown user
+
+    checkErrors := func(res assignmentImportResult) {
+        t.Helper()
+        if len(res.Errors) != 2 || res.Errors[0].Row != 6 || res.Errors[1].Row != 7 || res.Errors[1].Error != "user not found" {
+            t.Fatalf("errors = %+v, want the unreadable row 6 and the unknown user in row 7", res.Errors)
+        }
+        if res.Summary["total_rows"] != 6 {
+            t.Fatalf("total_rows = %d, want 6", res.Summary["total_rows"])
+        }
+    }
+    actions := func(res assignmentImportResult) map[string]string {
+        out := map[string]string{}
+        for _, ch := range res.Changes {
+            out[ch.UserID] = ch.Action
+        }
+        return out
+    }
+
+    merge := runAssignmentImport(t, ac, csv, nil)
+    checkErrors(merge)
+    if !merge.DryRun || merge.Summary["created"] != 2 || merge.Summary["moved"] != 1 || merge.Summary["removed"] != 0 || merge.Summary["unchanged"] != 1 {
+        t.Fatalf("merge summary = %v", merge.Summary)
+    }
+    if a := actions(merge); a[budi.ID] != "move" || a[cici.ID] != "create" || a[dewi.ID] != "create" {
+        t.Fatalf("merge changes = %+v", merge.Changes)
+    }
+
+    // replace also drops guru, who is not listed for Lab 1
+    replace := runAssignmentImport(t, ac, csv, map[string]string{"mode": "replace"})
+    checkErrors(replace)
+    if replace.Summary["created"] != 2 || replace.Summary["moved"] != 1 || replace.Summary["removed"] != 1 {
+        t.Fatalf("replace summary = %v", replace.Summary)
+    }
+    if a := actions(replace); a[guru.ID] != "remove" {
+        t.Fatalf("replace changes = %+v, want guru removed", replace.Changes)
+    }
+
+    // dry runs wrote nothing
+    if n := countRows(t, db, "room_students", "user_id_ref = ? AND room_id_ref = ?", budi.ID, lab1.ID); n != 1 {
+        t.Fatal("a dry run moved budi")
+    }
+
+    applied := runAssignmentImport(t, ac, csv, map[string]string{"mode": "replace", "apply": "true"})
+    if applied.DryRun {
+        t.Fatal("apply=true reported a dry run")
+    }
+    for _, c := range []struct {
+        table, user, room string
+        want              int64
+    }{
+        {"room_students", budi.ID, lab1.ID, 0},
+        {"room_students", budi.ID, lab2.ID, 1},
+        {"room_students", cici.ID, lab1.ID, 1},
+        {"room_students", ani.ID, lab1.ID, 1},
+        {"room_supervisors", dewi.ID, lab1.ID, 1},
+        {"room_supervisors", guru.ID, lab1.ID, 0},
+    } {
+        if n := countRows(t, db, c.table, "user_id_ref = ? AND room_id_ref = ? AND deleted_at IS NULL", c.user, c.room); n != c.want {
+            t.Fatalf("%s %s/%s: %d rows, want %d", c.table, c.user, c.room, n, c.want)
+        }
+    }
+}
@@ -3,9 +3,13 @@ package controllers
 import (
     "errors"
     "fmt"
+    "log"
+    "math"
     "net/http"
+    "strconv"
     "strings"
     "time"
+    "unicode/utf8"
 
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
@@ -16,6 +20,7 @@ import (
     "github.com/zaqqye/seb_backend_v1/internal/middleware"
     "github.com/zaqqye/seb_backend_v1/internal/models"
     "github.com/zaqqye/seb_backend_v1/internal/utils"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
 )
 
 type AuthController struct {
@@ -25,23 +30,35 @@ type AuthController struct {
     AccessTTL   time.Duration
     RefreshTTL  time.Duration
     Cfg        *config.Config
+    Hubs       *ws.Hubs
+    // Keys signs access/refresh tokens; the secrets above remain the HS256 fallback
+    Keys       *utils.KeySet
+    Throttle   *LoginThrottle
 }
 
 type registerRequest struct {
     FullName string         `json:"full_name" binding:"required"`
-    Email    string         `json:"email" binding:"required,email"`
+    Email    string         `json:"email" binding:"omitempty,email"` // optional for siswa with a username
+    Username string         `json:"username"`                         // login name, usually the NIS for siswa
     Password FlexibleString `json:"password" binding:"required"`
     Kelas    FlexibleString `json:"kelas"`
-    Jurusan  string         `json:"jurusan"`
-    Role     string         `json:"role"`   // admin-only endpoint will validate
+    Jurusan  string         `json:"jurusan"`  // major code or name
+    MajorID  string         `json:"major_id"` // takes precedence over jurusan
+    Role     string         `json:"role"`     // admin-only endpoint will validate
     Active   *bool          `json:"active"` // optional, defaults to true
 }
 
 type loginRequest struct {
-    Email      string `json:"email" binding:"required,email"`
+    // Either email or username (NIS); an email value without '@' is treated as a username
+    Email      string `json:"email"`
+    Username   string `json:"username"`
     Password   string `json:"password" binding:"required"`
     Platform   string `json:"platform" binding:"required"`
     AppVersion string `json:"app_version" binding:"required"`
+    // Optional device details; device_id is required for siswa when device binding is enforced
+    DeviceID    string `json:"device_id"`
+    DeviceModel string `json:"device_model"`
+    OSVersion   string `json:"os_version"`
 }
 
 func (a *AuthController) Register(c *gin.Context) {
@@ -55,16 +72,6 @@ func (a *AuthController) Register(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
         return
     }
-    if len(rawPassword) < 6 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "password must be at least 6 characters"})
-        return
-    }
-
-    pw, err := utils.HashPassword(rawPassword)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
-        return
-    }
 
     // Determine role (default to siswa if not provided)
     role := req.Role
@@ -75,6 +82,32 @@ func (a *AuthController) Register(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
         return
     }
+    email := strings.TrimSpace(req.Email)
+    username := normalizeUsername(req.Username)
+    if err := checkUserIdentifiers(a.DB, role, email, username, ""); err != nil {
+        c.JSON(identifierErrorStatus(err), gin.H{"error": err.Error()})
+        return
+    }
+    policy, err := passwordPolicy(a.DB, a.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if err := policy.Validate(rawPassword, email, username, req.FullName); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    pw, err := utils.HashPassword(rawPassword)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+        return
+    }
+
+    major, err := resolveMajor(a.DB, firstNonBlank(req.MajorID, req.Jurusan))
+    if err != nil {
+        c.JSON(majorErrorStatus(err), gin.H{"error": err.Error()})
+        return
+    }
 
     // Determine active flag (default true)
     active := true
@@ -84,13 +117,16 @@ func (a *AuthController) Register(c *gin.Context) {
 
     user := models.User{
         FullName: req.FullName,
-        Email:    req.Email,
+        Email:    email,
+        Username: username,
         Password: pw,
         Role:     role,
         Kelas:    req.Kelas.String(),
-        Jurusan:  req.Jurusan,
         Active:   active,
+        // Registration is admin-only, so the password is admin-chosen
+        MustChangePassword: true,
     }
+    setUserMajor(&user, major)
 
     if err := a.DB.Create(&user).Error; err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -101,6 +137,7 @@ func (a *AuthController) Register(c *gin.Context) {
         "message":   "registered",
         "user_id":   user.ID,
         "email":     user.Email,
+        "username":  user.Username,
         "full_name": user.FullName,
         "role":      user.Role,
     })
@@ -117,18 +154,100 @@ func (a *AuthController) Login(c *gin.Context) {
         return
     }
 
-    var user models.User
-    if err := a.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+    identifier := strings.TrimSpace(req.Username)
+    if identifier == "" {
+        identifier = strings.TrimSpace(req.Email)
+    }
+    if identifier == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "email or username is required"})
+        return
+    }
+    if utf8.RuneCountInString(strings.TrimSpace(req.DeviceID)) > maxDeviceIDLength {
+        c.JSON(http.StatusBadRequest, gin.H{"error": errDeviceIDTooLong.Error()})
+        return
+    }
+
+    // the user is resolved before the throttle check so the account counter is keyed by
+    // user id, whichever identifier is used; unknown identifiers are keyed by themselves
+    var known *models.User
+    user, err := findUserByIdentifier(a.DB, identifier)
+    if err == nil {
+        known = &user
+    }
+    account := accountThrottleSubject(identifier, known)
+
+    now := time.Now().UTC()
+    if a.Throttle != nil {
+        wait, err := a.Throttle.Check(account, c.ClientIP(), now)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if wait > 0 {
+            retryAfter := int(math.Ceil(wait.Seconds()))
+            c.Header("Retry-After", strconv.Itoa(retryAfter))
+            c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts, try again later", "retry_after": retryAfter})
+            return
+        }
+    }
+
+    if known == nil {
+        a.loginFailed(c, account, nil, now)
         c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
         return
     }
 
     if !user.Active || !utils.CheckPassword(user.Password, req.Password) {
+        a.loginFailed(c, account, known, now)
         c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
         return
     }
+    if a.Throttle != nil {
+        if err := a.Throttle.Succeed(account); err != nil {
+            log.Printf("login throttle: reset %s: %v", account, err)
+        }
+    }
 
-    access, refresh, err := a.issueTokens(user)
+    mode, window, err := deviceBindingPolicy(a.DB, a.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    secondDevice, err := checkDeviceBinding(a.DB, mode, user, req.DeviceID)
+    var device *models.Device
+    if err == nil {
+        if device, err = recordDevice(a.DB, user, req); err == nil && !secondDevice {
+            secondDevice, err = bindDevice(a.DB, mode, window, user, device)
+        }
+    }
+    if secondDevice {
+        msg := "login from a second device"
+        if platform, model := strings.TrimSpace(req.Platform), strings.TrimSpace(req.DeviceModel); platform != "" || model != "" {
+            msg = fmt.Sprintf("login from a second device (%s %s)", strings.ToLower(platform), model)
+        }
+        go raiseStudentAlert(a.DB, a.Hubs, user, "second_device_login", msg)
+    }
+    if err != nil {
+        switch {
+        case errors.Is(err, errBoundToOtherDevice):
+            c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+        case errors.Is(err, errDeviceIDRequired):
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        default:
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        }
+        return
+    }
+
+    meta := sessionMeta{
+        Platform:  strings.ToLower(strings.TrimSpace(req.Platform)),
+        IPAddress: c.ClientIP(),
+        UserAgent: c.Request.UserAgent(),
+    }
+    if device != nil {
+        meta.DeviceIDRef = &device.ID
+    }
+    access, refresh, err := a.issueTokens(user, meta)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -140,20 +259,42 @@ func (a *AuthController) Login(c *gin.Context) {
         "role":         user.Role,
         "refresh_token": refresh.Token,
         "refresh_expires_in": int(a.RefreshTTL.Seconds()),
+        "must_change_password": user.MustChangePassword,
     })
 }
 
+// loginFailed counts a failed attempt against the account and client IP and raises
+// login_lockout alerts for keys that just got locked.
+func (a *AuthController) loginFailed(c *gin.Context, account string, user *models.User, now time.Time) {
+    if a.Throttle == nil {
+        return
+    }
+    locked, err := a.Throttle.Fail(account, c.ClientIP(), now)
+    if err != nil {
+        log.Printf("login throttle: record failure: %v", err)
+    }
+    for _, rec := range locked {
+        var owner *models.User
+        if rec.Kind == throttleKindAccount {
+            owner = user
+        }
+        go raiseLockoutAlert(a.DB, a.Hubs, rec, owner)
+    }
+}
+
 func (a *AuthController) Me(c *gin.Context) {
     uVal, _ := c.Get("user")
     user := uVal.(models.User)
     c.JSON(http.StatusOK, gin.H{
         "user_id":   user.ID,
         "email":     user.Email,
+        "username":  user.Username,
         "full_name": user.FullName,
         "role":      user.Role,
         "kelas":     user.Kelas,
         "jurusan":   user.Jurusan,
         "active":    user.Active,
+        "must_change_password": user.MustChangePassword,
         "created_at": user.CreatedAt,
         "updated_at": user.UpdatedAt,
     })
@@ -164,14 +305,39 @@ type tokenPair struct {
     JTI   string
 }
 
-func (a *AuthController) issueTokens(user models.User) (access tokenPair, refresh tokenPair, err error) {
+// sessionMeta describes the client session a refresh token belongs to.
+// An empty SessionID starts a new session.
+type sessionMeta struct {
+    SessionID   string
+    StartedAt   *time.Time
+    Platform    string
+    DeviceIDRef *string
+    IPAddress   string
+    UserAgent   string
+}
+
+func (a *AuthController) issueTokens(user models.User, meta sessionMeta) (access tokenPair, refresh tokenPair, err error) {
+    return a.issueTokensTx(a.DB, user, meta)
+}
+
+// issueTokensTx is issueTokens persisting the refresh token through tx.
+func (a *AuthController) issueTokensTx(tx *gorm.DB, user models.User, meta sessionMeta) (access tokenPair, refresh tokenPair, err error) {
     now := time.Now().UTC()
     sub := user.ID
+    if meta.SessionID == "" {
+        meta.SessionID = uuid.NewString()
+    }
+    if meta.StartedAt == nil {
+        meta.StartedAt = &now
+    }
     // Access token
     acl := middleware.Claims{
-        UserID: user.ID,
-        Role:   user.Role,
-        Email:  user.Email,
+        Type:      middleware.TokenTypeAccess,
+        UserID:    user.ID,
+        Role:      user.Role,
+        Email:     user.Email,
+        SessionID: meta.SessionID,
+        TokenVersion: user.TokenVersion,
         RegisteredClaims: jwt.RegisteredClaims{
             Issuer:    "seb_backend_v1",
             IssuedAt:  jwt.NewNumericDate(now),
@@ -179,33 +345,43 @@ func (a *AuthController) issueTokens(user models.User) (access tokenPair, refres
             Subject:   sub,
         },
     }
-    at := jwt.NewWithClaims(jwt.SigningMethodHS256, acl)
-    atStr, err := at.SignedString([]byte(a.AccessSecret))
+    if strings.HasPrefix(meta.Platform, oidcPlatformPrefix) {
+        acl.AuthMethod = middleware.AuthMethodOIDC
+    }
+    atStr, err := a.Keys.Sign(acl, a.AccessSecret)
     if err != nil { return }
     access = tokenPair{Token: atStr}
 
     // Refresh token with JTI
     jti := uuid.NewString()
-    rcl := jwt.RegisteredClaims{
-        Issuer:    "seb_backend_v1",
-        IssuedAt:  jwt.NewNumericDate(now),
-        ExpiresAt: jwt.NewNumericDate(now.Add(a.RefreshTTL)),
-        Subject:   sub,
-        ID:        jti,
-    }
-    rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rcl)
-    rtStr, err := rt.SignedString([]byte(a.RefreshSecret))
+    rcl := refreshClaims{
+        Type: middleware.TokenTypeRefresh,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Issuer:    "seb_backend_v1",
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(a.RefreshTTL)),
+            Subject:   sub,
+            ID:        jti,
+        },
+    }
+    rtStr, err := a.Keys.Sign(rcl, a.RefreshSecret)
     if err != nil { return }
     refresh = tokenPair{Token: rtStr, JTI: jti}
 
     // Persist hashed refresh token
     rec := models.RefreshToken{
-        TokenID:   jti,
-        UserIDRef: user.ID,
-        TokenHash: utils.SHA256Hex(rtStr),
-        ExpiresAt: now.Add(a.RefreshTTL),
-    }
-    if err = a.DB.Create(&rec).Error; err != nil { return }
+        TokenID:          jti,
+        UserIDRef:        user.ID,
+        TokenHash:        utils.SHA256Hex(rtStr),
+        ExpiresAt:        now.Add(a.RefreshTTL),
+        SessionID:        meta.SessionID,
+        SessionStartedAt: meta.StartedAt,
+        Platform:         meta.Platform,
+        DeviceIDRef:      meta.DeviceIDRef,
+        IPAddress:        meta.IPAddress,
+        UserAgent:        truncate(meta.UserAgent, 255),
+    }
+    if err = tx.Create(&rec).Error; err != nil { return }
     return
 }
 
@@ -257,10 +433,24 @@ func (a *AuthController) fallbackVersion(platform string) string {
     }
 }
 
+// refreshClaims are the claims of a refresh token; the session is looked up from the
+// persisted record.
+type refreshClaims struct {
+    Type string `json:"typ"`
+    jwt.RegisteredClaims
+}
+
 type refreshRequest struct {
     RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// refreshReuseGrace is how long a rotated refresh token may be presented again before
+// the replay is treated as theft, so a client retrying after a lost response keeps its
+// session instead of having the whole family revoked.
+const refreshReuseGrace = 10 * time.Second
+
+var errRefreshRotated = errors.New("refresh token already rotated")
+
 func (a *AuthController) Refresh(c *gin.Context) {
     var req refreshRequest
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -268,10 +458,9 @@ func (a *AuthController) Refresh(c *gin.Context) {
         return
     }
     // Parse refresh token
-    tok, err := jwt.ParseWithClaims(req.RefreshToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-        return []byte(a.RefreshSecret), nil
-    })
-    if err != nil || !tok.Valid {
+    rcl := &refreshClaims{}
+    tok, err := jwt.ParseWithClaims(req.RefreshToken, rcl, a.Keys.Keyfunc(a.RefreshSecret))
+    if err != nil || !tok.Valid || !middleware.IsTokenType(tok, rcl.Type, middleware.TokenTypeRefresh) {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
         return
     }
@@ -282,27 +471,73 @@ func (a *AuthController) Refresh(c *gin.Context) {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token not found"})
         return
     }
-    if rec.RevokedAt != nil || time.Now().UTC().After(rec.ExpiresAt) {
+    now := time.Now().UTC()
+    if rec.RevokedAt != nil && rec.ReplacedByTokenID != nil {
+        // A client retrying right after a rotation whose response it lost continues
+        // from the replacement, as long as that one was not used yet
+        if now.Sub(*rec.RevokedAt) <= refreshReuseGrace {
+            var next models.RefreshToken
+            if err := a.DB.Where("token_id = ? AND user_id_ref = ? AND revoked_at IS NULL", *rec.ReplacedByTokenID, rec.UserIDRef).First(&next).Error; err == nil {
+                rec = next
+            }
+        }
+        if rec.RevokedAt != nil {
+            // An already-rotated token is being replayed: assume it was stolen
+            a.handleRefreshReuse(rec)
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected"})
+            return
+        }
+    }
+    if rec.RevokedAt != nil || now.After(rec.ExpiresAt) {
         c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired or revoked"})
         return
     }
     var user models.User
-    if err := a.DB.Where("id = ?", rec.UserIDRef).First(&user).Error; err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+    if err := a.DB.Where("id = ? AND active = ?", rec.UserIDRef, true).First(&user).Error; err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found or inactive"})
         return
     }
-    // Rotate refresh token
-    access, newRefresh, err := a.issueTokens(user)
+    // Rotate refresh token, keeping the session (pre-session tokens adopt their own id)
+    meta := sessionMeta{
+        SessionID:   rec.SessionID,
+        StartedAt:   rec.SessionStartedAt,
+        Platform:    rec.Platform,
+        DeviceIDRef: rec.DeviceIDRef,
+        IPAddress:   c.ClientIP(),
+        UserAgent:   c.Request.UserAgent(),
+    }
+    if meta.SessionID == "" {
+        meta.SessionID = rec.ID
+        meta.StartedAt = &rec.CreatedAt
+    }
+    // Revoke, replace and link in one transaction: a failure keeps the old token usable
+    // and a rotated token always records its replacement for reuse detection
+    var access, newRefresh tokenPair
+    err = a.DB.Transaction(func(tx *gorm.DB) error {
+        // Revoke old first so two concurrent refreshes cannot both rotate the same token
+        res := tx.Model(&models.RefreshToken{}).
+            Where("id = ? AND revoked_at IS NULL", rec.ID).
+            Update("revoked_at", &now)
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            return errRefreshRotated
+        }
+        var err error
+        if access, newRefresh, err = a.issueTokensTx(tx, user, meta); err != nil {
+            return err
+        }
+        return tx.Model(&models.RefreshToken{}).Where("id = ?", rec.ID).Update("replaced_by_token_id", newRefresh.JTI).Error
+    })
     if err != nil {
+        if errors.Is(err, errRefreshRotated) {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token expired or revoked"})
+            return
+        }
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
-    // Revoke old
-    now := time.Now().UTC()
-    a.DB.Model(&rec).Updates(map[string]interface{}{
-        "revoked_at":         &now,
-        "replaced_by_token_id": newRefresh.JTI,
-    })
     c.JSON(http.StatusOK, gin.H{
         "access_token": access.Token,
         "token_type":   "Bearer",
@@ -312,12 +547,161 @@ func (a *AuthController) Refresh(c *gin.Context) {
     })
 }
 
+// handleRefreshReuse revokes the token family of a replayed refresh token, force-logs
+// the user out everywhere and records a security alert.
+func (a *AuthController) handleRefreshReuse(rec models.RefreshToken) {
+    revoked, err := revokeTokenFamily(a.DB, rec)
+    if err != nil {
+        log.Printf("refresh reuse: revoke family of %s: %v", rec.TokenID, err)
+    }
+    // Bumping the token version drops every access token already issued to the user
+    if err := a.DB.Model(&models.User{}).Where("id = ?", rec.UserIDRef).
+        UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+        log.Printf("refresh reuse: bump token version of %s: %v", rec.UserIDRef, err)
+    }
+
+    var user models.User
+    if err := a.DB.Where("id = ?", rec.UserIDRef).First(&user).Error; err != nil {
+        log.Printf("refresh reuse: load user %s: %v", rec.UserIDRef, err)
+        return
+    }
+    if user.Role == "siswa" {
+        // Mirror pengawas force-logout so the exam app drops the session right away
+        now := time.Now().UTC()
+        if _, err := updateStudentStatus(a.DB, a.Hubs, user.ID, func(st *models.StudentStatus) error {
+            st.ForceLogoutAt = &now
+            st.Locked = false
+            return nil
+        }); err != nil {
+            log.Printf("refresh reuse: force logout %s: %v", user.ID, err)
+        }
+        go broadcastStudentStatus(a.DB, a.Hubs, user.ID)
+    }
+    msg := fmt.Sprintf("revoked refresh token %s was reused; %d tokens of the session revoked", rec.TokenID, revoked)
+    go raiseStudentAlert(a.DB, a.Hubs, user, "refresh_token_reuse", msg)
+}
+
+// revokeTokenFamily revokes rec and every token rotated from it, following the
+// ReplacedByTokenID chain as well as the shared SessionID.
+func revokeTokenFamily(db *gorm.DB, rec models.RefreshToken) (int64, error) {
+    ids := []string{rec.ID}
+    seen := map[string]struct{}{rec.TokenID: {}}
+    next := rec.ReplacedByTokenID
+    for next != nil && *next != "" {
+        if _, ok := seen[*next]; ok {
+            break
+        }
+        seen[*next] = struct{}{}
+        var child models.RefreshToken
+        if err := db.Where("token_id = ? AND user_id_ref = ?", *next, rec.UserIDRef).First(&child).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                break
+            }
+            return 0, err
+        }
+        ids = append(ids, child.ID)
+        next = child.ReplacedByTokenID
+    }
+
+    q := db.Model(&models.RefreshToken{}).Where("user_id_ref = ? AND revoked_at IS NULL", rec.UserIDRef)
+    if rec.SessionID != "" {
+        q = q.Where("id IN ? OR session_id = ?", ids, rec.SessionID)
+    } else {
+        q = q.Where("id IN ?", ids)
+    }
+    res := q.Update("revoked_at", time.Now().UTC())
+    return res.RowsAffected, res.Error
+}
+
+type changePasswordRequest struct {
+    CurrentPassword string `json:"current_password" binding:"required"`
+    NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword sets a user-chosen password that satisfies the password policy and
+// clears MustChangePassword. All existing tokens are invalidated; the current session
+// continues with the returned token pair.
+func (a *AuthController) ChangePassword(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    user := uVal.(models.User)
+    var req changePasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !utils.CheckPassword(user.Password, req.CurrentPassword) {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+        return
+    }
+    if req.NewPassword == req.CurrentPassword {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the current one"})
+        return
+    }
+    policy, err := passwordPolicy(a.DB, a.Cfg)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if err := policy.Validate(req.NewPassword, user.Email, user.Username, user.FullName); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    hashed, err := utils.HashPassword(req.NewPassword)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+        return
+    }
+
+    // Keep the current session's metadata for the replacement tokens
+    meta := sessionMeta{IPAddress: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+    if sid := c.GetString("session_id"); sid != "" {
+        var rec models.RefreshToken
+        if err := a.DB.Where("user_id_ref = ? AND session_id = ?", user.ID, sid).Order("created_at DESC").First(&rec).Error; err == nil {
+            meta.SessionID = rec.SessionID
+            meta.StartedAt = rec.SessionStartedAt
+            meta.Platform = rec.Platform
+            meta.DeviceIDRef = rec.DeviceIDRef
+        }
+    }
+
+    if err := a.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+            "password":             hashed,
+            "must_change_password": false,
+        }).Error; err != nil {
+            return err
+        }
+        return invalidateUserTokens(tx, user.ID)
+    }); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if err := a.DB.Where("id = ?", user.ID).First(&user).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    access, refresh, err := a.issueTokens(user, meta)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "message":            "password changed",
+        "access_token":       access.Token,
+        "token_type":         "Bearer",
+        "expires_in":         int(a.AccessTTL.Seconds()),
+        "refresh_token":      refresh.Token,
+        "refresh_expires_in": int(a.RefreshTTL.Seconds()),
+    })
+}
+
 type logoutRequest struct {
     RefreshToken string `json:"refresh_token"`
     All          bool   `json:"all"`
 }
 
-// Logout endpoint now revokes refresh tokens (specific or all). Access token remains valid until expiry.
+// Logout endpoint revokes refresh tokens (specific or all). With all=true every access token
+// of the user is invalidated as well via the token version; otherwise it remains valid until expiry.
 func (a *AuthController) Logout(c *gin.Context) {
     var req logoutRequest
     _ = c.ShouldBindJSON(&req)
@@ -333,9 +717,37 @@ func (a *AuthController) Logout(c *gin.Context) {
         // Revoke all refresh tokens for current user
         if uVal, ok := c.Get("user"); ok {
             user := uVal.(models.User)
-            now := time.Now().UTC()
-            a.DB.Model(&models.RefreshToken{}).Where("user_id_ref = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", &now)
+            if err := invalidateUserTokens(a.DB, user.ID); err != nil {
+                c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+                return
+            }
         }
     }
     c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 }
+
+// truncate cuts s to at most max bytes for varchar columns.
+func truncate(s string, max int) string {
+    if len(s) <= max {
+        return s
+    }
+    // Cut on a rune boundary so the result stays valid UTF-8
+    for max > 0 && !utf8.RuneStart(s[max]) {
+        max--
+    }
+    return strings.ToValidUTF8(s[:max], "")
+}
+
+// invalidateUserTokens revokes every refresh token of the user and bumps the token
+// version so already-issued access tokens are rejected by AuthMiddleware.
+func invalidateUserTokens(db *gorm.DB, userID string) error {
+    return db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&models.RefreshToken{}).
+            Where("user_id_ref = ? AND revoked_at IS NULL", userID).
+            Update("revoked_at", time.Now().UTC()).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.User{}).Where("id = ?", userID).
+            UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+    })
+}
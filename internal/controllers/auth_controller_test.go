@@ -0,0 +1,216 @@
+package controllers
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/json"
+    "encoding/pem"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/middleware"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+// probe sends a GET to path through AuthMiddleware with the bearer token.
+func probe(db *gorm.DB, cfg middleware.AuthConfig, path, token string) *httptest.ResponseRecorder {
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.GET(path, middleware.AuthMiddleware(db, cfg), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+    req := httptest.NewRequest(http.MethodGet, path, nil)
+    req.Header.Set("Authorization", "Bearer "+token)
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    return w
+}
+
+func TestRevokedTokenVersionIsRejected(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    a := newTestAuthController(db)
+    cfg := middleware.AuthConfig{JWTSecret: a.AccessSecret}
+
+    access, _ := loginTokens(t, a, guru.Email, "rahasia123")
+    if w := probe(db, cfg, "/api/v1/probe", access); w.Code != http.StatusNoContent {
+        t.Fatalf("fresh token: %d %s", w.Code, w.Body.String())
+    }
+    if err := invalidateUserTokens(db, guru.ID); err != nil {
+        t.Fatal(err)
+    }
+    w := probe(db, cfg, "/api/v1/probe", access)
+    if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "session revoked") {
+        t.Fatalf("token of a bumped version: %d %s, want 401 session revoked", w.Code, w.Body.String())
+    }
+    access, _ = loginTokens(t, a, guru.Email, "rahasia123")
+    if w := probe(db, cfg, "/api/v1/probe", access); w.Code != http.StatusNoContent {
+        t.Fatalf("token issued after the bump: %d %s", w.Code, w.Body.String())
+    }
+}
+
+// rotated refreshes with refresh and returns the new refresh token.
+func rotated(t *testing.T, a *AuthController, refresh string) string {
+    t.Helper()
+    w := refreshWith(t, a, refresh)
+    if w.Code != http.StatusOK {
+        t.Fatalf("refresh: %d %s", w.Code, w.Body.String())
+    }
+    var body struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    return body.RefreshToken
+}
+
+func TestRefreshReuseRevokesTheFamily(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    a := newTestAuthController(db)
+    cfg := middleware.AuthConfig{JWTSecret: a.AccessSecret}
+
+    access, r0 := loginTokens(t, a, guru.Email, "rahasia123")
+    _, otherSession := loginTokens(t, a, guru.Email, "rahasia123")
+    r1 := rotated(t, a, r0)
+
+    // A retry within the grace window continues from the unused replacement
+    r2 := rotated(t, a, r0)
+    if r2 == r1 {
+        t.Fatal("grace replay returned the already issued token")
+    }
+
+    // Past the grace window the same replay is treated as theft
+    past := time.Now().UTC().Add(-2 * refreshReuseGrace)
+    if err := db.Model(&models.RefreshToken{}).
+        Where("token_hash IN ?", []string{utils.SHA256Hex(r0), utils.SHA256Hex(r1)}).
+        Update("revoked_at", past).Error; err != nil {
+        t.Fatal(err)
+    }
+    w := refreshWith(t, a, r0)
+    if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "reuse detected") {
+        t.Fatalf("replay after the grace window: %d %s, want reuse detected", w.Code, w.Body.String())
+    }
+    if w := refreshWith(t, a, r2); w.Code != http.StatusUnauthorized {
+        t.Fatalf("newest token of the family still usable: %d %s", w.Code, w.Body.String())
+    }
+    if w := probe(db, cfg, "/api/v1/probe", access); w.Code != http.StatusUnauthorized {
+        t.Fatalf("access token survived the reuse: %d", w.Code)
+    }
+    // Other sessions keep their refresh tokens
+    if w := refreshWith(t, a, otherSession); w.Code != http.StatusOK {
+        t.Fatalf("other session: %d %s", w.Code, w.Body.String())
+    }
+
+    // The alert is stored asynchronously
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        var n int64
+        db.Model(&models.Alert{}).Where("type = ? AND user_id_ref = ?", "refresh_token_reuse", guru.ID).Count(&n)
+        if n == 1 {
+            break
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%d refresh_token_reuse alerts, want 1", n)
+        }
+        time.Sleep(20 * time.Millisecond)
+    }
+}
+
+// testKeySet writes a fresh RSA key and loads it as the only signing key "k1".
+func testKeySet(t *testing.T, allowHMAC bool) *utils.KeySet {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    der, err := x509.MarshalPKCS8PrivateKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(t.TempDir(), "k1.pem")
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+        t.Fatal(err)
+    }
+    keys, err := utils.LoadKeySet("k1:"+path, allowHMAC)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return keys
+}
+
+func TestTokensWithoutTypClaim(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    a := newTestAuthController(db)
+    a.Keys = testKeySet(t, true)
+    cfg := middleware.AuthConfig{JWTSecret: a.AccessSecret, Keys: a.Keys}
+    now := time.Now()
+
+    // Issued before kinds existed: HS256, no typ, no tv
+    legacyAccess, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+        "user_id": guru.ID,
+        "role":    guru.Role,
+        "email":   guru.Email,
+        "iat":     now.Unix(),
+        "exp":     now.Add(time.Hour).Unix(),
+    }).SignedString([]byte(a.AccessSecret))
+    if err != nil {
+        t.Fatal(err)
+    }
+    jti := uuid.NewString()
+    legacyRefresh, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+        Subject:   guru.ID,
+        ID:        jti,
+        IssuedAt:  jwt.NewNumericDate(now),
+        ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+    }).SignedString([]byte(a.RefreshSecret))
+    if err != nil {
+        t.Fatal(err)
+    }
+    mustCreate(t, db, &models.RefreshToken{TokenID: jti, UserIDRef: guru.ID, TokenHash: utils.SHA256Hex(legacyRefresh), ExpiresAt: now.Add(time.Hour)})
+
+    if w := probe(db, cfg, "/api/v1/probe", legacyAccess); w.Code != http.StatusNoContent {
+        t.Fatalf("legacy access token during migration: %d %s", w.Code, w.Body.String())
+    }
+    if w := refreshWith(t, a, legacyAccess); w.Code != http.StatusUnauthorized {
+        t.Fatalf("legacy access token accepted as refresh token: %d", w.Code)
+    }
+    if w := refreshWith(t, a, legacyRefresh); w.Code != http.StatusOK {
+        t.Fatalf("legacy refresh token during migration: %d %s", w.Code, w.Body.String())
+    }
+
+    // Once HS256 is switched off legacy tokens are gone
+    strict := middleware.AuthConfig{JWTSecret: a.AccessSecret, Keys: testKeySet(t, false)}
+    if w := probe(db, strict, "/api/v1/probe", legacyAccess); w.Code != http.StatusUnauthorized {
+        t.Fatalf("legacy access token without HS256: %d", w.Code)
+    }
+
+    // Tokens signed by a kid-identified key must say what they are
+    untyped, err := a.Keys.Sign(middleware.Claims{
+        UserID:           guru.ID,
+        Role:             guru.Role,
+        RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))},
+    }, a.AccessSecret)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if w := probe(db, cfg, "/api/v1/probe", untyped); w.Code != http.StatusUnauthorized {
+        t.Fatalf("kid-signed token without typ: %d", w.Code)
+    }
+    _, refresh := loginTokens(t, a, guru.Email, "rahasia123")
+    if w := probe(db, cfg, "/api/v1/probe", refresh); w.Code != http.StatusUnauthorized {
+        t.Fatalf("refresh token accepted as access token: %d", w.Code)
+    }
+}
@@ -3,6 +3,7 @@ package controllers
 import (
 	"errors"
 	"log"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -10,6 +11,9 @@ import (
 	"github.com/zaqqye/seb_backend_v1/internal/ws"
 )
 
+// broadcastStudentStatus pushes the current status of a student to the monitoring
+// dashboards and to the student's own connections. It only reads; status writes go
+// through updateStudentStatus.
 func broadcastStudentStatus(db *gorm.DB, hubs *ws.Hubs, studentID string) {
 	if hubs == nil {
 		return
@@ -28,19 +32,28 @@ func broadcastStudentStatus(db *gorm.DB, hubs *ws.Hubs, studentID string) {
 		}
 		return
 	}
-	var room models.RoomStudent
 	var roomIDPtr *string
 	var roomIDValue string
 	roomBlock := ws.MonitoringRoom{}
-	if err := db.Where("user_id_ref = ?", studentID).First(&room).Error; err == nil {
+	if room, err := studentRoom(db, studentID); err != nil {
+		log.Printf("monitoring broadcast room: %v", err)
+	} else if room != nil {
 		roomIDValue = room.RoomIDRef
 		roomIDPtr = &roomIDValue
 		roomBlock.ID = room.RoomIDRef
+		roomBlock.SeatRow, roomBlock.SeatColumn = room.SeatRow, room.SeatColumn
 		var roomModel models.Room
 		if err := db.Select("name").Where("id = ?", room.RoomIDRef).First(&roomModel).Error; err == nil {
 			roomBlock.RoomName = roomModel.Name
 		}
 	}
+	var quiz *ws.MonitoringQuiz
+	if attempts, err := currentQuizAttempts(db, []string{studentID}); err != nil {
+		log.Printf("monitoring broadcast quiz: %v", err)
+	} else {
+		attempt, ok := attempts[studentID]
+		quiz = quizSnapshot(attempt, ok, time.Now().UTC())
+	}
 	updatedAt := st.UpdatedAt
 	payload := ws.MonitoringPayload{
 		ID:              studentID,
@@ -56,14 +69,17 @@ func broadcastStudentStatus(db *gorm.DB, hubs *ws.Hubs, studentID string) {
 		ForceLogoutAt:   st.ForceLogoutAt,
 		LastAppVersion:  st.AppVersion,
 		Monitoring: ws.MonitoringSnapshot{
-			ID:              st.ID,
-			AppVersion:      st.AppVersion,
-			Locked:          st.Locked,
-			BlockedFromExam: st.BlockedFromExam,
-			ForceLogoutAt:   st.ForceLogoutAt,
-			UpdatedAt:       &updatedAt,
+			ID:                   st.ID,
+			AppVersion:           st.AppVersion,
+			Locked:               st.Locked,
+			BlockedFromExam:      st.BlockedFromExam,
+			ForceLogoutAt:        st.ForceLogoutAt,
+			UpdatedAt:            &updatedAt,
+			UnauthorizedUnlock:   st.UnauthorizedUnlock,
+			UnauthorizedUnlockAt: st.UnauthorizedUnlockAt,
 		},
 		Room: roomBlock,
+		Quiz: quiz,
 	}
 	if hubs.Monitoring != nil {
 		hubs.Monitoring.Broadcast(payload)
@@ -0,0 +1,422 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/jackc/pgx/v5/pgconn"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+type ClassController struct {
+    DB *gorm.DB
+}
+
+var academicYearPattern = regexp.MustCompile(`^\d{4}/\d{4}$`)
+
+type createClassRequest struct {
+    Name              string `json:"name" binding:"required"`
+    GradeLevel        int    `json:"grade_level"`
+    MajorID           string `json:"major_id"` // major id, code or name
+    AcademicYear      string `json:"academic_year"`
+    HomeroomTeacherID string `json:"homeroom_teacher_id"`
+}
+
+type updateClassRequest struct {
+    Name              *string `json:"name"`
+    GradeLevel        *int    `json:"grade_level"`
+    MajorID           *string `json:"major_id"` // "" clears
+    AcademicYear      *string `json:"academic_year"`
+    HomeroomTeacherID *string `json:"homeroom_teacher_id"` // "" clears
+}
+
+type classStudentsRequest struct {
+    UserIDs []string `json:"user_ids" binding:"required"`
+}
+
+// validateClass checks the fields shared by create and update and resolves the
+// major and homeroom teacher references.
+func (cc *ClassController) validateClass(cl *models.Class, majorValue, teacherID *string) (int, error) {
+    cl.Name = strings.TrimSpace(cl.Name)
+    cl.AcademicYear = strings.TrimSpace(cl.AcademicYear)
+    if cl.Name == "" {
+        return http.StatusBadRequest, errors.New("name is required")
+    }
+    if cl.GradeLevel < 0 || cl.GradeLevel > 13 {
+        return http.StatusBadRequest, errors.New("grade_level must be between 0 and 13")
+    }
+    if cl.AcademicYear != "" && !academicYearPattern.MatchString(cl.AcademicYear) {
+        return http.StatusBadRequest, errors.New("academic_year must look like 2025/2026")
+    }
+    if majorValue != nil {
+        major, err := resolveMajor(cc.DB, *majorValue)
+        if err != nil {
+            return majorErrorStatus(err), err
+        }
+        cl.MajorIDRef = nil
+        if major != nil {
+            cl.MajorIDRef = &major.ID
+        }
+    }
+    if teacherID != nil {
+        id := strings.TrimSpace(*teacherID)
+        cl.HomeroomTeacherIDRef = nil
+        if id != "" {
+            var teacher models.User
+            if err := cc.DB.Where("id = ?", id).First(&teacher).Error; err != nil {
+                return http.StatusBadRequest, errors.New("homeroom teacher not found")
+            }
+            if teacher.Role != "pengawas" && teacher.Role != "admin" {
+                return http.StatusBadRequest, errors.New("homeroom teacher must be pengawas or admin")
+            }
+            cl.HomeroomTeacherIDRef = &teacher.ID
+        }
+    }
+    return 0, nil
+}
+
+// classJSON renders a class with its major, homeroom teacher and student count.
+func (cc *ClassController) classJSON(cl models.Class) (gin.H, error) {
+    out := gin.H{
+        "id":               cl.ID,
+        "name":             cl.Name,
+        "grade_level":      cl.GradeLevel,
+        "academic_year":    cl.AcademicYear,
+        "major":            nil,
+        "homeroom_teacher": nil,
+        "created_at":       cl.CreatedAt,
+        "updated_at":       cl.UpdatedAt,
+    }
+    if cl.MajorIDRef != nil {
+        var m models.Major
+        if err := cc.DB.Where("id = ?", *cl.MajorIDRef).First(&m).Error; err == nil {
+            out["major"] = majorBlock(&m)
+        }
+    }
+    if cl.HomeroomTeacherIDRef != nil {
+        var t models.User
+        if err := cc.DB.Select("id", "full_name", "email").Where("id = ?", *cl.HomeroomTeacherIDRef).First(&t).Error; err == nil {
+            out["homeroom_teacher"] = gin.H{"id": t.ID, "full_name": t.FullName, "email": t.Email}
+        }
+    }
+    var students int64
+    if err := cc.DB.Model(&models.User{}).Where("class_id_ref = ?", cl.ID).Count(&students).Error; err != nil {
+        return nil, err
+    }
+    out["student_count"] = students
+    return out, nil
+}
+
+func (cc *ClassController) ListClasses(c *gin.Context) {
+    // Pagination/sort/filter: limit, page, all, sort_by, sort_dir, q, academic_year, grade_level, major_id
+    all := strings.EqualFold(c.Query("all"), "true") || c.Query("all") == "1"
+    limit := 50
+    page := 1
+    if v := c.Query("limit"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            limit = n
+        }
+    }
+    if v := c.Query("page"); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n > 0 {
+            page = n
+        }
+    }
+
+    sortBy := strings.ToLower(c.DefaultQuery("sort_by", "name"))
+    sortDir := strings.ToUpper(c.DefaultQuery("sort_dir", "ASC"))
+    if sortDir != "ASC" && sortDir != "DESC" {
+        sortDir = "ASC"
+    }
+    allowedSorts := map[string]string{
+        "created_at":    "created_at",
+        "name":          "name",
+        "grade_level":   "grade_level",
+        "academic_year": "academic_year",
+    }
+    sortCol, ok := allowedSorts[sortBy]
+    if !ok {
+        sortCol = "name"
+    }
+    order := fmt.Sprintf("%s %s", sortCol, sortDir)
+
+    qText := strings.TrimSpace(c.Query("q"))
+    year := strings.TrimSpace(c.Query("academic_year"))
+    grade := strings.TrimSpace(c.Query("grade_level"))
+    majorID := strings.TrimSpace(c.Query("major_id"))
+    applyFilters := func(q *gorm.DB) *gorm.DB {
+        if qText != "" {
+            q = q.Where("name ILIKE ?", "%"+qText+"%")
+        }
+        if year != "" {
+            q = q.Where("academic_year = ?", year)
+        }
+        if grade != "" {
+            q = q.Where("grade_level = ?", grade)
+        }
+        if majorID != "" {
+            q = q.Where("major_id_ref = ?", majorID)
+        }
+        return q
+    }
+
+    var total int64
+    if err := applyFilters(cc.DB.Model(&models.Class{})).Count(&total).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    listQ := applyFilters(cc.DB.Model(&models.Class{})).Order(order)
+    if !all {
+        listQ = listQ.Offset((page - 1) * limit).Limit(limit)
+    }
+    var classes []models.Class
+    if err := listQ.Find(&classes).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    out := make([]gin.H, 0, len(classes))
+    for _, cl := range classes {
+        row, err := cc.classJSON(cl)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        out = append(out, row)
+    }
+    meta := gin.H{"total": total, "all": all}
+    if !all {
+        meta["limit"] = limit
+        meta["page"] = page
+        meta["sort_by"] = sortCol
+        meta["sort_dir"] = sortDir
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out, "meta": meta})
+}
+
+func (cc *ClassController) CreateClass(c *gin.Context) {
+    var req createClassRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    cl := models.Class{Name: req.Name, GradeLevel: req.GradeLevel, AcademicYear: req.AcademicYear}
+    if status, err := cc.validateClass(&cl, &req.MajorID, &req.HomeroomTeacherID); err != nil {
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+    if err := cc.DB.Create(&cl).Error; err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            c.JSON(http.StatusConflict, gin.H{"error": "class name already exists in this academic year"})
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusCreated, gin.H{"message": "created", "id": cl.ID})
+}
+
+func (cc *ClassController) loadClass(c *gin.Context) (models.Class, bool) {
+    var cl models.Class
+    id := strings.TrimSpace(c.Param("id"))
+    if id == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return cl, false
+    }
+    if err := cc.DB.Where("id = ?", id).First(&cl).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "class not found"})
+        return cl, false
+    }
+    return cl, true
+}
+
+func (cc *ClassController) GetClass(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    out, err := cc.classJSON(cl)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, out)
+}
+
+func (cc *ClassController) UpdateClass(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    var req updateClassRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Name != nil {
+        cl.Name = *req.Name
+    }
+    if req.GradeLevel != nil {
+        cl.GradeLevel = *req.GradeLevel
+    }
+    if req.AcademicYear != nil {
+        cl.AcademicYear = *req.AcademicYear
+    }
+    if status, err := cc.validateClass(&cl, req.MajorID, req.HomeroomTeacherID); err != nil {
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+    if err := cc.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&cl).Error; err != nil {
+            return err
+        }
+        // Keep the kelas mirror of linked students in step with the name
+        return tx.Model(&models.User{}).Where("class_id_ref = ?", cl.ID).Update("kelas", cl.Name).Error
+    }); err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            c.JSON(http.StatusConflict, gin.H{"error": "class name already exists in this academic year"})
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "updated"})
+}
+
+// DeleteClass removes the class; its students are unlinked (kelas text is kept).
+func (cc *ClassController) DeleteClass(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    if err := cc.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&models.User{}).Where("class_id_ref = ?", cl.ID).Update("class_id_ref", nil).Error; err != nil {
+            return err
+        }
+        return tx.Where("id = ?", cl.ID).Delete(&models.Class{}).Error
+    }); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
+
+// ListStudents returns the siswa linked to the class.
+func (cc *ClassController) ListStudents(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    var users []models.User
+    if err := cc.DB.Where("class_id_ref = ?", cl.ID).Order("full_name ASC").Find(&users).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    out := make([]gin.H, 0, len(users))
+    for _, u := range users {
+        out = append(out, gin.H{
+            "id":        u.ID,
+            "full_name": u.FullName,
+            "email":     u.Email,
+            "username":  u.Username,
+            "kelas":     u.Kelas,
+            "jurusan":   u.Jurusan,
+            "active":    u.Active,
+        })
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out, "meta": gin.H{"total": len(out)}})
+}
+
+// AddStudents links siswa to the class (moving them from any previous class); kelas
+// and, when the class has one, the major are updated to match.
+func (cc *ClassController) AddStudents(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    var req classStudentsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    ids := make([]string, 0, len(req.UserIDs))
+    for _, id := range req.UserIDs {
+        if id = strings.TrimSpace(id); id != "" {
+            ids = append(ids, id)
+        }
+    }
+    if len(ids) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids is required"})
+        return
+    }
+    var users []models.User
+    if err := cc.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if len(users) != len(uniqueStrings(ids)) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "one or more users not found"})
+        return
+    }
+    for _, u := range users {
+        if u.Role != "siswa" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "user " + u.ID + " is not siswa"})
+            return
+        }
+    }
+    updates := map[string]interface{}{"class_id_ref": cl.ID, "kelas": cl.Name}
+    if cl.MajorIDRef != nil {
+        var m models.Major
+        if err := cc.DB.Where("id = ?", *cl.MajorIDRef).First(&m).Error; err == nil {
+            updates["major_id_ref"] = m.ID
+            updates["jurusan"] = m.Code
+        }
+    }
+    if err := cc.DB.Model(&models.User{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "assigned", "count": len(users)})
+}
+
+// RemoveStudent unlinks a siswa from the class and clears kelas.
+func (cc *ClassController) RemoveStudent(c *gin.Context) {
+    cl, ok := cc.loadClass(c)
+    if !ok {
+        return
+    }
+    userID := strings.TrimSpace(c.Param("user_id"))
+    res := cc.DB.Model(&models.User{}).Where("id = ? AND class_id_ref = ?", userID, cl.ID).
+        Updates(map[string]interface{}{"class_id_ref": nil, "kelas": ""})
+    if res.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+        return
+    }
+    if res.RowsAffected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "user is not in this class"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "unassigned"})
+}
+
+func uniqueStrings(vals []string) []string {
+    seen := make(map[string]struct{}, len(vals))
+    out := make([]string, 0, len(vals))
+    for _, v := range vals {
+        if _, ok := seen[v]; ok {
+            continue
+        }
+        seen[v] = struct{}{}
+        out = append(out, v)
+    }
+    return out
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+    "bytes"
+    "encoding/csv"
+    "io"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+)
+
+// csvUpload is a CSV file posted in the multipart field "file". headerIdx maps the
+// lower-cased header columns to their index; "nis" is an alias of "username".
+type csvUpload struct {
+    reader    *csv.Reader
+    header    []string
+    headerIdx map[string]int
+}
+
+// readCSVUpload reads the uploaded CSV and its header row. Comma or semicolon
+// delimiters, a UTF-8 BOM and CR/CRLF line endings are accepted. On failure it writes
+// a 400 response and returns false.
+func readCSVUpload(c *gin.Context) (*csvUpload, bool) {
+    // Limit max upload size (10MB) to avoid accidental huge files.
+    if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse form"})
+        return nil, false
+    }
+    file, fileHeader, err := c.Request.FormFile("file")
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+        return nil, false
+    }
+    defer file.Close()
+
+    if fileHeader == nil || fileHeader.Filename == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid file name"})
+        return nil, false
+    }
+    filename := strings.ToLower(strings.TrimSpace(fileHeader.Filename))
+    if !strings.HasSuffix(filename, ".csv") {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "only .csv files are allowed"})
+        return nil, false
+    }
+
+    data, err := io.ReadAll(file)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read file"})
+        return nil, false
+    }
+    if len(bytes.TrimSpace(data)) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
+        return nil, false
+    }
+
+    // Normalise line endings so files saved with only CR (Mac classic) or CRLF behave consistently.
+    data = bytes.ReplaceAll(data, []byte{'\r', '\n'}, []byte{'\n'})
+    data = bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\n'})
+
+    delimiter := ','
+    firstLineEnd := bytes.IndexByte(data, '\n')
+    if firstLineEnd == -1 {
+        firstLineEnd = len(data)
+    }
+    firstLine := data[:firstLineEnd]
+    firstLine = bytes.TrimPrefix(firstLine, []byte{0xEF, 0xBB, 0xBF})
+    if bytes.Contains(firstLine, []byte{';'}) && !bytes.Contains(firstLine, []byte{','}) {
+        delimiter = ';'
+    }
+
+    reader := csv.NewReader(bytes.NewReader(data))
+    reader.TrimLeadingSpace = true
+    reader.FieldsPerRecord = -1
+    if delimiter != ',' {
+        reader.Comma = delimiter
+    }
+
+    header, err := reader.Read()
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read header"})
+        return nil, false
+    }
+    cleanHeader := func(val string) string {
+        v := strings.TrimSpace(val)
+        for strings.HasPrefix(v, "\ufeff") {
+            v = strings.TrimPrefix(v, "\ufeff")
+        }
+        v = strings.Trim(v, "\"'")
+        return v
+    }
+    for i := range header {
+        header[i] = cleanHeader(header[i])
+    }
+
+    headerIdx := make(map[string]int, len(header))
+    for idx, col := range header {
+        key := strings.ToLower(strings.TrimSpace(col))
+        if key != "" {
+            headerIdx[key] = idx
+        }
+    }
+    if _, ok := headerIdx["username"]; !ok {
+        // Schools usually export the student number as "nis"
+        if idx, ok := headerIdx["nis"]; ok {
+            headerIdx["username"] = idx
+        }
+    }
+    return &csvUpload{reader: reader, header: header, headerIdx: headerIdx}, true
+}
+
+// value returns the trimmed value of column key in record, or "" when absent.
+func (u *csvUpload) value(record []string, key string) string {
+    idx, ok := u.headerIdx[key]
+    if !ok || idx >= len(record) {
+        return ""
+    }
+    return strings.TrimSpace(record[idx])
+}
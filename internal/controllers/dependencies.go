@@ -0,0 +1,130 @@
+package controllers
+
+import (
+    "errors"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgconn"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// dependency is a table whose rows reference the entity being deleted. With cascade the
+// rows are deleted, or updated with Unlink when it is set.
+type dependency struct {
+    Name   string
+    Table  string
+    Column string
+    Unlink map[string]interface{}
+}
+
+var roomDependencies = []dependency{
+    {Name: "room_students", Table: "room_students", Column: "room_id_ref"},
+    {Name: "room_supervisors", Table: "room_supervisors", Column: "room_id_ref"},
+    {Name: "exit_codes", Table: "exit_codes", Column: "room_id_ref"},
+}
+
+var majorDependencies = []dependency{
+    {Name: "users", Table: "users", Column: "major_id_ref", Unlink: map[string]interface{}{"major_id_ref": nil, "jurusan": ""}},
+    {Name: "classes", Table: "classes", Column: "major_id_ref", Unlink: map[string]interface{}{"major_id_ref": nil}},
+}
+
+// userDependencies excludes per-user state (status, tokens, devices) that the foreign
+// keys delete together with the user.
+var userDependencies = []dependency{
+    {Name: "room_students", Table: "room_students", Column: "user_id_ref"},
+    {Name: "room_supervisors", Table: "room_supervisors", Column: "user_id_ref"},
+    {Name: "exit_codes", Table: "exit_codes", Column: "student_user_id_ref"},
+    {Name: "exit_codes_created", Table: "exit_codes", Column: "user_id_ref"},
+    {Name: "student_status_events", Table: "student_status_events", Column: "user_id_ref"},
+    {Name: "alerts", Table: "alerts", Column: "user_id_ref"},
+    {Name: "quiz_attempts", Table: "quiz_attempts", Column: "user_id_ref"},
+    {Name: "homeroom_classes", Table: "classes", Column: "homeroom_teacher_id_ref", Unlink: map[string]interface{}{"homeroom_teacher_id_ref": nil}},
+}
+
+type dependencyError struct {
+    counts map[string]int64
+}
+
+func (e *dependencyError) Error() string {
+    return "still referenced"
+}
+
+var errDeleteNotFound = errors.New("not found")
+
+// removeDependencies deletes, or unlinks, every row in deps that references id.
+func removeDependencies(tx *gorm.DB, id string, deps []dependency) error {
+    for _, d := range deps {
+        var err error
+        if d.Unlink != nil {
+            err = tx.Table(d.Table).Where(d.Column+" = ?", id).Updates(d.Unlink).Error
+        } else {
+            err = tx.Exec("DELETE FROM "+d.Table+" WHERE "+d.Column+" = ?", id).Error
+        }
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// deleteWithDependencies permanently deletes the row of model with id, soft-deleted or
+// not. While rows listed in deps reference it the delete fails with 409 and their counts,
+// unless ?cascade=true is set: then they are removed (or unlinked) in the same transaction.
+func deleteWithDependencies(c *gin.Context, db *gorm.DB, entity string, model interface{}, id string, deps []dependency) {
+    if _, err := uuid.Parse(id); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    cascade := strings.EqualFold(c.Query("cascade"), "true") || c.Query("cascade") == "1"
+    counts := map[string]int64{}
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", id).First(model).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return errDeleteNotFound
+            }
+            return err
+        }
+        referenced := false
+        for _, d := range deps {
+            var n int64
+            if err := tx.Table(d.Table).Where(d.Column+" = ?", id).Count(&n).Error; err != nil {
+                return err
+            }
+            counts[d.Name] += n
+            referenced = referenced || n > 0
+        }
+        if referenced && !cascade {
+            return &dependencyError{counts: counts}
+        }
+        if err := removeDependencies(tx, id, deps); err != nil {
+            return err
+        }
+        return tx.Unscoped().Where("id = ?", id).Delete(model).Error
+    })
+    var depErr *dependencyError
+    var pgErr *pgconn.PgError
+    switch {
+    case err == nil:
+        resp := gin.H{"message": "deleted"}
+        if cascade {
+            resp["removed"] = counts
+        }
+        c.JSON(http.StatusOK, resp)
+    case errors.Is(err, errDeleteNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": entity + " not found"})
+    case errors.As(err, &depErr):
+        c.JSON(http.StatusConflict, gin.H{
+            "error":        entity + " is still referenced; retry with ?cascade=true to remove the references",
+            "dependencies": depErr.counts,
+        })
+    case errors.As(err, &pgErr) && pgErr.Code == "23503":
+        // A reference appeared between the check and the delete
+        c.JSON(http.StatusConflict, gin.H{"error": entity + " is still referenced", "detail": pgErr.Detail})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    }
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func deleteRow(db *gorm.DB, entity string, model interface{}, id string, deps []dependency, cascade bool) *httptest.ResponseRecorder {
+    target := "/delete"
+    if cascade {
+        target += "?cascade=true"
+    }
+    return callHandler(func(c *gin.Context) {
+        deleteWithDependencies(c, db, entity, model, id, deps)
+    }, http.MethodDelete, target, "", nil)
+}
+
+// dependencyCounts decodes the counts under key ("dependencies" or "removed").
+func dependencyCounts(t *testing.T, w *httptest.ResponseRecorder, key string) map[string]int64 {
+    t.Helper()
+    var body map[string]map[string]int64
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatalf("%s: %v", w.Body.String(), err)
+    }
+    return body[key]
+}
+
+func countRows(t *testing.T, db *gorm.DB, table, where string, args ...interface{}) int64 {
+    t.Helper()
+    var n int64
+    if err := db.Table(table).Where(where, args...).Count(&n).Error; err != nil {
+        t.Fatal(err)
+    }
+    return n
+}
+
+func TestDeleteRoomWithDependencies(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    ani := createTestUser(t, db, models.User{FullName: "Ani", Email: "ani@school.test", Role: "siswa"}, "rahasia123")
+    room := models.Room{Name: "Lab 1", Active: true}
+    mustCreate(t, db, &room)
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: room.ID})
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: ani.ID, RoomIDRef: room.ID})
+    mustCreate(t, db, &models.RoomSupervisor{UserIDRef: guru.ID, RoomIDRef: room.ID})
+    mustCreate(t, db, &models.ExitCode{UserIDRef: guru.ID, RoomIDRef: &room.ID, Code: "123456", Reusable: true})
+    alert := models.Alert{Type: "manual", Message: "check", RoomIDRef: &room.ID}
+    mustCreate(t, db, &alert)
+
+    want := map[string]int64{"room_students": 2, "room_supervisors": 1, "exit_codes": 1}
+    w := deleteRow(db, "room", &models.Room{}, room.ID, roomDependencies, false)
+    if w.Code != http.StatusConflict {
+        t.Fatalf("delete without cascade: %d %s, want 409", w.Code, w.Body.String())
+    }
+    if got := dependencyCounts(t, w, "dependencies"); !equalCounts(got, want) {
+        t.Fatalf("dependencies = %v, want %v", got, want)
+    }
+    if countRows(t, db, "rooms", "id = ?", room.ID) != 1 || countRows(t, db, "room_students", "room_id_ref = ?", room.ID) != 2 {
+        t.Fatal("a refused delete changed the data")
+    }
+
+    w = deleteRow(db, "room", &models.Room{}, room.ID, roomDependencies, true)
+    if w.Code != http.StatusOK {
+        t.Fatalf("cascade delete: %d %s", w.Code, w.Body.String())
+    }
+    if got := dependencyCounts(t, w, "removed"); !equalCounts(got, want) {
+        t.Fatalf("removed = %v, want %v", got, want)
+    }
+    for _, table := range []string{"rooms", "room_students", "room_supervisors", "exit_codes"} {
+        column := "room_id_ref"
+        if table == "rooms" {
+            column = "id"
+        }
+        if n := countRows(t, db, table, column+" = ?", room.ID); n != 0 {
+            t.Fatalf("%s still holds %d rows of the room", table, n)
+        }
+    }
+    // alerts keep their history without the room (ON DELETE SET NULL)
+    var kept models.Alert
+    if err := db.First(&kept, "id = ?", alert.ID).Error; err != nil || kept.RoomIDRef != nil {
+        t.Fatalf("alert after room delete: %+v (%v), want it unlinked", kept, err)
+    }
+
+    if w := deleteRow(db, "room", &models.Room{}, room.ID, roomDependencies, true); w.Code != http.StatusNotFound {
+        t.Fatalf("second delete: %d, want 404", w.Code)
+    }
+}
+
+func TestDeleteUserWithDependencies(t *testing.T) {
+    db := newTestDB(t)
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    room := models.Room{Name: "Lab 1", Active: true}
+    mustCreate(t, db, &room)
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: room.ID})
+    loginTokens(t, newTestAuthController(db), budi.Email, "rahasia123")
+
+    w := deleteRow(db, "user", &models.User{}, budi.ID, userDependencies, false)
+    if w.Code != http.StatusConflict {
+        t.Fatalf("delete without cascade: %d %s, want 409", w.Code, w.Body.String())
+    }
+    got := dependencyCounts(t, w, "dependencies")
+    if got["room_students"] != 1 {
+        t.Fatalf("dependencies = %v, want one room_students row", got)
+    }
+    if _, ok := got["refresh_tokens"]; ok {
+        t.Fatalf("refresh tokens must not block the delete: %v", got)
+    }
+
+    if w := deleteRow(db, "user", &models.User{}, budi.ID, userDependencies, true); w.Code != http.StatusOK {
+        t.Fatalf("cascade delete: %d %s", w.Code, w.Body.String())
+    }
+    // the foreign keys remove the per-user state together with the user
+    for _, table := range []string{"users", "room_students", "refresh_tokens"} {
+        column := "user_id_ref"
+        if table == "users" {
+            column = "id"
+        }
+        if n := countRows(t, db, table, column+" = ?", budi.ID); n != 0 {
+            t.Fatalf("%s still holds %d rows of the user", table, n)
+        }
+    }
+}
+
+func TestForeignKeysBlockDirectDeletes(t *testing.T) {
+    db := newTestDB(t)
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    room := models.Room{Name: "Lab 1", Active: true}
+    mustCreate(t, db, &room)
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: room.ID})
+    if err := db.Exec("DELETE FROM rooms WHERE id = ?", room.ID).Error; err == nil {
+        t.Fatal("deleting a referenced room succeeded")
+    }
+    if err := db.Exec("INSERT INTO room_students (id, user_id_ref, room_id_ref) VALUES (?, ?, ?)", uuid.NewString(), uuid.NewString(), room.ID).Error; err == nil {
+        t.Fatal("a room_students row of a missing user was accepted")
+    }
+}
+
+func equalCounts(a, b map[string]int64) bool {
+    for k, v := range b {
+        if a[k] != v {
+            return false
+        }
+    }
+    for k, v := range a {
+        if b[k] != v {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// Device binding modes for siswa logins.
+const (
+    deviceBindingOff     = "off"
+    deviceBindingFlag    = "flag"    // allow second-device logins but alert pengawas
+    deviceBindingEnforce = "enforce" // reject logins from a second device
+)
+
+// maxDeviceIDLength matches devices.device_id varchar(128).
+const maxDeviceIDLength = 128
+
+var (
+    errBoundToOtherDevice = errors.New("account is bound to another device")
+    errDeviceIDRequired   = errors.New("device_id is required")
+    errDeviceIDTooLong    = fmt.Errorf("device_id must be at most %d characters", maxDeviceIDLength)
+)
+
+// deviceBindingPolicy reads the policy from AppConfig (device_binding_mode,
+// device_binding_window_hours) falling back to env config.
+func deviceBindingPolicy(db *gorm.DB, cfg *config.Config) (mode string, window time.Duration, err error) {
+    fallbackMode, fallbackWindow := "", ""
+    if cfg != nil {
+        fallbackMode, fallbackWindow = cfg.DeviceBindingMode, cfg.DeviceBindingWindowHours
+    }
+    mode, err = appConfigValue(db, "device_binding_mode", fallbackMode)
+    if err != nil {
+        return "", 0, err
+    }
+    mode = strings.ToLower(mode)
+    if mode != deviceBindingFlag && mode != deviceBindingEnforce {
+        mode = deviceBindingOff
+    }
+    hoursStr, err := appConfigValue(db, "device_binding_window_hours", fallbackWindow)
+    if err != nil {
+        return "", 0, err
+    }
+    if hours, convErr := strconv.Atoi(hoursStr); convErr == nil && hours > 0 {
+        window = time.Duration(hours) * time.Hour
+    }
+    return mode, window, nil
+}
+
+func appConfigValue(db *gorm.DB, key, fallback string) (string, error) {
+    var rec models.AppConfig
+    if err := db.Where("key = ?", key).First(&rec).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return strings.TrimSpace(fallback), nil
+        }
+        return "", err
+    }
+    return strings.TrimSpace(rec.Value), nil
+}
+
+// recordDevice upserts the device the user is logging in from. Returns nil when
+// the client did not send a device_id.
+func recordDevice(db *gorm.DB, user models.User, req loginRequest) (*models.Device, error) {
+    deviceID := strings.TrimSpace(req.DeviceID)
+    if deviceID == "" {
+        return nil, nil
+    }
+    now := time.Now().UTC()
+    // DO NOTHING lets concurrent first logins from the same device share one row
+    seed := models.Device{UserIDRef: user.ID, DeviceID: deviceID, FirstSeenAt: now}
+    if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&seed).Error; err != nil {
+        return nil, err
+    }
+    var device models.Device
+    if err := db.Where("user_id_ref = ? AND device_id = ?", user.ID, deviceID).First(&device).Error; err != nil {
+        return nil, err
+    }
+    device.Platform = truncate(strings.ToLower(strings.TrimSpace(req.Platform)), 32)
+    device.Model = truncate(strings.TrimSpace(req.DeviceModel), 128)
+    device.OSVersion = truncate(strings.TrimSpace(req.OSVersion), 64)
+    device.AppVersion = truncate(strings.TrimSpace(req.AppVersion), 64)
+    device.LastSeenAt = now
+    if err := db.Save(&device).Error; err != nil {
+        return nil, err
+    }
+    return &device, nil
+}
+
+// checkDeviceBinding decides whether a siswa may log in from deviceID before anything
+// is persisted. A login from a device other than the bound one returns
+// secondDevice=true; in enforce mode it also returns errBoundToOtherDevice.
+func checkDeviceBinding(db *gorm.DB, mode string, user models.User, deviceID string) (secondDevice bool, err error) {
+    if mode == deviceBindingOff || user.Role != "siswa" {
+        return false, nil
+    }
+    deviceID = strings.TrimSpace(deviceID)
+    if deviceID == "" {
+        if mode == deviceBindingEnforce {
+            return false, errDeviceIDRequired
+        }
+        return false, nil
+    }
+    binding, active, err := activeDeviceBinding(db, user.ID)
+    if err != nil || !active {
+        return false, err
+    }
+    var bound models.Device
+    if err := db.Select("device_id").Where("id = ?", binding.DeviceIDRef).First(&bound).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return false, nil
+        }
+        return false, err
+    }
+    if bound.DeviceID == deviceID {
+        return false, nil
+    }
+    if mode == deviceBindingEnforce {
+        return true, errBoundToOtherDevice
+    }
+    return true, nil
+}
+
+// bindDevice binds a siswa to the login device when no active binding exists, and
+// reports like checkDeviceBinding whether the account ended up bound to another device.
+// Call it after checkDeviceBinding allowed the login and the device was recorded: the
+// insert only takes over a missing or expired binding, so of two first logins racing
+// from different devices one binds and the other is a second-device login.
+func bindDevice(db *gorm.DB, mode string, window time.Duration, user models.User, device *models.Device) (secondDevice bool, err error) {
+    if mode == deviceBindingOff || user.Role != "siswa" || device == nil {
+        return false, nil
+    }
+    now := time.Now().UTC()
+    binding := models.DeviceBinding{UserIDRef: user.ID, DeviceIDRef: device.ID, BoundAt: now}
+    if window > 0 {
+        expires := now.Add(window)
+        binding.ExpiresAt = &expires
+    }
+    err = db.Clauses(clause.OnConflict{
+        Columns:   []clause.Column{{Name: "user_id_ref"}},
+        DoUpdates: clause.AssignmentColumns([]string{"device_id_ref", "bound_at", "expires_at"}),
+        Where: clause.Where{Exprs: []clause.Expression{
+            clause.Expr{SQL: "device_bindings.expires_at IS NOT NULL AND device_bindings.expires_at <= ?", Vars: []interface{}{now}},
+        }},
+    }).Create(&binding).Error
+    if err != nil {
+        return false, err
+    }
+
+    var current models.DeviceBinding
+    if err := db.Select("device_id_ref").Where("user_id_ref = ?", user.ID).First(&current).Error; err != nil {
+        return false, err
+    }
+    if current.DeviceIDRef == device.ID {
+        return false, nil
+    }
+    if mode == deviceBindingEnforce {
+        return true, errBoundToOtherDevice
+    }
+    return true, nil
+}
+
+// activeDeviceBinding loads the binding of a user; active is false when there is none
+// or it expired.
+func activeDeviceBinding(db *gorm.DB, userID string) (models.DeviceBinding, bool, error) {
+    var binding models.DeviceBinding
+    err := db.Where("user_id_ref = ?", userID).First(&binding).Error
+    if err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return binding, false, nil
+        }
+        return binding, false, err
+    }
+    active := binding.ExpiresAt == nil || time.Now().UTC().Before(*binding.ExpiresAt)
+    return binding, active, nil
+}
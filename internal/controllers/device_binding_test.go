@@ -0,0 +1,133 @@
+package controllers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func loginBody(t *testing.T, email, password, deviceID string) string {
+    t.Helper()
+    b, err := json.Marshal(map[string]string{
+        "email":       email,
+        "password":    password,
+        "platform":    "android",
+        "app_version": "1.0.0",
+        "device_id":   deviceID,
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(b)
+}
+
+func boundDeviceID(t *testing.T, db *gorm.DB, userID string) string {
+    t.Helper()
+    var device models.Device
+    err := db.Joins("JOIN device_bindings b ON b.device_id_ref = devices.id").
+        Where("b.user_id_ref = ?", userID).First(&device).Error
+    if err != nil {
+        t.Fatal(err)
+    }
+    return device.DeviceID
+}
+
+func TestDeviceBindingEnforce(t *testing.T) {
+    db := newTestDB(t)
+    mustCreate(t, db, &models.AppConfig{Key: "device_binding_mode", Value: "enforce"})
+    siswa := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    a := newTestAuthController(db)
+    login := func(deviceID string) *httptest.ResponseRecorder {
+        return callHandler(a.Login, http.MethodPost, "/api/v1/auth/login", loginBody(t, siswa.Email, "rahasia123", deviceID), nil)
+    }
+
+    cases := []struct {
+        name     string
+        deviceID string
+        want     int
+    }{
+        {"device_id missing", "", http.StatusBadRequest},
+        {"device_id too long", strings.Repeat("x", maxDeviceIDLength+1), http.StatusBadRequest},
+        {"first device binds", "device-a", http.StatusOK},
+        {"bound device again", "device-a", http.StatusOK},
+        {"second device", "device-b", http.StatusForbidden},
+    }
+    for _, tc := range cases {
+        if w := login(tc.deviceID); w.Code != tc.want {
+            t.Fatalf("%s: got %d %s, want %d", tc.name, w.Code, w.Body.String(), tc.want)
+        }
+    }
+    if got := boundDeviceID(t, db, siswa.ID); got != "device-a" {
+        t.Fatalf("bound to %q, want device-a", got)
+    }
+}
+
+func TestBindDeviceConcurrentFirstLogins(t *testing.T) {
+    db := newTestDB(t)
+    siswa := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    devices := make([]*models.Device, 4)
+    for i := range devices {
+        devices[i] = &models.Device{UserIDRef: siswa.ID, DeviceID: fmt.Sprintf("device-%d", i)}
+        mustCreate(t, db, devices[i])
+    }
+
+    second := make([]bool, len(devices))
+    errs := make([]error, len(devices))
+    var wg sync.WaitGroup
+    for i := range devices {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            second[i], errs[i] = bindDevice(db, deviceBindingEnforce, 0, siswa, devices[i])
+        }(i)
+    }
+    wg.Wait()
+
+    winner := -1
+    for i := range devices {
+        switch {
+        case errs[i] == nil && !second[i]:
+            if winner >= 0 {
+                t.Fatalf("devices %d and %d were both bound", winner, i)
+            }
+            winner = i
+        case errors.Is(errs[i], errBoundToOtherDevice) && second[i]:
+        default:
+            t.Fatalf("device %d: second=%v err=%v, want a clean rejection", i, second[i], errs[i])
+        }
+    }
+    if winner < 0 {
+        t.Fatal("no device was bound")
+    }
+    if got := boundDeviceID(t, db, siswa.ID); got != devices[winner].DeviceID {
+        t.Fatalf("bound to %q, want %q", got, devices[winner].DeviceID)
+    }
+}
+
+func TestBindDeviceTakesOverExpiredBinding(t *testing.T) {
+    db := newTestDB(t)
+    siswa := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    old := models.Device{UserIDRef: siswa.ID, DeviceID: "old-phone"}
+    next := models.Device{UserIDRef: siswa.ID, DeviceID: "new-phone"}
+    mustCreate(t, db, &old)
+    mustCreate(t, db, &next)
+    expired := time.Now().UTC().Add(-time.Hour)
+    mustCreate(t, db, &models.DeviceBinding{UserIDRef: siswa.ID, DeviceIDRef: old.ID, BoundAt: expired.Add(-time.Hour), ExpiresAt: &expired})
+
+    if second, err := bindDevice(db, deviceBindingEnforce, time.Hour, siswa, &next); err != nil || second {
+        t.Fatalf("second=%v err=%v, want the expired binding taken over", second, err)
+    }
+    if got := boundDeviceID(t, db, siswa.ID); got != "new-phone" {
+        t.Fatalf("bound to %q, want new-phone", got)
+    }
+}
@@ -8,7 +8,7 @@ import (
     "time"
 
     "github.com/gin-gonic/gin"
-    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v5/pgconn"
     "gorm.io/gorm"
     "gorm.io/gorm/clause"
 
@@ -31,7 +31,7 @@ func (ec *ExitCodeController) allowedRoomIDsFor(user models.User) ([]string, boo
     }
     if user.Role == "pengawas" {
         var m []models.RoomSupervisor
-        if err := ec.DB.Where("user_id_ref = ?", user.ID).Find(&m).Error; err != nil {
+        if err := ec.DB.Where("user_id_ref = ?", user.ID).Where(models.CurrentTermCond("term_id_ref")).Find(&m).Error; err != nil {
             return nil, false, err
         }
         ids := make([]string, 0, len(m))
@@ -49,6 +49,7 @@ type generateExitCodeRequest struct {
     StudentIDs  []string `json:"student_ids"`    // optional list of specific students within the room
     AllStudents bool   `json:"all_students"`   // when true, generate codes for every student in the room
     SingleForRoom bool `json:"single_for_room"` // when true, generate one reusable code for the room
+    ClassID     *string  `json:"class_id"`       // optional: every student of this class assigned to the room
 }
 
 func (ec *ExitCodeController) Generate(c *gin.Context) {
@@ -67,12 +68,21 @@ func (ec *ExitCodeController) Generate(c *gin.Context) {
     }
     trimmedRoomID := strings.TrimSpace(*req.RoomID)
     req.RoomID = &trimmedRoomID
+    classID := ""
+    if req.ClassID != nil {
+        classID = strings.TrimSpace(*req.ClassID)
+    }
     if req.SingleForRoom {
         // room-wide code does not require student_ids/all_students
         // continue
+    } else if classID != "" {
+        if req.AllStudents || len(req.StudentIDs) > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "class_id cannot be combined with student_ids or all_students"})
+            return
+        }
     } else {
         if !req.AllStudents && len(req.StudentIDs) == 0 {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "student_ids is required unless all_students is true"})
+            c.JSON(http.StatusBadRequest, gin.H{"error": "student_ids is required unless all_students or class_id is set"})
             return
         }
         if req.AllStudents && len(req.StudentIDs) > 0 {
@@ -110,7 +120,7 @@ func (ec *ExitCodeController) Generate(c *gin.Context) {
     }
 
     var roomStudents []models.RoomStudent
-    if err := ec.DB.Where("room_id_ref = ?", *req.RoomID).Find(&roomStudents).Error; err != nil {
+    if err := ec.DB.Where("room_id_ref = ?", *req.RoomID).Where(models.CurrentTermCond("term_id_ref")).Find(&roomStudents).Error; err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
@@ -121,7 +131,25 @@ func (ec *ExitCodeController) Generate(c *gin.Context) {
     }
 
     var targetStudentIDs []string
-    if req.AllStudents {
+    if req.SingleForRoom {
+        // no per-student targets
+    } else if classID != "" {
+        var class models.Class
+        if err := ec.DB.Where("id = ?", classID).First(&class).Error; err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid class_id"})
+            return
+        }
+        var classStudents []string
+        if err := ec.DB.Model(&models.User{}).Where("class_id_ref = ?", class.ID).Pluck("id", &classStudents).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for _, sid := range classStudents {
+            if _, ok := studentInRoom[sid]; ok {
+                targetStudentIDs = append(targetStudentIDs, sid)
+            }
+        }
+    } else if req.AllStudents {
         for _, rs := range roomStudents {
             targetStudentIDs = append(targetStudentIDs, rs.UserIDRef)
         }
@@ -177,28 +205,24 @@ func (ec *ExitCodeController) Generate(c *gin.Context) {
         }
     }
 
+    termID, err := activeTermID(ec.DB)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
     created := make([]models.ExitCode, 0, 1)
     err = ec.DB.Transaction(func(tx *gorm.DB) error {
         if req.SingleForRoom {
-            const maxAttempts = 5
-            var rec models.ExitCode
-            for attempt := 0; attempt < maxAttempts; attempt++ {
-                code, genErr := utils.GenerateCode(req.Length)
-                if genErr != nil { return genErr }
-                rec = models.ExitCode{
-                    UserIDRef:  user.ID,
-                    RoomIDRef:  req.RoomID,
-                    Code:       code,
-                    Reusable:   true,
-                }
-                if err := tx.Create(&rec).Error; err != nil {
-                    var pgErr *pgconn.PgError
-                    if errors.As(err, &pgErr) && pgErr.Code == "23505" && attempt < maxAttempts-1 { continue }
-                    return err
-                }
-                break
+            rec, err := insertExitCode(tx, models.ExitCode{
+                UserIDRef: user.ID,
+                RoomIDRef: req.RoomID,
+                Reusable:  true,
+                TermIDRef: termID,
+            }, req.Length)
+            if err != nil {
+                return err
             }
-            if rec.ID == "" { return errors.New("failed to generate exit code") }
             created = append(created, rec)
             return nil
         }
@@ -216,31 +240,15 @@ func (ec *ExitCodeController) Generate(c *gin.Context) {
                 return err
             }
 
-            const maxAttempts = 5
-            var rec models.ExitCode
-            for attempt := 0; attempt < maxAttempts; attempt++ {
-                code, genErr := utils.GenerateCode(req.Length)
-                if genErr != nil {
-                    return genErr
-                }
-                sid := studentID
-                rec = models.ExitCode{
-                    UserIDRef:        user.ID,
-                    StudentUserIDRef: &sid,
-                    RoomIDRef:        req.RoomID,
-                    Code:             code,
-                }
-                if err := tx.Create(&rec).Error; err != nil {
-                    var pgErr *pgconn.PgError
-                    if errors.As(err, &pgErr) && pgErr.Code == "23505" && attempt < maxAttempts-1 {
-                        continue
-                    }
-                    return err
-                }
-                break
-            }
-            if rec.ID == "" {
-                return errors.New("failed to generate exit code")
+            sid := studentID
+            rec, err := insertExitCode(tx, models.ExitCode{
+                UserIDRef:        user.ID,
+                StudentUserIDRef: &sid,
+                RoomIDRef:        req.RoomID,
+                TermIDRef:        termID,
+            }, req.Length)
+            if err != nil {
+                return err
             }
             created = append(created, rec)
         }
@@ -324,6 +332,10 @@ func (ec *ExitCodeController) List(c *gin.Context) {
     roomFilter := strings.TrimSpace(c.Query("room_id"))
     studentFilter := strings.TrimSpace(c.Query("student_user_id"))
     usedFilter := strings.TrimSpace(strings.ToLower(c.DefaultQuery("used", "false")))
+    if _, _, err := termListFilter(c, "term_id_ref"); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
 
     applyFilters := func(q *gorm.DB, alias string) *gorm.DB {
         col := func(field string) string {
@@ -337,12 +349,16 @@ func (ec *ExitCodeController) List(c *gin.Context) {
                 return q.Where("1=0")
             }
             // Use supervisor join to preserve index usage
+            supTerm := " AND sup.deleted_at IS NULL AND " + models.CurrentTermCond("sup.term_id_ref")
             if alias == "ec" {
-                q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = ec.room_id_ref AND sup.user_id_ref = ?", user.ID)
+                q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = ec.room_id_ref AND sup.user_id_ref = ?"+supTerm, user.ID)
             } else {
-                q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = "+col("room_id_ref")+" AND sup.user_id_ref = ?", user.ID)
+                q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = "+col("room_id_ref")+" AND sup.user_id_ref = ?"+supTerm, user.ID)
             }
         }
+        if termCond, termArgs, _ := termListFilter(c, col("term_id_ref")); termCond != "" {
+            q = q.Where(termCond, termArgs...)
+        }
         if roomFilter != "" {
             q = q.Where(col("room_id_ref")+" = ?", roomFilter)
         }
@@ -410,6 +426,7 @@ func (ec *ExitCodeController) List(c *gin.Context) {
             "status":          status,
             "created_at":      e.CreatedAt,
             "created_by":      e.UserIDRef,
+            "term_id":         e.TermIDRef,
         })
     }
     meta := gin.H{"total": total, "all": all}
@@ -447,6 +464,7 @@ func (ec *ExitCodeController) Revoke(c *gin.Context) {
         }
         if err := ec.DB.Model(&models.RoomSupervisor{}).
             Where("user_id_ref = ? AND room_id_ref = ?", user.ID, *rec.RoomIDRef).
+            Where(models.CurrentTermCond("term_id_ref")).
             Count(&count).Error; err != nil {
             c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
             return
@@ -525,7 +543,8 @@ func (ec *ExitCodeController) Consume(c *gin.Context) {
     err = ec.DB.Transaction(func(tx *gorm.DB) error {
         // Try student-specific code first
         q := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-            Where("code = ? AND used_at IS NULL AND student_user_id_ref = ?", req.Code, targetStudentID)
+            Where("code = ? AND used_at IS NULL AND student_user_id_ref = ?", req.Code, targetStudentID).
+            Where(models.CurrentTermCond("term_id_ref"))
         if req.RoomID != nil {
             q = q.Where("room_id_ref = ?", *req.RoomID)
         }
@@ -535,7 +554,7 @@ func (ec *ExitCodeController) Consume(c *gin.Context) {
                 return err
             }
             // Fallback: room-wide reusable code
-            rq := tx.Where("code = ? AND reusable = ?", req.Code, true)
+            rq := tx.Where("code = ? AND reusable = ?", req.Code, true).Where(models.CurrentTermCond("term_id_ref"))
             if req.RoomID != nil {
                 rq = rq.Where("room_id_ref = ?", *req.RoomID)
             }
@@ -547,7 +566,8 @@ func (ec *ExitCodeController) Consume(c *gin.Context) {
                 return gorm.ErrRecordNotFound
             }
             var count int64
-            if err := tx.Model(&models.RoomStudent{}).Where("user_id_ref = ? AND room_id_ref = ?", targetStudentID, *consumed.RoomIDRef).Count(&count).Error; err != nil {
+            if err := tx.Model(&models.RoomStudent{}).Where("user_id_ref = ? AND room_id_ref = ?", targetStudentID, *consumed.RoomIDRef).
+                Where(models.CurrentTermCond("term_id_ref")).Count(&count).Error; err != nil {
                 return err
             }
             if count == 0 {
@@ -587,19 +607,51 @@ func (ec *ExitCodeController) Consume(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    // Jika pemanggil adalah siswa, set status locked=false
-    if role == "siswa" {
-        var st models.StudentStatus
-        if err := ec.DB.Where("user_id_ref = ?", user.ID).First(&st).Error; err != nil {
-            if errors.Is(err, gorm.ErrRecordNotFound) {
-                st = models.StudentStatus{UserIDRef: user.ID, Locked: false}
-                _ = ec.DB.Create(&st).Error
-            }
-        } else {
+    // Catat otorisasi unlock pada status siswa. Jika pemanggil adalah siswa, langsung
+    // set locked=false; selain itu unlock berikutnya dalam jendela waktu dianggap sah.
+    if _, err := updateStudentStatus(ec.DB, ec.Hubs, targetStudentID, func(st *models.StudentStatus) error {
+        if role == "siswa" {
             st.Locked = false
-            _ = ec.DB.Save(&st).Error
+            st.UnauthorizedUnlock = false
+            st.UnlockAuthorizedUntil = nil
+        } else {
+            until := now.Add(exitCodeUnlockWindow)
+            st.UnlockAuthorizedUntil = &until
         }
+        return nil
+    }); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
     }
     go broadcastStudentStatus(ec.DB, ec.Hubs, targetStudentID)
     c.JSON(http.StatusOK, gin.H{"message": "consumed"})
 }
+
+// insertExitCode stores rec under a freshly generated code, retrying when the code
+// collides with an existing one. Each attempt runs under a savepoint: a failed INSERT
+// aborts the whole Postgres transaction otherwise, so a retry could never succeed.
+func insertExitCode(tx *gorm.DB, rec models.ExitCode, length int) (models.ExitCode, error) {
+    const maxAttempts = 5
+    for attempt := 1; ; attempt++ {
+        code, err := utils.GenerateCode(length)
+        if err != nil {
+            return rec, err
+        }
+        try := rec
+        try.Code = code
+        if err := tx.SavePoint("exit_code_insert").Error; err != nil {
+            return rec, err
+        }
+        err = tx.Create(&try).Error
+        if err == nil {
+            return try, nil
+        }
+        var pgErr *pgconn.PgError
+        if !errors.As(err, &pgErr) || pgErr.Code != "23505" || attempt == maxAttempts {
+            return rec, err
+        }
+        if err := tx.RollbackTo("exit_code_insert").Error; err != nil {
+            return rec, err
+        }
+    }
+}
@@ -0,0 +1,129 @@
+package controllers
+
+import (
+    "net/http"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// LoginLockoutController lets admins inspect and clear login throttling state.
+// Past lockout events are regular alerts (type login_lockout) under /monitoring/alerts.
+type LoginLockoutController struct {
+    DB       *gorm.DB
+    Throttle *LoginThrottle
+}
+
+// List returns accounts and IPs currently in backoff or lockout.
+func (lc *LoginLockoutController) List(c *gin.Context) {
+    now := time.Now().UTC()
+    recs, err := lc.Throttle.Store.ListBlocked(now)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    sort.Slice(recs, func(i, j int) bool { return recs[i].BlockedUntil.After(*recs[j].BlockedUntil) })
+
+    // Account subjects are user ids (see accountThrottleSubject); resolve them for the admin UI
+    ids := make([]string, 0, len(recs))
+    for _, r := range recs {
+        if _, err := uuid.Parse(r.Subject); err == nil && r.Kind == throttleKindAccount {
+            ids = append(ids, r.Subject)
+        }
+    }
+    usersBySubject := map[string]models.User{}
+    if len(ids) > 0 {
+        var users []models.User
+        if err := lc.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        for _, u := range users {
+            usersBySubject[u.ID] = u
+        }
+    }
+
+    out := make([]gin.H, 0, len(recs))
+    for _, r := range recs {
+        row := gin.H{
+            "kind":            r.Kind,
+            "subject":         r.Subject,
+            "failures":        r.Failures,
+            "locked_out":      r.LockedOut,
+            "blocked_until":   r.BlockedUntil,
+            "last_failure_at": r.LastFailureAt,
+            "user":            nil,
+        }
+        if u, ok := usersBySubject[r.Subject]; ok && r.Kind == throttleKindAccount {
+            row["user"] = gin.H{"id": u.ID, "full_name": u.FullName, "role": u.Role}
+        }
+        out = append(out, row)
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out})
+}
+
+type unlockLoginRequest struct {
+    Kind    string `json:"kind" binding:"required"`
+    Subject string `json:"subject" binding:"required"`
+}
+
+// Unlock clears the counter of an account (kind=account, subject=user id, email or
+// username) or IP (kind=ip).
+func (lc *LoginLockoutController) Unlock(c *gin.Context) {
+    var req unlockLoginRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    kind := strings.ToLower(strings.TrimSpace(req.Kind))
+    subject := strings.TrimSpace(req.Subject)
+    switch kind {
+    case throttleKindAccount:
+        subject = throttleSubject(subject)
+    case throttleKindIP:
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be account or ip"})
+        return
+    }
+    subjects := []string{subject}
+    if kind == throttleKindAccount {
+        // known accounts are keyed by user id; the identifier itself only keys unknown ones
+        if u, err := findUserByIdentifier(lc.DB, subject); err == nil {
+            subjects = append(subjects, u.ID)
+        }
+    }
+    found := false
+    for _, key := range subjects {
+        ok, err := lc.Throttle.Store.Delete(kind, key)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        found = found || ok
+    }
+    if !found {
+        c.JSON(http.StatusNotFound, gin.H{"error": "no lockout found"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "unlocked"})
+}
+
+// UnlockUser clears the account counter of :user_id.
+func (lc *LoginLockoutController) UnlockUser(c *gin.Context) {
+    var u models.User
+    if err := lc.DB.Where("id = ?", strings.TrimSpace(c.Param("user_id"))).First(&u).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+        return
+    }
+    if _, err := lc.Throttle.Store.Delete(throttleKindAccount, accountThrottleSubject("", &u)); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "unlocked"})
+}
@@ -0,0 +1,390 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
+)
+
+// Login throttle key kinds.
+const (
+    throttleKindAccount = "account"
+    throttleKindIP      = "ip"
+)
+
+// throttlePolicy: the first FreeAttempts failures are not delayed, each further failure
+// doubles the wait (1s, 2s, 4s, ... capped at Lockout) and MaxFailures locks the key for
+// Lockout. Counters reset after a successful login or Lockout of inactivity.
+type throttlePolicy struct {
+    FreeAttempts int
+    MaxFailures  int
+    Lockout      time.Duration
+}
+
+// LoginAttemptStore persists LoginAttempt counters. The in-memory store suits a single
+// instance; the Postgres store shares counters between instances.
+type LoginAttemptStore interface {
+    Get(kind, subject string) (*models.LoginAttempt, error)
+    // Update loads (or starts) the record of kind/subject, applies fn and saves it atomically.
+    Update(kind, subject string, fn func(rec *models.LoginAttempt)) (models.LoginAttempt, error)
+    Delete(kind, subject string) (bool, error)
+    ListBlocked(now time.Time) ([]models.LoginAttempt, error)
+}
+
+// LoginThrottle applies per-account and per-IP backoff/lockout to logins.
+type LoginThrottle struct {
+    Store   LoginAttemptStore
+    Account throttlePolicy
+    IP      throttlePolicy
+}
+
+// NewLoginThrottle builds the throttle from env config (LOGIN_THROTTLE_STORE=memory|postgres).
+func NewLoginThrottle(db *gorm.DB, cfg *config.Config) *LoginThrottle {
+    lockout := 15 * time.Minute
+    accountMax, ipMax := 5, 100
+    storeKind := ""
+    if cfg != nil {
+        if n, err := strconv.Atoi(cfg.LoginLockoutMinutes); err == nil && n > 0 {
+            lockout = time.Duration(n) * time.Minute
+        }
+        if n, err := strconv.Atoi(cfg.LoginAccountMaxFailures); err == nil && n > 0 {
+            accountMax = n
+        }
+        if n, err := strconv.Atoi(cfg.LoginIPMaxFailures); err == nil && n > 0 {
+            ipMax = n
+        }
+        storeKind = strings.ToLower(strings.TrimSpace(cfg.LoginThrottleStore))
+    }
+    t := &LoginThrottle{
+        Account: throttlePolicy{FreeAttempts: 3, MaxFailures: accountMax, Lockout: lockout},
+        // A classroom shares one IP, so only back off once typos are no longer plausible
+        IP: throttlePolicy{FreeAttempts: ipMax / 2, MaxFailures: ipMax, Lockout: lockout},
+    }
+    if storeKind == "postgres" {
+        t.Store = &dbAttemptStore{db: db, ttl: lockout}
+    } else {
+        t.Store = newMemoryAttemptStore(lockout)
+    }
+    return t
+}
+
+func (t *LoginThrottle) policy(kind string) throttlePolicy {
+    if kind == throttleKindIP {
+        return t.IP
+    }
+    return t.Account
+}
+
+// maxThrottleSubject matches login_attempts.subject varchar(255).
+const maxThrottleSubject = 255
+
+// throttleSubject normalises a login identifier into its account throttle key.
+func throttleSubject(identifier string) string {
+    return truncate(strings.ToLower(strings.TrimSpace(identifier)), maxThrottleSubject)
+}
+
+// accountThrottleSubject is the account key of a login. A known user is keyed by id so
+// that every identifier reaching the account (email or username) shares one budget;
+// identifiers matching no user are keyed by themselves.
+func accountThrottleSubject(identifier string, user *models.User) string {
+    if user != nil && user.ID != "" {
+        return user.ID
+    }
+    return throttleSubject(identifier)
+}
+
+func throttleKeys(account, ip string) [][2]string {
+    keys := [][2]string{}
+    if account != "" {
+        keys = append(keys, [2]string{throttleKindAccount, account})
+    }
+    if ip = truncate(strings.TrimSpace(ip), maxThrottleSubject); ip != "" {
+        keys = append(keys, [2]string{throttleKindIP, ip})
+    }
+    return keys
+}
+
+// Check returns how long the client must wait before the account (an
+// accountThrottleSubject) or IP may try again.
+func (t *LoginThrottle) Check(account, ip string, now time.Time) (time.Duration, error) {
+    var wait time.Duration
+    for _, key := range throttleKeys(account, ip) {
+        rec, err := t.Store.Get(key[0], key[1])
+        if err != nil {
+            return 0, err
+        }
+        if rec != nil && rec.BlockedUntil != nil && now.Before(*rec.BlockedUntil) {
+            if d := rec.BlockedUntil.Sub(now); d > wait {
+                wait = d
+            }
+        }
+    }
+    return wait, nil
+}
+
+// Fail records a failed login and returns the keys that were locked out by it.
+func (t *LoginThrottle) Fail(account, ip string, now time.Time) ([]models.LoginAttempt, error) {
+    var locked []models.LoginAttempt
+    for _, key := range throttleKeys(account, ip) {
+        policy := t.policy(key[0])
+        lockedNow := false
+        rec, err := t.Store.Update(key[0], key[1], func(rec *models.LoginAttempt) {
+            lockedNow = applyLoginFailure(rec, policy, now)
+        })
+        if err != nil {
+            return locked, err
+        }
+        if lockedNow {
+            locked = append(locked, rec)
+        }
+    }
+    return locked, nil
+}
+
+// Succeed clears the account counter; the IP counter only decays so a valid
+// account cannot be used to reset it.
+func (t *LoginThrottle) Succeed(account string) error {
+    if account == "" {
+        return nil
+    }
+    _, err := t.Store.Delete(throttleKindAccount, account)
+    return err
+}
+
+func applyLoginFailure(rec *models.LoginAttempt, p throttlePolicy, now time.Time) (lockedNow bool) {
+    last := rec.LastFailureAt
+    if rec.BlockedUntil != nil && rec.BlockedUntil.After(last) {
+        last = *rec.BlockedUntil
+    }
+    if rec.Failures > 0 && now.Sub(last) > p.Lockout {
+        rec.Failures = 0
+        rec.LockedOut = false
+        rec.BlockedUntil = nil
+    }
+    wasLocked := rec.LockedOut
+    rec.Failures++
+    rec.LastFailureAt = now
+
+    var wait time.Duration
+    switch {
+    case rec.Failures >= p.MaxFailures:
+        rec.LockedOut = true
+        wait = p.Lockout
+    case rec.Failures > p.FreeAttempts:
+        shift := rec.Failures - p.FreeAttempts - 1
+        if shift > 20 {
+            shift = 20
+        }
+        wait = time.Second << uint(shift)
+        if wait > p.Lockout {
+            wait = p.Lockout
+        }
+    }
+    if wait > 0 {
+        until := now.Add(wait)
+        rec.BlockedUntil = &until
+    }
+    return rec.LockedOut && !wasLocked
+}
+
+// raiseLockoutAlert records a login_lockout alert; account lockouts are tied to the
+// user (and their room) when the identifier matches one.
+func raiseLockoutAlert(db *gorm.DB, hubs *ws.Hubs, rec models.LoginAttempt, user *models.User) {
+    if user != nil {
+        msg := fmt.Sprintf("account %s locked out after %d failed logins", firstNonBlank(user.Email, user.Username), rec.Failures)
+        raiseStudentAlert(db, hubs, *user, "login_lockout", msg)
+        return
+    }
+    msg := fmt.Sprintf("%s %s locked out after %d failed logins", rec.Kind, rec.Subject, rec.Failures)
+    alert := models.Alert{Type: "login_lockout", Message: msg}
+    if err := db.Create(&alert).Error; err != nil {
+        log.Printf("login_lockout alert: %v", err)
+        return
+    }
+    if hubs == nil || hubs.Monitoring == nil {
+        return
+    }
+    hubs.Monitoring.BroadcastAlert(ws.MonitoringAlert{
+        Type:      alert.Type,
+        ID:        alert.ID,
+        Message:   alert.Message,
+        CreatedAt: alert.CreatedAt,
+    })
+}
+
+// memoryAttemptMaxItems bounds the in-memory store; past it the oldest unblocked
+// counters are dropped first.
+const memoryAttemptMaxItems = 10000
+
+type memoryAttemptStore struct {
+    mu        sync.Mutex
+    items     map[string]*models.LoginAttempt
+    ttl       time.Duration
+    lastSweep time.Time
+}
+
+// newMemoryAttemptStore keeps counters until they are unblocked and idle for ttl, after
+// which applyLoginFailure would reset them anyway.
+func newMemoryAttemptStore(ttl time.Duration) *memoryAttemptStore {
+    return &memoryAttemptStore{items: map[string]*models.LoginAttempt{}, ttl: ttl}
+}
+
+func (s *memoryAttemptStore) expired(rec *models.LoginAttempt, now time.Time) bool {
+    last := rec.LastFailureAt
+    if rec.BlockedUntil != nil {
+        if rec.BlockedUntil.After(now) {
+            return false
+        }
+        if rec.BlockedUntil.After(last) {
+            last = *rec.BlockedUntil
+        }
+    }
+    return now.Sub(last) > s.ttl
+}
+
+// sweep drops expired counters at most once a minute, and unblocked counters when the
+// store is still over memoryAttemptMaxItems, so a scan of random identifiers cannot
+// grow the map without bound. Callers hold s.mu.
+func (s *memoryAttemptStore) sweep(now time.Time) {
+    if now.Sub(s.lastSweep) < time.Minute && len(s.items) < memoryAttemptMaxItems {
+        return
+    }
+    s.lastSweep = now
+    for k, rec := range s.items {
+        if s.expired(rec, now) {
+            delete(s.items, k)
+        }
+    }
+    for k, rec := range s.items {
+        if len(s.items) < memoryAttemptMaxItems {
+            break
+        }
+        if rec.BlockedUntil == nil || !rec.BlockedUntil.After(now) {
+            delete(s.items, k)
+        }
+    }
+}
+
+func (s *memoryAttemptStore) Get(kind, subject string) (*models.LoginAttempt, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    rec, ok := s.items[kind+"|"+subject]
+    if !ok {
+        return nil, nil
+    }
+    out := *rec
+    return &out, nil
+}
+
+func (s *memoryAttemptStore) Update(kind, subject string, fn func(rec *models.LoginAttempt)) (models.LoginAttempt, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := time.Now().UTC()
+    s.sweep(now)
+    key := kind + "|" + subject
+    rec, ok := s.items[key]
+    if !ok {
+        rec = &models.LoginAttempt{Kind: kind, Subject: subject, CreatedAt: now}
+        s.items[key] = rec
+    }
+    fn(rec)
+    rec.UpdatedAt = now
+    return *rec, nil
+}
+
+func (s *memoryAttemptStore) Delete(kind, subject string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    key := kind + "|" + subject
+    _, ok := s.items[key]
+    delete(s.items, key)
+    return ok, nil
+}
+
+func (s *memoryAttemptStore) ListBlocked(now time.Time) ([]models.LoginAttempt, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    out := []models.LoginAttempt{}
+    for _, rec := range s.items {
+        if rec.BlockedUntil != nil && rec.BlockedUntil.After(now) {
+            out = append(out, *rec)
+        }
+    }
+    return out, nil
+}
+
+type dbAttemptStore struct {
+    db *gorm.DB
+    // ttl matches memoryAttemptStore: rows unblocked and idle for ttl are deleted
+    ttl       time.Duration
+    mu        sync.Mutex
+    lastSweep time.Time
+}
+
+// sweep deletes expired rows at most once a minute per instance, so identifiers that
+// were only ever tried once do not stay in login_attempts forever.
+func (s *dbAttemptStore) sweep(now time.Time) {
+    s.mu.Lock()
+    if now.Sub(s.lastSweep) < time.Minute {
+        s.mu.Unlock()
+        return
+    }
+    s.lastSweep = now
+    s.mu.Unlock()
+    cutoff := now.Add(-s.ttl)
+    if err := s.db.Where("last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", cutoff, cutoff).
+        Delete(&models.LoginAttempt{}).Error; err != nil {
+        log.Printf("login throttle: prune login_attempts: %v", err)
+    }
+}
+
+func (s *dbAttemptStore) Get(kind, subject string) (*models.LoginAttempt, error) {
+    var rec models.LoginAttempt
+    if err := s.db.Where("kind = ? AND subject = ?", kind, subject).First(&rec).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    return &rec, nil
+}
+
+func (s *dbAttemptStore) Update(kind, subject string, fn func(rec *models.LoginAttempt)) (models.LoginAttempt, error) {
+    s.sweep(time.Now().UTC())
+    var rec models.LoginAttempt
+    err := s.db.Transaction(func(tx *gorm.DB) error {
+        seed := models.LoginAttempt{Kind: kind, Subject: subject}
+        if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seed).Error; err != nil {
+            return err
+        }
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+            Where("kind = ? AND subject = ?", kind, subject).First(&rec).Error; err != nil {
+            return err
+        }
+        fn(&rec)
+        return tx.Save(&rec).Error
+    })
+    return rec, err
+}
+
+func (s *dbAttemptStore) Delete(kind, subject string) (bool, error) {
+    res := s.db.Where("kind = ? AND subject = ?", kind, subject).Delete(&models.LoginAttempt{})
+    return res.RowsAffected > 0, res.Error
+}
+
+func (s *dbAttemptStore) ListBlocked(now time.Time) ([]models.LoginAttempt, error) {
+    var out []models.LoginAttempt
+    err := s.db.Where("blocked_until > ?", now).Order("blocked_until DESC").Find(&out).Error
+    return out, err
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func newTestThrottle(store LoginAttemptStore) *LoginThrottle {
+    return &LoginThrottle{
+        Store:   store,
+        Account: throttlePolicy{FreeAttempts: 3, MaxFailures: 5, Lockout: 15 * time.Minute},
+        IP:      throttlePolicy{FreeAttempts: 50, MaxFailures: 100, Lockout: 15 * time.Minute},
+    }
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+    th := newTestThrottle(newMemoryAttemptStore(15 * time.Minute))
+    now := time.Date(2026, 5, 4, 7, 0, 0, 0, time.UTC)
+    waits := []time.Duration{0, 0, 0, time.Second, 15 * time.Minute}
+    for i, want := range waits {
+        locked, err := th.Fail("user-1", "192.0.2.1", now)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if gotLocked := len(locked) == 1; gotLocked != (i == len(waits)-1) {
+            t.Fatalf("failure %d: locked %v", i+1, locked)
+        }
+        wait, err := th.Check("user-1", "192.0.2.1", now)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if wait != want {
+            t.Fatalf("failure %d: wait %s, want %s", i+1, wait, want)
+        }
+    }
+    if wait, _ := th.Check("user-2", "192.0.2.2", now); wait != 0 {
+        t.Fatalf("other account waits %s", wait)
+    }
+    if wait, _ := th.Check("user-1", "192.0.2.1", now.Add(16*time.Minute)); wait != 0 {
+        t.Fatalf("lockout did not expire, wait %s", wait)
+    }
+
+    if err := th.Succeed("user-1"); err != nil {
+        t.Fatal(err)
+    }
+    if wait, _ := th.Check("user-1", "192.0.2.3", now); wait != 0 {
+        t.Fatalf("lockout survived a successful login, wait %s", wait)
+    }
+}
+
+func TestLoginLockoutKeyedByUserID(t *testing.T) {
+    db := newTestDB(t)
+    siswa := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    a := newTestAuthController(db)
+    a.Throttle = newTestThrottle(newMemoryAttemptStore(15 * time.Minute))
+    // no backoff before the lockout, which would answer 429 before the fifth failure
+    a.Throttle.Account.FreeAttempts = a.Throttle.Account.MaxFailures
+    login := func(email, password string) int {
+        return callHandler(a.Login, http.MethodPost, "/api/v1/auth/login", loginBody(t, email, password, ""), nil).Code
+    }
+
+    for i := 0; i < 5; i++ {
+        if code := login(siswa.Email, "salah"); code != http.StatusUnauthorized {
+            t.Fatalf("failure %d: got %d, want 401", i+1, code)
+        }
+    }
+    rec, err := a.Throttle.Store.Get(throttleKindAccount, siswa.ID)
+    if err != nil || rec == nil || !rec.LockedOut {
+        t.Fatalf("account counter %+v (%v), want a lockout keyed by user id", rec, err)
+    }
+    if rec, _ := a.Throttle.Store.Get(throttleKindAccount, throttleSubject(siswa.Email)); rec != nil {
+        t.Fatalf("known account also counted by email: %+v", rec)
+    }
+    if code := login(siswa.Email, "rahasia123"); code != http.StatusTooManyRequests {
+        t.Fatalf("locked account: got %d, want 429", code)
+    }
+
+    if code := login("ghost@school.test", "salah"); code != http.StatusUnauthorized {
+        t.Fatalf("unknown account: got %d, want 401", code)
+    }
+    if rec, _ := a.Throttle.Store.Get(throttleKindAccount, "ghost@school.test"); rec == nil {
+        t.Fatal("unknown identifier was not counted by itself")
+    }
+
+    lc := &LoginLockoutController{DB: db, Throttle: a.Throttle}
+    w := callHandler(lc.UnlockUser, http.MethodPost, "/", "", nil, gin.Param{Key: "user_id", Value: siswa.ID})
+    if w.Code != http.StatusOK {
+        t.Fatalf("unlock: %d %s", w.Code, w.Body.String())
+    }
+    if code := login(siswa.Email, "rahasia123"); code != http.StatusOK {
+        t.Fatalf("after unlock: got %d, want 200", code)
+    }
+}
+
+func TestDBAttemptStorePrunesExpiredRows(t *testing.T) {
+    db := newTestDB(t)
+    store := &dbAttemptStore{db: db, ttl: 15 * time.Minute}
+    now := time.Now().UTC()
+    old := now.Add(-time.Hour)
+    blocked := now.Add(time.Hour)
+    mustCreate(t, db, &models.LoginAttempt{Kind: throttleKindAccount, Subject: "idle", Failures: 2, LastFailureAt: old})
+    mustCreate(t, db, &models.LoginAttempt{Kind: throttleKindAccount, Subject: "locked", Failures: 5, LastFailureAt: old, BlockedUntil: &blocked, LockedOut: true})
+
+    if _, err := store.Update(throttleKindIP, "192.0.2.1", func(rec *models.LoginAttempt) { rec.Failures++ }); err != nil {
+        t.Fatal(err)
+    }
+    var subjects []string
+    if err := db.Model(&models.LoginAttempt{}).Order("subject").Pluck("subject", &subjects).Error; err != nil {
+        t.Fatal(err)
+    }
+    if len(subjects) != 2 || subjects[0] != "192.0.2.1" || subjects[1] != "locked" {
+        t.Fatalf("rows after prune: %v, want [192.0.2.1 locked]", subjects)
+    }
+}
+
+func TestLoginThrottleSharedByEmailAndUsername(t *testing.T) {
+    db := newTestDB(t)
+    siswa := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Username: "12345", Role: "siswa"}, "rahasia123")
+    a := newTestAuthController(db)
+    a.Throttle = newTestThrottle(newMemoryAttemptStore(15 * time.Minute))
+    a.Throttle.Account.FreeAttempts = a.Throttle.Account.MaxFailures
+    login := func(identifier, password string) int {
+        return callHandler(a.Login, http.MethodPost, "/api/v1/auth/login", loginBody(t, identifier, password, ""), nil).Code
+    }
+
+    // alternating identifiers must not double the budget
+    for i, identifier := range []string{"budi@school.test", "12345", "budi@school.test", "12345", "12345"} {
+        if code := login(identifier, "salah"); code != http.StatusUnauthorized {
+            t.Fatalf("failure %d: got %d, want 401", i+1, code)
+        }
+    }
+    for _, identifier := range []string{"budi@school.test", "12345"} {
+        if code := login(identifier, "rahasia123"); code != http.StatusTooManyRequests {
+            t.Fatalf("%s: got %d, want 429", identifier, code)
+        }
+    }
+    if rec, _ := a.Throttle.Store.Get(throttleKindAccount, siswa.ID); rec == nil || rec.Failures != 5 {
+        t.Fatalf("account counter %+v, want 5 failures", rec)
+    }
+}
@@ -3,12 +3,13 @@ package controllers
 import (
     "errors"
     "fmt"
+    "io"
     "net/http"
     "strconv"
     "strings"
 
     "github.com/gin-gonic/gin"
-    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v5/pgconn"
     "gorm.io/gorm"
 
     "github.com/zaqqye/seb_backend_v1/internal/models"
@@ -29,7 +30,7 @@ type updateMajorRequest struct {
 }
 
 func (mc *MajorController) ListMajors(c *gin.Context) {
-    // Pagination/sort/filter: limit, page, all, sort_by, sort_dir, q
+    // Pagination/sort/filter: limit, page, all, sort_by, sort_dir, q, include_deleted
     all := strings.EqualFold(c.Query("all"), "true") || c.Query("all") == "1"
     limit := 50
     page := 1
@@ -64,7 +65,11 @@ func (mc *MajorController) ListMajors(c *gin.Context) {
     // Filters
     qText := strings.TrimSpace(c.Query("q"))
 
+    withDeleted := includeDeleted(c)
     base := mc.DB.Model(&models.Major{})
+    if withDeleted {
+        base = base.Unscoped()
+    }
     if qText != "" {
         like := "%" + qText + "%"
         base = base.Where("code ILIKE ? OR name ILIKE ?", like, like)
@@ -78,6 +83,9 @@ func (mc *MajorController) ListMajors(c *gin.Context) {
 
     var majors []models.Major
     listQ := mc.DB.Order(order)
+    if withDeleted {
+        listQ = listQ.Unscoped()
+    }
     if qText != "" {
         like := "%" + qText + "%"
         listQ = listQ.Where("code ILIKE ? OR name ILIKE ?", like, like)
@@ -93,13 +101,17 @@ func (mc *MajorController) ListMajors(c *gin.Context) {
 
     out := make([]gin.H, 0, len(majors))
     for _, m := range majors {
-        out = append(out, gin.H{
+        entry := gin.H{
             "id":         m.ID,
             "code":       m.Code,
             "name":       m.Name,
             "created_at": m.CreatedAt,
             "updated_at": m.UpdatedAt,
-        })
+        }
+        if withDeleted {
+            entry["deleted_at"] = m.DeletedAt
+        }
+        out = append(out, entry)
     }
     meta := gin.H{"total": total, "all": all}
     if !all {
@@ -171,7 +183,13 @@ func (mc *MajorController) UpdateMajor(c *gin.Context) {
     if req.Name != nil {
         m.Name = *req.Name
     }
-    if err := mc.DB.Save(&m).Error; err != nil {
+    if err := mc.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&m).Error; err != nil {
+            return err
+        }
+        // Keep the jurusan mirror of linked users in step with the code
+        return tx.Model(&models.User{}).Where("major_id_ref = ?", m.ID).Update("jurusan", m.Code).Error
+    }); err != nil {
         var pgErr *pgconn.PgError
         if errors.As(err, &pgErr) && pgErr.Code == "23505" {
             c.JSON(http.StatusConflict, gin.H{"error": "major code already exists"})
@@ -189,9 +207,150 @@ func (mc *MajorController) DeleteMajor(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
         return
     }
-    if err := mc.DB.Where("id = ?", id).Delete(&models.Major{}).Error; err != nil {
+    if permanentDelete(c) {
+        deleteWithDependencies(c, mc.DB, "major", &models.Major{}, id, majorDependencies)
+        return
+    }
+    softDelete(c, mc.DB, "major", &models.Major{}, id, "", nil)
+}
+
+// RestoreMajor undoes a soft delete.
+func (mc *MajorController) RestoreMajor(c *gin.Context) {
+    restoreDeleted(c, mc.DB, "major", &models.Major{}, strings.TrimSpace(c.Param("id")), "")
+}
+
+type reconcileUsersRequest struct {
+    Apply         bool `json:"apply"`
+    CreateMissing bool `json:"create_missing"` // create a major for every unmatched value (with apply)
+}
+
+type reconcileMatch struct {
+    Value     string      `json:"value"`
+    Users     int64       `json:"users"`
+    MatchedBy string      `json:"matched_by"`
+    Major     interface{} `json:"major"`
+}
+
+type reconcileUnmatched struct {
+    Value  string `json:"value"`
+    Users  int64  `json:"users"`
+    Reason string `json:"reason"`
+}
+
+// ReconcileUsers links users that only have a free-text jurusan to the major whose
+// code or name matches (case-insensitive). Without {"apply": true} it only reports.
+func (mc *MajorController) ReconcileUsers(c *gin.Context) {
+    var req reconcileUsersRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
         c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
-    c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+
+    type valueRow struct {
+        Value  string
+        Sample string
+        Users  int64
+    }
+    var values []valueRow
+    if err := mc.DB.Model(&models.User{}).
+        Select("LOWER(TRIM(jurusan)) AS value, MIN(TRIM(jurusan)) AS sample, COUNT(*) AS users").
+        Where("major_id_ref IS NULL AND TRIM(jurusan) <> ''").
+        Group("LOWER(TRIM(jurusan))").
+        Order("value").
+        Scan(&values).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    var majors []models.Major
+    if err := mc.DB.Find(&majors).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    byCode := map[string]*models.Major{}
+    byName := map[string][]*models.Major{}
+    for i := range majors {
+        m := &majors[i]
+        byCode[strings.ToLower(strings.TrimSpace(m.Code))] = m
+        name := strings.ToLower(strings.TrimSpace(m.Name))
+        byName[name] = append(byName[name], m)
+    }
+
+    type link struct {
+        value string
+        major *models.Major
+    }
+    var links []link
+    matched := []reconcileMatch{}
+    unmatched := []reconcileUnmatched{}
+    var toCreate []valueRow
+    for _, v := range values {
+        if m, ok := byCode[v.Value]; ok {
+            links = append(links, link{v.Value, m})
+            matched = append(matched, reconcileMatch{Value: v.Sample, Users: v.Users, MatchedBy: "code", Major: majorBlock(m)})
+            continue
+        }
+        switch named := byName[v.Value]; len(named) {
+        case 1:
+            links = append(links, link{v.Value, named[0]})
+            matched = append(matched, reconcileMatch{Value: v.Sample, Users: v.Users, MatchedBy: "name", Major: majorBlock(named[0])})
+        case 0:
+            if req.CreateMissing {
+                toCreate = append(toCreate, v)
+                continue
+            }
+            unmatched = append(unmatched, reconcileUnmatched{Value: v.Sample, Users: v.Users, Reason: "no major with this code or name"})
+        default:
+            unmatched = append(unmatched, reconcileUnmatched{Value: v.Sample, Users: v.Users, Reason: "name matches several majors"})
+        }
+    }
+
+    created := 0
+    if req.Apply {
+        if err := mc.DB.Transaction(func(tx *gorm.DB) error {
+            for _, v := range toCreate {
+                m := &models.Major{Code: v.Sample, Name: v.Sample}
+                if err := tx.Create(m).Error; err != nil {
+                    return err
+                }
+                created++
+                links = append(links, link{v.Value, m})
+                matched = append(matched, reconcileMatch{Value: v.Sample, Users: v.Users, MatchedBy: "created", Major: majorBlock(m)})
+            }
+            for _, l := range links {
+                if err := tx.Model(&models.User{}).
+                    Where("major_id_ref IS NULL AND LOWER(TRIM(jurusan)) = ?", l.value).
+                    Updates(map[string]interface{}{"major_id_ref": l.major.ID, "jurusan": l.major.Code}).Error; err != nil {
+                    return err
+                }
+            }
+            return nil
+        }); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    } else {
+        for _, v := range toCreate {
+            matched = append(matched, reconcileMatch{Value: v.Sample, Users: v.Users, MatchedBy: "create", Major: gin.H{"code": v.Sample, "name": v.Sample}})
+        }
+    }
+
+    var matchedUsers, unmatchedUsers int64
+    for _, m := range matched {
+        matchedUsers += m.Users
+    }
+    for _, u := range unmatched {
+        unmatchedUsers += u.Users
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "dry_run": !req.Apply,
+        "summary": gin.H{
+            "matched_values":   len(matched),
+            "matched_users":    matchedUsers,
+            "unmatched_values": len(unmatched),
+            "unmatched_users":  unmatchedUsers,
+            "created_majors":   created,
+        },
+        "matched":   matched,
+        "unmatched": unmatched,
+    })
 }
@@ -26,7 +26,7 @@ func (mc *MonitoringController) allowedRoomIDsFor(user models.User) ([]string, b
     }
     if user.Role == "pengawas" {
         var m []models.RoomSupervisor
-        if err := mc.DB.Where("user_id_ref = ?", user.ID).Find(&m).Error; err != nil {
+        if err := mc.DB.Where("user_id_ref = ?", user.ID).Where(models.CurrentTermCond("term_id_ref")).Find(&m).Error; err != nil {
             return nil, false, err
         }
         ids := make([]string, 0, len(m))
@@ -36,6 +36,19 @@ func (mc *MonitoringController) allowedRoomIDsFor(user models.User) ([]string, b
     return []string{}, false, nil
 }
 
+// supervisesStudent reports whether the pengawas supervises a room the student sits in
+// during the active term.
+func (mc *MonitoringController) supervisesStudent(actorID, studentID string) (bool, error) {
+    var count int64
+    sub := mc.DB.Table("room_supervisors").Select("room_id_ref").
+        Where("user_id_ref = ? AND deleted_at IS NULL", actorID).Where(models.CurrentTermCond("term_id_ref"))
+    if err := mc.DB.Table("room_students").Where("user_id_ref = ? AND room_id_ref IN (?) AND deleted_at IS NULL", studentID, sub).
+        Where(models.CurrentTermCond("term_id_ref")).Count(&count).Error; err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
 // ListStudents returns monitoring rows scoped by role.
 func (mc *MonitoringController) ListStudents(c *gin.Context) {
     uVal, _ := c.Get("user")
@@ -58,6 +71,7 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
         "kelas":             "u.kelas",
         "jurusan":           "u.jurusan",
         "locked":            "ss.locked",
+        "unauthorized_unlock": "ss.unauthorized_unlock",
         // legacy alias; handled specially below
         "updated_at":        "",
     }
@@ -90,8 +104,12 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
         BlockedFromExam      bool       `gorm:"column:blocked_from_exam"`
         ForceLogoutAt        *time.Time `gorm:"column:force_logout_at"`
         MonitoringUpdatedAt  *time.Time `gorm:"column:monitoring_updated_at"`
+        UnauthorizedUnlock   bool       `gorm:"column:unauthorized_unlock"`
+        UnauthorizedUnlockAt *time.Time `gorm:"column:unauthorized_unlock_at"`
         RoomID               *string    `gorm:"column:room_id"`
         RoomName             *string    `gorm:"column:room_name"`
+        SeatRow              *int       `gorm:"column:seat_row"`
+        SeatColumn           *int       `gorm:"column:seat_column"`
     }
 
     applyFilters := func(q *gorm.DB) *gorm.DB {
@@ -104,7 +122,7 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
             return q.Where("1 = 0")
         }
         // Scope via join to room_supervisors to keep indices usable (avoid ::text casts)
-        q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = rs.room_id_ref AND sup.user_id_ref = ?", user.ID)
+        q = q.Joins("JOIN room_supervisors sup ON sup.room_id_ref = rs.room_id_ref AND sup.user_id_ref = ? AND sup.deleted_at IS NULL AND "+models.CurrentTermCond("sup.term_id_ref"), user.ID)
     }
         if roomID != "" {
             q = q.Where("rs.room_id_ref = ?", roomID)
@@ -125,12 +143,16 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
             COALESCE(ss.blocked_from_exam, FALSE) AS blocked_from_exam,
             ss.force_logout_at AS force_logout_at,
             COALESCE(ss.updated_at, u.updated_at) AS monitoring_updated_at,
+            COALESCE(ss.unauthorized_unlock, FALSE) AS unauthorized_unlock,
+            ss.unauthorized_unlock_at AS unauthorized_unlock_at,
             r.id AS room_id,
-            r.name AS room_name`).
+            r.name AS room_name,
+            rs.seat_row AS seat_row,
+            rs.seat_column AS seat_column`).
         Joins("LEFT JOIN student_statuses ss ON ss.user_id_ref = u.id").
-        Joins("LEFT JOIN room_students rs ON rs.user_id_ref = u.id").
+        Joins(studentRoomJoin).
         Joins("LEFT JOIN rooms r ON r.id = rs.room_id_ref").
-        Where("u.role = ?", "siswa")
+        Where("u.role = ? AND u.deleted_at IS NULL", "siswa")
     base = applyFilters(base)
     if !isAdmin && len(allowedRooms) == 0 {
         c.JSON(http.StatusOK, gin.H{"data": []any{}, "meta": gin.H{"total": 0, "all": all}})
@@ -139,8 +161,8 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
 
     countQ := mc.DB.Table("users AS u").
         Joins("LEFT JOIN student_statuses ss ON ss.user_id_ref = u.id").
-        Joins("LEFT JOIN room_students rs ON rs.user_id_ref = u.id").
-        Where("u.role = ?", "siswa")
+        Joins(studentRoomJoin).
+        Where("u.role = ? AND u.deleted_at IS NULL", "siswa")
     countQ = applyFilters(countQ)
 
     var total int64
@@ -167,23 +189,37 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
         BlockedFromExam bool       `json:"blocked_from_exam"`
         ForceLogoutAt   *time.Time `json:"force_logout_at"`
         UpdatedAt       *time.Time `json:"updated_at"`
+        UnauthorizedUnlock   bool       `json:"unauthorized_unlock"`
+        UnauthorizedUnlockAt *time.Time `json:"unauthorized_unlock_at"`
     }
     type roomBlock struct {
-        ID       string `json:"id"`
-        RoomName string `json:"room_name"`
+        ID         string `json:"id"`
+        RoomName   string `json:"room_name"`
+        SeatRow    *int   `json:"seat_row"`
+        SeatColumn *int   `json:"seat_column"`
     }
     type response struct {
-        ID         string          `json:"id"`
-        FullName   string          `json:"full_name"`
-        Email      string          `json:"email"`
-        Kelas      string          `json:"kelas"`
-        Jurusan    string          `json:"jurusan"`
-        Monitoring monitoringBlock `json:"monitoring"`
-        Room       roomBlock       `json:"room"`
+        ID         string             `json:"id"`
+        FullName   string             `json:"full_name"`
+        Email      string             `json:"email"`
+        Kelas      string             `json:"kelas"`
+        Jurusan    string             `json:"jurusan"`
+        Monitoring monitoringBlock    `json:"monitoring"`
+        Room       roomBlock          `json:"room"`
+        Quiz       *ws.MonitoringQuiz `json:"quiz"`
     }
 
+    userIDs := make([]string, 0, len(rows))
+    for _, r := range rows { userIDs = append(userIDs, r.UserID) }
+    attempts, err := currentQuizAttempts(mc.DB, userIDs)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+    }
+    now := time.Now().UTC()
+
     data := make([]response, 0, len(rows))
     for _, r := range rows {
+        attempt, hasAttempt := attempts[r.UserID]
         data = append(data, response{
             ID:       r.UserID,
             FullName: r.FullName,
@@ -197,11 +233,16 @@ func (mc *MonitoringController) ListStudents(c *gin.Context) {
                 BlockedFromExam: r.BlockedFromExam,
                 ForceLogoutAt:   r.ForceLogoutAt,
                 UpdatedAt:       r.MonitoringUpdatedAt,
+                UnauthorizedUnlock:   r.UnauthorizedUnlock,
+                UnauthorizedUnlockAt: r.UnauthorizedUnlockAt,
             },
             Room: roomBlock{
-                ID:       strOrEmpty(r.RoomID),
-                RoomName: strOrEmpty(r.RoomName),
+                ID:         strOrEmpty(r.RoomID),
+                RoomName:   strOrEmpty(r.RoomName),
+                SeatRow:    r.SeatRow,
+                SeatColumn: r.SeatColumn,
             },
+            Quiz: quizSnapshot(attempt, hasAttempt, now),
         })
     }
 
@@ -223,24 +264,18 @@ func (mc *MonitoringController) ForceLogout(c *gin.Context) {
 
     // Scope check for pengawas
     if actor.Role == "pengawas" {
-        var count int64
-        mc.DB.Table("room_students").Where("user_id_ref = ? AND room_id_ref IN (?)", target.ID, mc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ?", actor.ID)).Count(&count)
-        if count == 0 { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this student"}); return }
+        ok, err := mc.supervisesStudent(actor.ID, target.ID)
+        if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return }
+        if !ok { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this student"}); return }
     }
 
     now := time.Now().UTC()
-    var st models.StudentStatus
-    if err := mc.DB.Where("user_id_ref = ?", target.ID).First(&st).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
-            st = models.StudentStatus{UserIDRef: target.ID, BlockedFromExam: true, ForceLogoutAt: &now}
-            if err := mc.DB.Create(&st).Error; err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-        } else { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-    } else {
+    if _, err := updateStudentStatus(mc.DB, mc.Hubs, target.ID, func(st *models.StudentStatus) error {
         st.BlockedFromExam = true
         st.ForceLogoutAt = &now
         st.Locked = false
-        if err := mc.DB.Save(&st).Error; err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-    }
+        return nil
+    }); err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
     c.JSON(http.StatusOK, gin.H{"message": "student logged out and blocked"})
     go broadcastStudentStatus(mc.DB, mc.Hubs, target.ID)
 }
@@ -257,21 +292,174 @@ func (mc *MonitoringController) AllowExam(c *gin.Context) {
     if strings.ToLower(target.Role) != "siswa" { c.JSON(http.StatusBadRequest, gin.H{"error": "target is not siswa"}); return }
 
     if actor.Role == "pengawas" {
-        var count int64
-        mc.DB.Table("room_students").Where("user_id_ref = ? AND room_id_ref IN (?)", target.ID, mc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ?", actor.ID)).Count(&count)
-        if count == 0 { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this student"}); return }
+        ok, err := mc.supervisesStudent(actor.ID, target.ID)
+        if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return }
+        if !ok { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this student"}); return }
     }
 
-    var st models.StudentStatus
-    if err := mc.DB.Where("user_id_ref = ?", target.ID).First(&st).Error; err != nil {
-        if err == gorm.ErrRecordNotFound {
-            st = models.StudentStatus{UserIDRef: target.ID, BlockedFromExam: false}
-            if err := mc.DB.Create(&st).Error; err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-        } else { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-    } else {
+    if _, err := updateStudentStatus(mc.DB, mc.Hubs, target.ID, func(st *models.StudentStatus) error {
         st.BlockedFromExam = false
-        if err := mc.DB.Save(&st).Error; err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
-    }
+        st.UnauthorizedUnlock = false
+        return nil
+    }); err != nil { c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return }
     c.JSON(http.StatusOK, gin.H{"message": "student allowed to start exam"})
     go broadcastStudentStatus(mc.DB, mc.Hubs, target.ID)
 }
+
+// ListAlerts returns raised alerts; pengawas only see alerts for rooms they supervise.
+// Query params: limit, page, all, type, user_id, room_id, acknowledged (true|false|all, default false).
+func (mc *MonitoringController) ListAlerts(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    user := uVal.(models.User)
+
+    all := strings.EqualFold(c.Query("all"), "true") || c.Query("all") == "1"
+    limit := 50
+    page := 1
+    if v := c.Query("limit"); v != "" { if n, err := strconv.Atoi(v); err == nil && n > 0 { limit = n } }
+    if v := c.Query("page"); v != "" { if n, err := strconv.Atoi(v); err == nil && n > 0 { page = n } }
+
+    allowedRooms, isAdmin, err := mc.allowedRoomIDsFor(user)
+    if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return }
+    if !isAdmin && len(allowedRooms) == 0 {
+        c.JSON(http.StatusOK, gin.H{"data": []any{}, "meta": gin.H{"total": 0, "all": all}})
+        return
+    }
+
+    typeFilter := strings.TrimSpace(strings.ToLower(c.Query("type")))
+    userFilter := strings.TrimSpace(c.Query("user_id"))
+    roomFilter := strings.TrimSpace(c.Query("room_id"))
+    ackFilter := strings.TrimSpace(strings.ToLower(c.DefaultQuery("acknowledged", "false")))
+
+    applyFilters := func(q *gorm.DB) *gorm.DB {
+        if !isAdmin {
+            q = q.Where("room_id_ref IN ?", allowedRooms)
+        }
+        if typeFilter != "" { q = q.Where("type = ?", typeFilter) }
+        if userFilter != "" { q = q.Where("user_id_ref = ?", userFilter) }
+        if roomFilter != "" { q = q.Where("room_id_ref = ?", roomFilter) }
+        switch ackFilter {
+        case "true", "1":
+            q = q.Where("acknowledged_at IS NOT NULL")
+        case "all":
+        default:
+            q = q.Where("acknowledged_at IS NULL")
+        }
+        return q
+    }
+
+    var total int64
+    if err := applyFilters(mc.DB.Model(&models.Alert{})).Count(&total).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+    }
+    listQ := applyFilters(mc.DB.Model(&models.Alert{})).Order("created_at DESC")
+    if !all { listQ = listQ.Offset((page-1)*limit).Limit(limit) }
+    var alerts []models.Alert
+    if err := listQ.Find(&alerts).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+    }
+
+    out := make([]gin.H, 0, len(alerts))
+    for _, a := range alerts {
+        out = append(out, gin.H{
+            "id":              a.ID,
+            "type":            a.Type,
+            "user_id":         a.UserIDRef,
+            "room_id":         a.RoomIDRef,
+            "rule_id":         a.RuleIDRef,
+            "message":         a.Message,
+            "acknowledged_at": a.AcknowledgedAt,
+            "acknowledged_by": a.AcknowledgedBy,
+            "created_at":      a.CreatedAt,
+        })
+    }
+    meta := gin.H{"total": total, "all": all}
+    if !all { meta["limit"] = limit; meta["page"] = page }
+    c.JSON(http.StatusOK, gin.H{"data": out, "meta": meta})
+}
+
+// AcknowledgeAlert marks an alert as handled by the current pengawas/admin.
+func (mc *MonitoringController) AcknowledgeAlert(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    actor := uVal.(models.User)
+    idStr := strings.TrimSpace(c.Param("id"))
+    if idStr == "" { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"}); return }
+
+    var alert models.Alert
+    if err := mc.DB.Where("id = ?", idStr).First(&alert).Error; err != nil { c.JSON(http.StatusNotFound, gin.H{"error": "alert not found"}); return }
+
+    if actor.Role == "pengawas" {
+        if alert.RoomIDRef == nil { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this alert"}); return }
+        var count int64
+        if err := mc.DB.Model(&models.RoomSupervisor{}).Where("user_id_ref = ? AND room_id_ref = ?", actor.ID, *alert.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).Count(&count).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+        }
+        if count == 0 { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this alert"}); return }
+    }
+
+    if alert.AcknowledgedAt == nil {
+        now := time.Now().UTC()
+        actorID := actor.ID
+        if err := mc.DB.Model(&alert).Updates(map[string]interface{}{"acknowledged_at": now, "acknowledged_by": actorID}).Error; err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+        }
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "acknowledged"})
+}
+
+// loadScopedStudent fetches a siswa by :id and checks pengawas room scope; writes the error response itself.
+func (mc *MonitoringController) loadScopedStudent(c *gin.Context) (models.User, bool) {
+    uVal, _ := c.Get("user")
+    actor := uVal.(models.User)
+    var target models.User
+    idStr := strings.TrimSpace(c.Param("id"))
+    if idStr == "" { c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"}); return target, false }
+    if err := mc.DB.Where("id = ?", idStr).First(&target).Error; err != nil { c.JSON(http.StatusNotFound, gin.H{"error": "user not found"}); return target, false }
+    if strings.ToLower(target.Role) != "siswa" { c.JSON(http.StatusBadRequest, gin.H{"error": "target is not siswa"}); return target, false }
+    if actor.Role == "pengawas" {
+        ok, err := mc.supervisesStudent(actor.ID, target.ID)
+        if err != nil { c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return target, false }
+        if !ok { c.JSON(http.StatusForbidden, gin.H{"error": "not allowed for this student"}); return target, false }
+    }
+    return target, true
+}
+
+// ListDevices returns the devices a student has logged in from and the current binding.
+func (mc *MonitoringController) ListDevices(c *gin.Context) {
+    target, ok := mc.loadScopedStudent(c)
+    if !ok { return }
+
+    var devices []models.Device
+    if err := mc.DB.Where("user_id_ref = ?", target.ID).Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()}); return
+    }
+    var binding gin.H
+    var b models.DeviceBinding
+    if err := mc.DB.Where("user_id_ref = ?", target.ID).First(&b).Error; err == nil {
+        active := b.ExpiresAt == nil || time.Now().UTC().Before(*b.ExpiresAt)
+        binding = gin.H{"device_id": b.DeviceIDRef, "bound_at": b.BoundAt, "expires_at": b.ExpiresAt, "active": active}
+    }
+    out := make([]gin.H, 0, len(devices))
+    for _, d := range devices {
+        out = append(out, gin.H{
+            "id":            d.ID,
+            "device_id":     d.DeviceID,
+            "platform":      d.Platform,
+            "model":         d.Model,
+            "os_version":    d.OSVersion,
+            "app_version":   d.AppVersion,
+            "first_seen_at": d.FirstSeenAt,
+            "last_seen_at":  d.LastSeenAt,
+        })
+    }
+    c.JSON(http.StatusOK, gin.H{"data": out, "binding": binding})
+}
+
+// ResetDeviceBinding removes the student's device binding so the next login binds a new device.
+func (mc *MonitoringController) ResetDeviceBinding(c *gin.Context) {
+    target, ok := mc.loadScopedStudent(c)
+    if !ok { return }
+    if err := mc.DB.Where("user_id_ref = ?", target.ID).Delete(&models.DeviceBinding{}).Error; err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()}); return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "device binding reset"})
+}
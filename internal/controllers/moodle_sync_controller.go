@@ -0,0 +1,656 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/moodle"
+)
+
+const moodleSyncTimeout = 2 * time.Minute
+
+// Course roles that make an enrolled Moodle user a pengawas; everyone else is siswa.
+var moodleStaffRoles = map[string]bool{"manager": true, "editingteacher": true, "teacher": true}
+
+// MoodleSyncController reconciles users, rooms and majors with Moodle. Every run
+// builds a plan from the current Moodle data; it is only written with apply=true.
+type MoodleSyncController struct {
+    DB          *gorm.DB
+    Client      *moodle.Client
+    CourseIDs   []int64
+    CriteriaKey string
+    CriteriaVal string
+    RoomPrefix  string
+    MajorPrefix string
+    Cfg         *config.Config
+
+    running sync.Mutex
+}
+
+func NewMoodleSyncController(db *gorm.DB, cfg *config.Config) *MoodleSyncController {
+    mc := &MoodleSyncController{
+        DB:          db,
+        Client:      moodle.NewClient(cfg.MoodleURL, cfg.MoodleWSToken),
+        CriteriaKey: "email",
+        CriteriaVal: "%",
+        RoomPrefix:  strings.TrimSpace(cfg.MoodleRoomCohortPrefix),
+        MajorPrefix: strings.TrimSpace(cfg.MoodleMajorCohortPrefix),
+        Cfg:         cfg,
+    }
+    for _, s := range strings.Split(cfg.MoodleSyncCourseIDs, ",") {
+        if id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil && id > 0 {
+            mc.CourseIDs = append(mc.CourseIDs, id)
+        }
+    }
+    if k, v, ok := strings.Cut(cfg.MoodleSyncUserCriteria, "="); ok && strings.TrimSpace(k) != "" {
+        mc.CriteriaKey, mc.CriteriaVal = strings.TrimSpace(k), strings.TrimSpace(v)
+    }
+    return mc
+}
+
+type syncFieldChange struct {
+    From interface{} `json:"from"`
+    To   interface{} `json:"to"`
+}
+
+type syncUser struct {
+    UserID       string                     `json:"user_id,omitempty"`
+    MoodleUserID int64                      `json:"moodle_user_id"`
+    FullName     string                     `json:"full_name"`
+    Email        string                     `json:"email"`
+    Username     string                     `json:"username"`
+    Role         string                     `json:"role"`
+    Jurusan      string                     `json:"jurusan,omitempty"`
+    Active       bool                       `json:"active"`
+    Changes      map[string]syncFieldChange `json:"changes,omitempty"`
+}
+
+type syncRoom struct {
+    RoomID   string `json:"room_id,omitempty"`
+    Name     string `json:"name"`
+    CohortID int64  `json:"cohort_id"`
+}
+
+type syncMajor struct {
+    MajorID string `json:"major_id,omitempty"`
+    Code    string `json:"code"`
+    Name    string `json:"name"`
+    OldName string `json:"old_name,omitempty"`
+}
+
+type syncAssignment struct {
+    RoomID       string `json:"room_id,omitempty"`
+    RoomName     string `json:"room_name"`
+    UserID       string `json:"user_id,omitempty"`
+    MoodleUserID int64  `json:"moodle_user_id,omitempty"`
+    FullName     string `json:"full_name"`
+}
+
+type syncSkip struct {
+    MoodleUserID int64  `json:"moodle_user_id"`
+    Username     string `json:"username"`
+    Reason       string `json:"reason"`
+}
+
+// moodleSyncPlan is the diff between Moodle and the local data.
+type moodleSyncPlan struct {
+    CreateUsers      []syncUser       `json:"create_users"`
+    UpdateUsers      []syncUser       `json:"update_users"`
+    CreateRooms      []syncRoom       `json:"create_rooms"`
+    CreateMajors     []syncMajor      `json:"create_majors"`
+    UpdateMajors     []syncMajor      `json:"update_majors"`
+    AssignStudents   []syncAssignment `json:"assign_students"`
+    UnassignStudents []syncAssignment `json:"unassign_students"`
+    Skipped          []syncSkip       `json:"skipped"`
+}
+
+func (p *moodleSyncPlan) summary() gin.H {
+    return gin.H{
+        "create_users":      len(p.CreateUsers),
+        "update_users":      len(p.UpdateUsers),
+        "create_rooms":      len(p.CreateRooms),
+        "create_majors":     len(p.CreateMajors),
+        "update_majors":     len(p.UpdateMajors),
+        "assign_students":   len(p.AssignStudents),
+        "unassign_students": len(p.UnassignStudents),
+        "skipped":           len(p.Skipped),
+    }
+}
+
+type moodleSyncSource struct {
+    User moodle.User
+    Role string
+}
+
+// fetchUsers returns the Moodle users to sync: enrolled users of the configured
+// courses (with their role mapped), or site users matching the criterion as siswa.
+// Site mode cannot tell staff from students, so it only manages siswa (see buildPlan).
+func (mc *MoodleSyncController) fetchUsers(ctx context.Context) ([]moodleSyncSource, error) {
+    byID := map[int64]*moodleSyncSource{}
+    if len(mc.CourseIDs) > 0 {
+        for _, courseID := range mc.CourseIDs {
+            users, err := mc.Client.EnrolledUsers(ctx, courseID)
+            if err != nil {
+                return nil, err
+            }
+            for _, u := range users {
+                src, ok := byID[u.ID]
+                if !ok {
+                    src = &moodleSyncSource{User: u, Role: "siswa"}
+                    byID[u.ID] = src
+                }
+                for _, r := range u.Roles {
+                    if moodleStaffRoles[r.ShortName] {
+                        src.Role = "pengawas"
+                    }
+                }
+            }
+        }
+    } else {
+        users, err := mc.Client.GetUsers(ctx, mc.CriteriaKey, mc.CriteriaVal)
+        if err != nil {
+            return nil, err
+        }
+        for _, u := range users {
+            byID[u.ID] = &moodleSyncSource{User: u, Role: "siswa"}
+        }
+    }
+    out := make([]moodleSyncSource, 0, len(byID))
+    for _, src := range byID {
+        if strings.EqualFold(src.User.Username, "guest") {
+            continue
+        }
+        out = append(out, *src)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].User.ID < out[j].User.ID })
+    return out, nil
+}
+
+// moodleSnapshot is everything the sync reads from Moodle.
+type moodleSnapshot struct {
+    Sources      []moodleSyncSource
+    RoomCohorts  []moodle.Cohort
+    MajorCohorts []moodle.Cohort
+    Members      map[int64][]int64
+}
+
+func (mc *MoodleSyncController) fetchSnapshot(ctx context.Context) (*moodleSnapshot, error) {
+    sources, err := mc.fetchUsers(ctx)
+    if err != nil {
+        return nil, err
+    }
+    cohorts, err := mc.Client.Cohorts(ctx)
+    if err != nil {
+        return nil, err
+    }
+    var roomCohorts, majorCohorts []moodle.Cohort
+    var cohortIDs []int64
+    for _, ch := range cohorts {
+        idn := strings.TrimSpace(ch.IDNumber)
+        switch {
+        case mc.RoomPrefix != "" && hasPrefixFold(idn, mc.RoomPrefix) && strings.TrimSpace(ch.Name) != "":
+            roomCohorts = append(roomCohorts, ch)
+        case mc.MajorPrefix != "" && hasPrefixFold(idn, mc.MajorPrefix) && strings.TrimSpace(idn[len(mc.MajorPrefix):]) != "":
+            majorCohorts = append(majorCohorts, ch)
+        default:
+            continue
+        }
+        cohortIDs = append(cohortIDs, ch.ID)
+    }
+    sort.Slice(roomCohorts, func(i, j int) bool { return roomCohorts[i].Name < roomCohorts[j].Name })
+    sort.Slice(majorCohorts, func(i, j int) bool { return majorCohorts[i].IDNumber < majorCohorts[j].IDNumber })
+    members, err := mc.Client.CohortMembers(ctx, cohortIDs...)
+    if err != nil {
+        return nil, err
+    }
+    return &moodleSnapshot{Sources: sources, RoomCohorts: roomCohorts, MajorCohorts: majorCohorts, Members: members}, nil
+}
+
+// buildPlan compares a Moodle snapshot with the local tables. Existing users keep
+// their role; admins are never touched, and in site mode neither is other staff. Rooms mapped from cohorts are fully managed by the sync (students
+// missing from the cohort are unassigned).
+func (mc *MoodleSyncController) buildPlan(snap *moodleSnapshot) (*moodleSyncPlan, error) {
+    members := snap.Members
+    var users []models.User
+    if err := mc.DB.Find(&users).Error; err != nil {
+        return nil, err
+    }
+    byMoodle := map[int64]*models.User{}
+    byEmail := map[string]*models.User{}
+    byUsername := map[string]*models.User{}
+    byID := map[string]*models.User{}
+    for i := range users {
+        u := &users[i]
+        byID[u.ID] = u
+        if u.MoodleUserID != nil {
+            byMoodle[*u.MoodleUserID] = u
+        }
+        if u.Email != "" {
+            byEmail[strings.ToLower(u.Email)] = u
+        }
+        if u.Username != "" {
+            byUsername[strings.ToLower(u.Username)] = u
+        }
+    }
+    var rooms []models.Room
+    if err := mc.DB.Find(&rooms).Error; err != nil {
+        return nil, err
+    }
+    roomsByName := map[string]models.Room{}
+    for _, r := range rooms {
+        roomsByName[strings.ToLower(r.Name)] = r
+    }
+    var majors []models.Major
+    if err := mc.DB.Find(&majors).Error; err != nil {
+        return nil, err
+    }
+    majorsByCode := map[string]models.Major{}
+    for _, m := range majors {
+        majorsByCode[strings.ToLower(m.Code)] = m
+    }
+
+    plan := &moodleSyncPlan{
+        CreateUsers:      []syncUser{},
+        UpdateUsers:      []syncUser{},
+        CreateRooms:      []syncRoom{},
+        CreateMajors:     []syncMajor{},
+        UpdateMajors:     []syncMajor{},
+        AssignStudents:   []syncAssignment{},
+        UnassignStudents: []syncAssignment{},
+        Skipped:          []syncSkip{},
+    }
+
+    // Majors first: membership decides the jurusan of each user
+    jurusanByMoodle := map[int64]string{}
+    for _, ch := range snap.MajorCohorts {
+        code := strings.TrimSpace(strings.TrimSpace(ch.IDNumber)[len(mc.MajorPrefix):])
+        name := strings.TrimSpace(ch.Name)
+        if m, ok := majorsByCode[strings.ToLower(code)]; ok {
+            code = m.Code
+            if name != "" && m.Name != name {
+                plan.UpdateMajors = append(plan.UpdateMajors, syncMajor{MajorID: m.ID, Code: m.Code, Name: name, OldName: m.Name})
+            }
+        } else {
+            plan.CreateMajors = append(plan.CreateMajors, syncMajor{Code: code, Name: name})
+            majorsByCode[strings.ToLower(code)] = models.Major{Code: code, Name: name}
+        }
+        for _, mid := range members[ch.ID] {
+            if _, set := jurusanByMoodle[mid]; !set {
+                jurusanByMoodle[mid] = code
+            }
+        }
+    }
+
+    // Users: match by linked Moodle id, then email, then username
+    localByMoodle := map[int64]string{} // "" = created by this plan
+    nameByMoodle := map[int64]string{}
+    roleByMoodle := map[int64]string{}
+    claimed := map[string]bool{} // local user ids, emails and usernames taken by this plan
+    for _, src := range snap.Sources {
+        mu := src.User
+        email := strings.ToLower(strings.TrimSpace(mu.Email))
+        username := normalizeUsername(mu.Username)
+        if !usernamePattern.MatchString(username) {
+            username = ""
+        }
+        name := mu.DisplayName()
+        skip := func(reason string) {
+            plan.Skipped = append(plan.Skipped, syncSkip{MoodleUserID: mu.ID, Username: mu.Username, Reason: reason})
+        }
+
+        local := byMoodle[mu.ID]
+        if local == nil && email != "" {
+            local = byEmail[email]
+        }
+        if local == nil && username != "" {
+            local = byUsername[username]
+        }
+        if local != nil {
+            if local.MoodleUserID != nil && *local.MoodleUserID != mu.ID {
+                skip("local user " + local.ID + " is linked to another Moodle account")
+                continue
+            }
+            if local.Role == "admin" {
+                skip("local user " + local.ID + " is an admin, not managed by the Moodle sync")
+                continue
+            }
+            if len(mc.CourseIDs) == 0 && local.Role != "siswa" {
+                skip("local user " + local.ID + " is " + local.Role + "; site mode only syncs siswa")
+                continue
+            }
+            if claimed["id:"+local.ID] {
+                skip("local user " + local.ID + " already matched another Moodle account")
+                continue
+            }
+            claimed["id:"+local.ID] = true
+            changes := map[string]syncFieldChange{}
+            if name != "" && local.FullName != name {
+                changes["full_name"] = syncFieldChange{From: local.FullName, To: name}
+            }
+            if email != "" && !strings.EqualFold(local.Email, email) {
+                if owner := byEmail[email]; (owner != nil && owner.ID != local.ID) || claimed["email:"+email] {
+                    skip("email " + email + " is used by another user, not updated")
+                } else {
+                    changes["email"] = syncFieldChange{From: local.Email, To: email}
+                    claimed["email:"+email] = true
+                }
+            }
+            if username != "" && !strings.EqualFold(local.Username, username) {
+                if owner := byUsername[username]; (owner != nil && owner.ID != local.ID) || claimed["username:"+username] {
+                    skip("username " + username + " is used by another user, not updated")
+                } else {
+                    changes["username"] = syncFieldChange{From: local.Username, To: username}
+                    claimed["username:"+username] = true
+                }
+            }
+            if active := !mu.Suspended; local.Active != active {
+                changes["active"] = syncFieldChange{From: local.Active, To: active}
+            }
+            if j := jurusanByMoodle[mu.ID]; j != "" && local.Jurusan != j {
+                changes["jurusan"] = syncFieldChange{From: local.Jurusan, To: j}
+            }
+            if local.MoodleUserID == nil {
+                changes["moodle_user_id"] = syncFieldChange{From: nil, To: mu.ID}
+            }
+            if len(changes) > 0 {
+                plan.UpdateUsers = append(plan.UpdateUsers, syncUser{
+                    UserID:       local.ID,
+                    MoodleUserID: mu.ID,
+                    FullName:     local.FullName,
+                    Email:        local.Email,
+                    Username:     local.Username,
+                    Role:         local.Role,
+                    Active:       local.Active,
+                    Changes:      changes,
+                })
+            }
+            localByMoodle[mu.ID] = local.ID
+            nameByMoodle[mu.ID] = local.FullName
+            roleByMoodle[mu.ID] = local.Role
+            continue
+        }
+
+        // New user
+        if email != "" && claimed["email:"+email] {
+            skip("email " + email + " is used by another Moodle account")
+            continue
+        }
+        if username != "" && (byUsername[username] != nil || claimed["username:"+username]) {
+            username = ""
+        }
+        if email == "" && (src.Role != "siswa" || username == "") {
+            skip("no usable email or username")
+            continue
+        }
+        if email != "" {
+            claimed["email:"+email] = true
+        }
+        if username != "" {
+            claimed["username:"+username] = true
+        }
+        plan.CreateUsers = append(plan.CreateUsers, syncUser{
+            MoodleUserID: mu.ID,
+            FullName:     name,
+            Email:        email,
+            Username:     username,
+            Role:         src.Role,
+            Jurusan:      jurusanByMoodle[mu.ID],
+            Active:       !mu.Suspended,
+        })
+        localByMoodle[mu.ID] = ""
+        nameByMoodle[mu.ID] = name
+        roleByMoodle[mu.ID] = src.Role
+    }
+
+    // Rooms: cohort members (siswa only) are the room's students
+    for _, ch := range snap.RoomCohorts {
+        name := strings.TrimSpace(ch.Name)
+        room, exists := roomsByName[strings.ToLower(name)]
+        if !exists {
+            plan.CreateRooms = append(plan.CreateRooms, syncRoom{Name: name, CohortID: ch.ID})
+            room = models.Room{Name: name}
+            roomsByName[strings.ToLower(name)] = room
+        }
+        current := map[string]bool{}
+        if room.ID != "" {
+            var ids []string
+            if err := mc.DB.Model(&models.RoomStudent{}).Where("room_id_ref = ?", room.ID).Where(models.CurrentTermCond("term_id_ref")).Pluck("user_id_ref", &ids).Error; err != nil {
+                return nil, err
+            }
+            for _, id := range ids {
+                current[id] = true
+            }
+        }
+        desired := map[string]bool{}
+        for _, mid := range members[ch.ID] {
+            localID, synced := localByMoodle[mid]
+            if !synced {
+                if u := byMoodle[mid]; u != nil {
+                    localID, synced = u.ID, true
+                    nameByMoodle[mid], roleByMoodle[mid] = u.FullName, u.Role
+                }
+            }
+            if !synced || roleByMoodle[mid] != "siswa" {
+                continue
+            }
+            if localID != "" {
+                desired[localID] = true
+                if current[localID] {
+                    continue
+                }
+            }
+            plan.AssignStudents = append(plan.AssignStudents, syncAssignment{
+                RoomID:       room.ID,
+                RoomName:     room.Name,
+                UserID:       localID,
+                MoodleUserID: mid,
+                FullName:     nameByMoodle[mid],
+            })
+        }
+        for id := range current {
+            if desired[id] {
+                continue
+            }
+            a := syncAssignment{RoomID: room.ID, RoomName: room.Name, UserID: id}
+            if u := byID[id]; u != nil {
+                a.FullName = u.FullName
+                if u.MoodleUserID != nil {
+                    a.MoodleUserID = *u.MoodleUserID
+                }
+            }
+            plan.UnassignStudents = append(plan.UnassignStudents, a)
+        }
+    }
+    return plan, nil
+}
+
+func hasPrefixFold(s, prefix string) bool {
+    return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// applyPlan writes the plan in one transaction and fills in the ids of created rows.
+// New users get no local password; issue one with the bulk password reset.
+func (mc *MoodleSyncController) applyPlan(plan *moodleSyncPlan) error {
+    return mc.DB.Transaction(func(tx *gorm.DB) error {
+        roomIDs := map[string]string{}
+        for i := range plan.CreateRooms {
+            room := models.Room{Name: plan.CreateRooms[i].Name, Active: true}
+            if err := tx.Create(&room).Error; err != nil {
+                return err
+            }
+            plan.CreateRooms[i].RoomID = room.ID
+            roomIDs[strings.ToLower(room.Name)] = room.ID
+        }
+        for i := range plan.CreateMajors {
+            m := models.Major{Code: plan.CreateMajors[i].Code, Name: plan.CreateMajors[i].Name}
+            if err := tx.Create(&m).Error; err != nil {
+                return err
+            }
+            plan.CreateMajors[i].MajorID = m.ID
+        }
+        for _, m := range plan.UpdateMajors {
+            if err := tx.Model(&models.Major{}).Where("id = ?", m.MajorID).Update("name", m.Name).Error; err != nil {
+                return err
+            }
+        }
+        var majors []models.Major
+        if err := tx.Find(&majors).Error; err != nil {
+            return err
+        }
+        majorIDs := map[string]string{}
+        for _, m := range majors {
+            majorIDs[m.Code] = m.ID
+        }
+
+        localByMoodle := map[int64]string{}
+        for i := range plan.CreateUsers {
+            su := &plan.CreateUsers[i]
+            moodleID := su.MoodleUserID
+            u := models.User{
+                FullName:     su.FullName,
+                Email:        su.Email,
+                Username:     su.Username,
+                Role:         su.Role,
+                Jurusan:      su.Jurusan,
+                Active:       su.Active,
+                MoodleUserID: &moodleID,
+            }
+            if id, ok := majorIDs[su.Jurusan]; ok && su.Jurusan != "" {
+                u.MajorIDRef = &id
+            }
+            if err := tx.Create(&u).Error; err != nil {
+                return err
+            }
+            su.UserID = u.ID
+            localByMoodle[moodleID] = u.ID
+        }
+        for _, su := range plan.UpdateUsers {
+            updates := map[string]interface{}{}
+            for field, ch := range su.Changes {
+                updates[field] = ch.To
+            }
+            if ch, ok := su.Changes["jurusan"]; ok {
+                code, _ := ch.To.(string)
+                if id, ok := majorIDs[code]; ok {
+                    updates["major_id_ref"] = id
+                }
+            }
+            if err := tx.Model(&models.User{}).Where("id = ?", su.UserID).Updates(updates).Error; err != nil {
+                return err
+            }
+            if ch, ok := su.Changes["active"]; ok && ch.To == false {
+                if err := invalidateUserTokens(tx, su.UserID); err != nil {
+                    return err
+                }
+            }
+        }
+
+        termID, err := activeTermID(tx)
+        if err != nil {
+            return err
+        }
+        single, err := singleRoomPerStudent(tx, mc.Cfg)
+        if err != nil {
+            return err
+        }
+        // Unassign first so a siswa whose cohort changed can be placed in the new room
+        for _, a := range plan.UnassignStudents {
+            if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", a.UserID, a.RoomID).Where(models.CurrentTermCond("term_id_ref")).Delete(&models.RoomStudent{}).Error; err != nil {
+                return err
+            }
+        }
+        filledRooms := map[string]bool{}
+        for i := range plan.AssignStudents {
+            a := &plan.AssignStudents[i]
+            if a.RoomID == "" {
+                a.RoomID = roomIDs[strings.ToLower(a.RoomName)]
+            }
+            if a.UserID == "" {
+                a.UserID = localByMoodle[a.MoodleUserID]
+            }
+            if a.RoomID == "" || a.UserID == "" {
+                return errors.New("unresolved assignment for room " + a.RoomName)
+            }
+            if single {
+                if err := checkSingleRoom(tx, a.UserID, a.RoomID); err != nil {
+                    return fmt.Errorf("assign %s to room %s: %w", a.FullName, a.RoomName, err)
+                }
+            }
+            rec := models.RoomStudent{UserIDRef: a.UserID, RoomIDRef: a.RoomID, TermIDRef: termID}
+            if err := tx.Where("user_id_ref = ? AND room_id_ref = ?", rec.UserIDRef, rec.RoomIDRef).Where(models.CurrentTermCond("term_id_ref")).FirstOrCreate(&rec).Error; err != nil {
+                return err
+            }
+            st := models.StudentStatus{UserIDRef: a.UserID}
+            if err := tx.Where("user_id_ref = ?", a.UserID).FirstOrCreate(&st).Error; err != nil {
+                return err
+            }
+            filledRooms[a.RoomID] = true
+        }
+        for roomID := range filledRooms {
+            if err := checkRoomCapacity(tx, roomID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+type moodleSyncRequest struct {
+    Apply bool `json:"apply"`
+}
+
+// Sync compares Moodle with the local data and returns the plan. With {"apply": true}
+// the plan is applied; without a body it is a dry run.
+func (mc *MoodleSyncController) Sync(c *gin.Context) {
+    if !mc.Client.Configured() {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "moodle web service not configured"})
+        return
+    }
+    var req moodleSyncRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if !mc.running.TryLock() {
+        c.JSON(http.StatusConflict, gin.H{"error": "a moodle sync is already running"})
+        return
+    }
+    defer mc.running.Unlock()
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), moodleSyncTimeout)
+    defer cancel()
+    snap, err := mc.fetchSnapshot(ctx)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+        return
+    }
+    plan, err := mc.buildPlan(snap)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if req.Apply {
+        if err := mc.applyPlan(plan); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "dry_run": !req.Apply,
+        "summary": plan.summary(),
+        "plan":    plan,
+    })
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/moodle"
+)
+
+// moodleStub answers the web service functions used by the sync from fixed data.
+type moodleStub struct {
+    siteUsers []moodle.User
+    enrolled  map[string][]moodle.User // courseid -> users
+    cohorts   []moodle.Cohort
+    members   map[int64][]int64
+}
+
+func (s *moodleStub) serve(t *testing.T) *httptest.Server {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _ = r.ParseForm()
+        if r.URL.Path != "/webservice/rest/server.php" || r.PostForm.Get("wstoken") != "stub-token" {
+            _ = json.NewEncoder(w).Encode(moodle.Error{Exception: "webservice_access_exception", ErrorCode: "accessexception", Message: "Access control exception"})
+            return
+        }
+        var out interface{}
+        switch r.PostForm.Get("wsfunction") {
+        case "core_user_get_users":
+            out = map[string]interface{}{"users": s.siteUsers, "warnings": []interface{}{}}
+        case "core_enrol_get_enrolled_users":
+            out = s.enrolled[r.PostForm.Get("courseid")]
+        case "core_cohort_get_cohorts":
+            out = s.cohorts
+        case "core_cohort_get_cohort_members":
+            rows := []map[string]interface{}{}
+            for _, ch := range s.cohorts {
+                rows = append(rows, map[string]interface{}{"cohortid": ch.ID, "userids": s.members[ch.ID]})
+            }
+            out = rows
+        default:
+            out = moodle.Error{Exception: "invalid_parameter_exception", ErrorCode: "invalidrecord", Message: "unknown function"}
+        }
+        _ = json.NewEncoder(w).Encode(out)
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func newSyncTestController(t *testing.T, db *gorm.DB, stub *moodleStub, courseIDs string) *MoodleSyncController {
+    t.Helper()
+    srv := stub.serve(t)
+    return NewMoodleSyncController(db, &config.Config{
+        MoodleURL:               srv.URL,
+        MoodleWSToken:           "stub-token",
+        MoodleSyncCourseIDs:     courseIDs,
+        MoodleRoomCohortPrefix:  "ROOM-",
+        MoodleMajorCohortPrefix: "MAJOR-",
+    })
+}
+
+func syncPlan(t *testing.T, mc *MoodleSyncController) *moodleSyncPlan {
+    t.Helper()
+    w := callHandler(mc.Sync, http.MethodPost, "/api/v1/admin/moodle/sync", "", nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("sync: %d %s", w.Code, w.Body.String())
+    }
+    var body struct {
+        DryRun bool           `json:"dry_run"`
+        Plan   moodleSyncPlan `json:"plan"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if !body.DryRun {
+        t.Fatal("sync without a body must be a dry run")
+    }
+    return &body.Plan
+}
+
+func skippedReasons(plan *moodleSyncPlan) string {
+    reasons := make([]string, 0, len(plan.Skipped))
+    for _, s := range plan.Skipped {
+        reasons = append(reasons, s.Reason)
+    }
+    return strings.Join(reasons, "; ")
+}
+
+func TestMoodleSyncDryRunSiteMode(t *testing.T) {
+    db := newTestDB(t)
+    admin := models.User{FullName: "Admin", Email: "admin@school.test", Role: "admin", Active: true}
+    pengawas := models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas", Active: true}
+    siswa := models.User{FullName: "Old Name", Email: "budi@school.test", Username: "budi", Role: "siswa", Active: true}
+    for _, u := range []*models.User{&admin, &pengawas, &siswa} {
+        mustCreate(t, db, u)
+    }
+    stub := &moodleStub{siteUsers: []moodle.User{
+        // Suspended in Moodle, but admins and staff are not managed in site mode
+        {ID: 1, Username: "admin", FullName: "Moodle Admin", Email: "admin@school.test", Suspended: true},
+        {ID: 2, Username: "guru", FullName: "Guru Moodle", Email: "guru@school.test", Suspended: true},
+        {ID: 3, Username: "budi", FullName: "Budi Santoso", Email: "budi@school.test"},
+        {ID: 4, Username: "ani", FullName: "Ani", Email: "ani@school.test"},
+        {ID: 5, Username: "guest", FullName: "Guest user"},
+    }}
+    plan := syncPlan(t, newSyncTestController(t, db, stub, ""))
+
+    if len(plan.CreateUsers) != 1 || plan.CreateUsers[0].Email != "ani@school.test" || plan.CreateUsers[0].Role != "siswa" {
+        t.Fatalf("create_users = %+v, want only ani as siswa", plan.CreateUsers)
+    }
+    if len(plan.UpdateUsers) != 1 || plan.UpdateUsers[0].UserID != siswa.ID {
+        t.Fatalf("update_users = %+v, want only the local siswa", plan.UpdateUsers)
+    }
+    if ch := plan.UpdateUsers[0].Changes; ch["full_name"].To != "Budi Santoso" || ch["moodle_user_id"].To == nil {
+        t.Fatalf("unexpected changes %+v", ch)
+    }
+    reasons := skippedReasons(plan)
+    if len(plan.Skipped) != 2 || !strings.Contains(reasons, "is an admin") || !strings.Contains(reasons, "site mode only syncs siswa") {
+        t.Fatalf("skipped = %s, want the admin and the pengawas", reasons)
+    }
+
+    // A dry run writes nothing
+    var n int64
+    db.Model(&models.User{}).Count(&n)
+    var stored models.User
+    db.First(&stored, "id = ?", admin.ID)
+    if n != 3 || !stored.Active {
+        t.Fatalf("dry run changed the database: %d users, admin active=%v", n, stored.Active)
+    }
+}
+
+func TestMoodleSyncDryRunCourseMode(t *testing.T) {
+    db := newTestDB(t)
+    admin := models.User{FullName: "Admin", Email: "admin@school.test", Role: "admin", Active: true}
+    pengawas := models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas", Active: true}
+    mustCreate(t, db, &admin)
+    mustCreate(t, db, &pengawas)
+    teacher := []moodle.Role{{RoleID: 3, ShortName: "editingteacher"}}
+    stub := &moodleStub{enrolled: map[string][]moodle.User{"7": {
+        {ID: 1, Username: "admin", FullName: "Admin", Email: "admin@school.test", Suspended: true, Roles: teacher},
+        {ID: 2, Username: "guru", FullName: "Guru", Email: "guru@school.test", Suspended: true, Roles: teacher},
+        {ID: 3, Username: "dewi", FullName: "Dewi", Email: "dewi@school.test", Roles: teacher},
+        {ID: 4, Username: "ani", FullName: "Ani", Email: "ani@school.test", Roles: []moodle.Role{{RoleID: 5, ShortName: "student"}}},
+    }}}
+    plan := syncPlan(t, newSyncTestController(t, db, stub, "7"))
+
+    roles := map[string]string{}
+    for _, u := range plan.CreateUsers {
+        roles[u.Email] = u.Role
+    }
+    if len(roles) != 2 || roles["dewi@school.test"] != "pengawas" || roles["ani@school.test"] != "siswa" {
+        t.Fatalf("create_users roles = %v", roles)
+    }
+    // Course staff are managed, so the suspended pengawas is deactivated; the admin is not
+    if len(plan.UpdateUsers) != 1 || plan.UpdateUsers[0].UserID != pengawas.ID || plan.UpdateUsers[0].Changes["active"].To != false {
+        t.Fatalf("update_users = %+v, want only the pengawas deactivated", plan.UpdateUsers)
+    }
+    if reasons := skippedReasons(plan); len(plan.Skipped) != 1 || !strings.Contains(reasons, "is an admin") {
+        t.Fatalf("skipped = %s, want the admin", reasons)
+    }
+}
+
+func TestMoodleSyncApply(t *testing.T) {
+    db := newTestDB(t)
+    admin := models.User{FullName: "Admin", Email: "admin@school.test", Role: "admin", Active: true}
+    siswa := models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa", Active: true}
+    leaver := models.User{FullName: "Cici", Email: "cici@school.test", Role: "siswa", Active: true}
+    lab := models.Room{Name: "Lab 1", Active: true}
+    for _, v := range []interface{}{&admin, &siswa, &leaver, &lab} {
+        mustCreate(t, db, v)
+    }
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: leaver.ID, RoomIDRef: lab.ID})
+
+    stub := &moodleStub{
+        siteUsers: []moodle.User{
+            {ID: 1, Username: "admin", FullName: "Admin", Email: "admin@school.test", Suspended: true},
+            {ID: 3, Username: "budi", FullName: "Budi", Email: "budi@school.test", Suspended: true},
+            {ID: 4, Username: "ani", FullName: "Ani", Email: "ani@school.test"},
+        },
+        cohorts: []moodle.Cohort{
+            {ID: 10, Name: "Lab 1", IDNumber: "ROOM-LAB1"},
+            {ID: 11, Name: "Lab 2", IDNumber: "ROOM-LAB2"},
+            {ID: 20, Name: "Teknik Komputer", IDNumber: "MAJOR-TKJ"},
+        },
+        members: map[int64][]int64{10: {3}, 11: {4, 1}, 20: {4}},
+    }
+    mc := newSyncTestController(t, db, stub, "")
+    w := callHandler(mc.Sync, http.MethodPost, "/api/v1/admin/moodle/sync", `{"apply": true}`, nil)
+    if w.Code != http.StatusOK {
+        t.Fatalf("sync: %d %s", w.Code, w.Body.String())
+    }
+
+    var ani models.User
+    if err := db.Where("email = ?", "ani@school.test").First(&ani).Error; err != nil {
+        t.Fatalf("ani not created: %v", err)
+    }
+    if ani.Role != "siswa" || ani.MoodleUserID == nil || *ani.MoodleUserID != 4 || ani.Jurusan != "TKJ" || ani.MajorIDRef == nil {
+        t.Fatalf("unexpected created user %+v", ani)
+    }
+    var budi, storedAdmin models.User
+    db.First(&budi, "id = ?", siswa.ID)
+    db.First(&storedAdmin, "id = ?", admin.ID)
+    if budi.Active || budi.MoodleUserID == nil || budi.TokenVersion != 1 {
+        t.Fatalf("suspended siswa not deactivated and linked: %+v", budi)
+    }
+    if !storedAdmin.Active || storedAdmin.MoodleUserID != nil || storedAdmin.TokenVersion != 0 {
+        t.Fatalf("admin was changed by the sync: %+v", storedAdmin)
+    }
+
+    var lab2 models.Room
+    if err := db.Where("name = ?", "Lab 2").First(&lab2).Error; err != nil {
+        t.Fatalf("room from cohort not created: %v", err)
+    }
+    assigned := func(roomID string) []string {
+        var ids []string
+        db.Model(&models.RoomStudent{}).Where("room_id_ref = ?", roomID).Order("user_id_ref").Pluck("user_id_ref", &ids)
+        return ids
+    }
+    // Lab 1 now holds Budi only; Cici left the cohort. The admin in Lab 2's cohort is not a siswa.
+    if got := assigned(lab.ID); len(got) != 1 || got[0] != siswa.ID {
+        t.Fatalf("Lab 1 students = %v, want [%s]", got, siswa.ID)
+    }
+    if got := assigned(lab2.ID); len(got) != 1 || got[0] != ani.ID {
+        t.Fatalf("Lab 2 students = %v, want [%s]", got, ani.ID)
+    }
+    var statuses int64
+    db.Model(&models.StudentStatus{}).Where("user_id_ref IN ?", []string{siswa.ID, ani.ID}).Count(&statuses)
+    if statuses != 2 {
+        t.Fatalf("assigned siswa have %d statuses, want 2", statuses)
+    }
+
+    // Moodle now matches the local data: a second run plans nothing but the skipped admin
+    plan := syncPlan(t, mc)
+    if s := plan.summary(); s["create_users"] != 0 || s["update_users"] != 0 || s["create_rooms"] != 0 || s["assign_students"] != 0 || s["unassign_students"] != 0 || s["create_majors"] != 0 {
+        t.Fatalf("second run not empty: %v", s)
+    }
+}
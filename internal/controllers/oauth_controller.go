@@ -1,30 +1,99 @@
 package controllers
 
 import (
-    "fmt"
+    "crypto/subtle"
     "net/http"
+    "net/url"
+    "strings"
     "time"
 
     "github.com/gin-gonic/gin"
     "github.com/golang-jwt/jwt/v5"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
 
     "github.com/zaqqye/seb_backend_v1/internal/config"
     "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+const (
+    moodleSSOIssuer          = "seb_backend"
+    moodleSSOTokenType       = "moodle_sso"
+    moodleSSODefaultAudience = "moodle"
+    moodleSSOTTL             = 2 * time.Minute
+    // Redeemed and expired jti records are kept this long for auditing, then purged
+    moodleSSORetention = 24 * time.Hour
 )
 
 type OAuthController struct {
-    Cfg *config.Config
+    DB   *gorm.DB
+    Cfg  *config.Config
+    Keys *utils.KeySet
 }
 
 type moodleSSOResponse struct {
-    SSOURL string `json:"sso_url"`
-    Token  string `json:"token"`
+    SSOURL    string    `json:"sso_url"`
+    Token     string    `json:"token"`
+    ExpiresAt time.Time `json:"expires_at"`
+}
+
+// moodleSSOClaims is the payload of a Moodle SSO token.
+type moodleSSOClaims struct {
+    Type     string `json:"typ"`
+    Email    string `json:"email"`
+    Username string `json:"username,omitempty"`
+    Name     string `json:"name"`
+    Role     string `json:"role"`
+    jwt.RegisteredClaims
+}
+
+func (oc *OAuthController) audience() string {
+    if oc.Cfg.MoodleSSOAudience != "" {
+        return oc.Cfg.MoodleSSOAudience
+    }
+    return moodleSSODefaultAudience
+}
+
+// redirectAllowed reports whether target matches the login URL or an entry of
+// MOODLE_SSO_REDIRECT_ALLOWLIST: same scheme and host, path equal to or below the
+// entry's path.
+func (oc *OAuthController) redirectAllowed(target *url.URL) bool {
+    if target.User != nil || target.Host == "" {
+        return false
+    }
+    entries := append([]string{oc.Cfg.MoodleSSOLoginURL}, strings.Split(oc.Cfg.MoodleSSORedirectAllowlist, ",")...)
+    for _, e := range entries {
+        e = strings.TrimSpace(e)
+        if e == "" {
+            continue
+        }
+        allowed, err := url.Parse(e)
+        if err != nil || allowed.Host == "" {
+            continue
+        }
+        if !strings.EqualFold(allowed.Scheme, target.Scheme) || !strings.EqualFold(allowed.Host, target.Host) {
+            continue
+        }
+        prefix := allowed.Path
+        if target.Path == prefix || prefix == "" || prefix == "/" {
+            return true
+        }
+        if !strings.HasSuffix(prefix, "/") {
+            prefix += "/"
+        }
+        if strings.HasPrefix(target.Path, prefix) {
+            return true
+        }
+    }
+    return false
 }
 
-// GenerateMoodleSSO issues a short-lived JWT that Moodle can validate for auto-login.
-// Requires authenticated user (admin/pengawas/siswa) and configured secrets.
+// GenerateMoodleSSO issues a short-lived, single-use JWT that Moodle can validate for
+// auto-login. Requires authenticated user (admin/pengawas/siswa) and configured secrets.
+// An optional ?redirect= must match the allowlist.
 func (oc *OAuthController) GenerateMoodleSSO(c *gin.Context) {
-    if oc == nil || oc.Cfg == nil || oc.Cfg.MoodleSSOSecret == "" || oc.Cfg.MoodleSSOLoginURL == "" {
+    if oc == nil || oc.Cfg == nil || oc.Cfg.MoodleSSOLoginURL == "" || (oc.Keys.Signer() == nil && oc.Cfg.MoodleSSOSecret == "") {
         c.JSON(http.StatusServiceUnavailable, gin.H{"error": "moodle sso not configured"})
         return
     }
@@ -34,32 +103,151 @@ func (oc *OAuthController) GenerateMoodleSSO(c *gin.Context) {
         return
     }
     user := uVal.(models.User)
-    if user.Email == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "user has no email"})
+    if user.Email == "" && user.Username == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "user has no email or username"})
+        return
+    }
+
+    redirect, err := url.Parse(c.DefaultQuery("redirect", oc.Cfg.MoodleSSOLoginURL))
+    if err != nil || !oc.redirectAllowed(redirect) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "redirect not allowed"})
+        return
+    }
+
+    now := time.Now().UTC()
+    expiresAt := now.Add(moodleSSOTTL)
+    rec := models.SSOToken{
+        JTI:       uuid.NewString(),
+        UserIDRef: user.ID,
+        Audience:  oc.audience(),
+        ExpiresAt: expiresAt,
+    }
+    oc.DB.Where("expires_at < ?", now.Add(-moodleSSORetention)).Delete(&models.SSOToken{})
+    if err := oc.DB.Create(&rec).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
     }
 
-    expiresAt := time.Now().Add(2 * time.Minute)
-    claims := jwt.MapClaims{
-        "sub":   user.ID,
-        "email": user.Email,
-        "name":  user.FullName,
-        "role":  user.Role,
-        "exp":   expiresAt.Unix(),
-        "iat":   time.Now().Unix(),
+    claims := moodleSSOClaims{
+        Type:     moodleSSOTokenType,
+        Email:    user.Email,
+        Username: user.Username,
+        Name:     user.FullName,
+        Role:     user.Role,
+        RegisteredClaims: jwt.RegisteredClaims{
+            ID:        rec.JTI,
+            Subject:   user.ID,
+            Issuer:    moodleSSOIssuer,
+            Audience:  jwt.ClaimStrings{rec.Audience},
+            IssuedAt:  jwt.NewNumericDate(now),
+            NotBefore: jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(expiresAt),
+        },
     }
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    signed, err := token.SignedString([]byte(oc.Cfg.MoodleSSOSecret))
+    // Signed with the active asymmetric key when configured (Moodle verifies via JWKS)
+    signed, err := oc.Keys.Sign(claims, oc.Cfg.MoodleSSOSecret)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign token"})
         return
     }
 
-    redirect := c.DefaultQuery("redirect", oc.Cfg.MoodleSSOLoginURL)
-    ssoURL := fmt.Sprintf("%s?token=%s", redirect, signed)
+    q := redirect.Query()
+    q.Set("token", signed)
+    redirect.RawQuery = q.Encode()
 
     c.JSON(http.StatusOK, moodleSSOResponse{
-        SSOURL: ssoURL,
-        Token:  signed,
+        SSOURL:    redirect.String(),
+        Token:     signed,
+        ExpiresAt: expiresAt,
+    })
+}
+
+type moodleVerifyRequest struct {
+    Token        string `json:"token" form:"token"`
+    ClientID     string `json:"client_id" form:"client_id"`
+    ClientSecret string `json:"client_secret" form:"client_secret"`
+}
+
+// VerifyMoodleSSO is called server-to-server by Moodle to redeem an SSO token for the
+// user's profile. The client authenticates with MOODLE_SSO_CLIENT_ID/SECRET (HTTP Basic
+// or body); each token can be redeemed once.
+func (oc *OAuthController) VerifyMoodleSSO(c *gin.Context) {
+    if oc == nil || oc.Cfg == nil || oc.Cfg.MoodleSSOClientID == "" || oc.Cfg.MoodleSSOClientSecret == "" {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "moodle sso not configured"})
+        return
+    }
+    var req moodleVerifyRequest
+    if err := c.ShouldBind(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if id, secret, ok := c.Request.BasicAuth(); ok {
+        req.ClientID, req.ClientSecret = id, secret
+    }
+    idOK := subtle.ConstantTimeCompare([]byte(req.ClientID), []byte(oc.Cfg.MoodleSSOClientID)) == 1
+    secretOK := subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(oc.Cfg.MoodleSSOClientSecret)) == 1
+    if !idOK || !secretOK {
+        c.Header("WWW-Authenticate", `Basic realm="moodle-sso"`)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid client credentials"})
+        return
+    }
+    if strings.TrimSpace(req.Token) == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+        return
+    }
+
+    claims := &moodleSSOClaims{}
+    tok, err := jwt.ParseWithClaims(strings.TrimSpace(req.Token), claims, oc.Keys.Keyfunc(oc.Cfg.MoodleSSOSecret),
+        jwt.WithIssuer(moodleSSOIssuer),
+        jwt.WithAudience(oc.audience()),
+        jwt.WithExpirationRequired(),
+        jwt.WithIssuedAt(),
+    )
+    if err != nil || !tok.Valid || claims.Type != moodleSSOTokenType || claims.ID == "" || claims.Subject == "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+        return
+    }
+
+    // Mark the jti used in the same statement that checks it, so concurrent redemptions
+    // of one token cannot both succeed
+    now := time.Now().UTC()
+    res := oc.DB.Model(&models.SSOToken{}).
+        Where("jti = ? AND user_id_ref = ? AND used_at IS NULL AND expires_at > ?", claims.ID, claims.Subject, now).
+        Update("used_at", now)
+    if res.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+        return
+    }
+    if res.RowsAffected == 0 {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "token already used or unknown"})
+        return
+    }
+
+    var user models.User
+    if err := oc.DB.Where("id = ?", claims.Subject).First(&user).Error; err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+        return
+    }
+    if !user.Active {
+        c.JSON(http.StatusForbidden, gin.H{"error": "user is inactive"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "user": gin.H{
+            "id":        user.ID,
+            "email":     user.Email,
+            "username":  user.Username,
+            "full_name": user.FullName,
+            "role":      user.Role,
+            "kelas":     user.Kelas,
+            "jurusan":   user.Jurusan,
+        },
     })
 }
+
+// JWKS publishes the public verification keys (RFC 7517) so other services can
+// verify our tokens without sharing a secret.
+func (oc *OAuthController) JWKS(c *gin.Context) {
+    c.Header("Cache-Control", "public, max-age=300")
+    c.JSON(http.StatusOK, gin.H{"keys": oc.Keys.JWKS()})
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/oidc"
+)
+
+const (
+    oidcStateCookie    = "oidc_state"
+    oidcStateTTL       = 10 * time.Minute
+    oidcStateAudience  = "oidc_state"
+    oidcStateTokenType = "oidc_state"
+    // oidcPlatformPrefix starts the session platform of OIDC logins ("oidc:<provider>")
+    oidcPlatformPrefix = "oidc:"
+)
+
+// OIDCController signs staff (admin/pengawas) in through an external OpenID Connect
+// provider and issues the normal token pair for the matching User.
+type OIDCController struct {
+    DB              *gorm.DB
+    Auth            *AuthController
+    Providers       map[string]*oidc.Provider
+    TrustEmail      map[string]bool
+    SuccessRedirect string
+}
+
+func NewOIDCController(db *gorm.DB, auth *AuthController, cfg *config.Config) *OIDCController {
+    oc := &OIDCController{
+        DB:         db,
+        Auth:       auth,
+        Providers:  map[string]*oidc.Provider{},
+        TrustEmail: map[string]bool{},
+    }
+    if cfg == nil {
+        return oc
+    }
+    oc.SuccessRedirect = strings.TrimSpace(cfg.OIDCSuccessRedirect)
+    for _, p := range cfg.OIDCProviders {
+        if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+            continue
+        }
+        oc.Providers[p.Name] = oidc.NewProvider(oidc.Config{
+            Name:         p.Name,
+            Issuer:       p.Issuer,
+            ClientID:     p.ClientID,
+            ClientSecret: p.ClientSecret,
+            RedirectURL:  p.RedirectURL,
+            Scopes:       strings.Fields(p.Scopes),
+        })
+        oc.TrustEmail[p.Name] = p.TrustEmail
+    }
+    return oc
+}
+
+// oidcStateClaims travel in an HttpOnly cookie between start and callback, so the PKCE
+// verifier and nonce never leave the browser/server pair.
+type oidcStateClaims struct {
+    Type     string `json:"typ"`
+    Provider string `json:"provider"`
+    State    string `json:"state"`
+    Nonce    string `json:"nonce"`
+    Verifier string `json:"verifier"`
+    jwt.RegisteredClaims
+}
+
+func oidcCookiePath(provider string) string {
+    return "/api/v1/auth/oidc/" + provider
+}
+
+func secureRequest(c *gin.Context) bool {
+    return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
+// Start redirects to the provider's authorization endpoint (or returns the URL with ?format=json).
+func (oc *OIDCController) Start(c *gin.Context) {
+    name := strings.ToLower(c.Param("provider"))
+    provider, ok := oc.Providers[name]
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": "unknown oidc provider"})
+        return
+    }
+    var values [3]string
+    for i := range values {
+        v, err := oidc.RandomString(32)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate state"})
+            return
+        }
+        values[i] = v
+    }
+    state, nonce, verifier := values[0], values[1], values[2]
+
+    authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+    if err != nil {
+        c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+        return
+    }
+    now := time.Now().UTC()
+    cookie, err := oc.Auth.Keys.Sign(oidcStateClaims{
+        Type:     oidcStateTokenType,
+        Provider: name,
+        State:    state,
+        Nonce:    nonce,
+        Verifier: verifier,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Audience:  jwt.ClaimStrings{oidcStateAudience},
+            IssuedAt:  jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+        },
+    }, oc.Auth.AccessSecret)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign state"})
+        return
+    }
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(oidcStateCookie, cookie, int(oidcStateTTL.Seconds()), oidcCookiePath(name), "", secureRequest(c), true)
+
+    if c.Query("format") == "json" {
+        c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+        return
+    }
+    c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback validates state, exchanges the code and signs in the staff user owning the
+// verified email.
+func (oc *OIDCController) Callback(c *gin.Context) {
+    name := strings.ToLower(c.Param("provider"))
+    provider, ok := oc.Providers[name]
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": "unknown oidc provider"})
+        return
+    }
+    if errCode := c.Query("error"); errCode != "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "oidc login failed: " + errCode, "error_description": c.Query("error_description")})
+        return
+    }
+
+    raw, err := c.Cookie(oidcStateCookie)
+    if err != nil || raw == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "missing oidc state, restart login"})
+        return
+    }
+    // One attempt per state: clear the cookie whatever the outcome
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath(name), "", secureRequest(c), true)
+
+    st := &oidcStateClaims{}
+    tok, err := jwt.ParseWithClaims(raw, st, oc.Auth.Keys.Keyfunc(oc.Auth.AccessSecret), jwt.WithAudience(oidcStateAudience))
+    if err != nil || !tok.Valid || st.Type != oidcStateTokenType || st.Provider != name || st.State == "" || st.State != c.Query("state") {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oidc state"})
+        return
+    }
+    code := c.Query("code")
+    if code == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "missing code"})
+        return
+    }
+
+    claims, err := provider.Exchange(c.Request.Context(), code, st.Verifier, st.Nonce)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+        return
+    }
+    email := strings.ToLower(strings.TrimSpace(claims.Email))
+    if email == "" {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider returned no email"})
+        return
+    }
+    verified := claims.EmailVerified != nil && *claims.EmailVerified
+    if !verified && !(claims.EmailVerified == nil && oc.TrustEmail[name]) {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "email is not verified by the identity provider"})
+        return
+    }
+
+    var user models.User
+    if err := oc.DB.Where("LOWER(email) = ? AND role IN ? AND active = ?", email, []string{"admin", "pengawas"}, true).
+        First(&user).Error; err != nil {
+        c.JSON(http.StatusForbidden, gin.H{"error": "no active staff account for this email"})
+        return
+    }
+
+    access, refresh, err := oc.Auth.issueTokens(user, sessionMeta{
+        Platform:  oidcPlatformPrefix + name,
+        IPAddress: c.ClientIP(),
+        UserAgent: c.Request.UserAgent(),
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    expiresIn := int(oc.Auth.AccessTTL.Seconds())
+    if oc.SuccessRedirect != "" {
+        frag := url.Values{}
+        frag.Set("access_token", access.Token)
+        frag.Set("token_type", "Bearer")
+        frag.Set("expires_in", strconv.Itoa(expiresIn))
+        frag.Set("refresh_token", refresh.Token)
+        frag.Set("refresh_expires_in", strconv.Itoa(int(oc.Auth.RefreshTTL.Seconds())))
+        frag.Set("role", user.Role)
+        c.Redirect(http.StatusFound, oc.SuccessRedirect+"#"+frag.Encode())
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "access_token":         access.Token,
+        "token_type":           "Bearer",
+        "expires_in":           expiresIn,
+        "role":                 user.Role,
+        "refresh_token":        refresh.Token,
+        "refresh_expires_in":   int(oc.Auth.RefreshTTL.Seconds()),
+        // The local password is not used by this session, see middleware.AuthMethodOIDC
+        "must_change_password": false,
+    })
+}
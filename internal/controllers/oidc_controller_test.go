@@ -0,0 +1,237 @@
+package controllers
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/golang-jwt/jwt/v5"
+
+    "github.com/zaqqye/seb_backend_v1/internal/oidc"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+// oidcStub is an identity provider serving discovery, JWKS and a token endpoint that
+// only redeems "good-code" with the PKCE verifier of the last authorization request.
+type oidcStub struct {
+    srv       *httptest.Server
+    challenge string
+    nonce     string
+    // idNonce overrides the nonce put in the ID token
+    idNonce       string
+    emailVerified interface{}
+}
+
+func newOIDCStub(t *testing.T) *oidcStub {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := &oidcStub{}
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        _ = json.NewEncoder(w).Encode(map[string]string{
+            "issuer":                 s.srv.URL,
+            "authorization_endpoint": s.srv.URL + "/authorize",
+            "token_endpoint":         s.srv.URL + "/token",
+            "jwks_uri":               s.srv.URL + "/jwks",
+        })
+    })
+    mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+        b64 := base64.RawURLEncoding
+        _ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+            "kty": "RSA",
+            "kid": "k1",
+            "n":   b64.EncodeToString(key.N.Bytes()),
+            "e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+        }}})
+    })
+    mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+        _ = r.ParseForm()
+        if r.PostForm.Get("code") != "good-code" || oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != s.challenge {
+            w.WriteHeader(http.StatusBadRequest)
+            _ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+            return
+        }
+        nonce := s.nonce
+        if s.idNonce != "" {
+            nonce = s.idNonce
+        }
+        claims := jwt.MapClaims{
+            "iss":   s.srv.URL,
+            "aud":   r.PostForm.Get("client_id"),
+            "exp":   time.Now().Add(time.Minute).Unix(),
+            "nonce": nonce,
+            "email": "staff@example.com",
+        }
+        if s.emailVerified != nil {
+            claims["email_verified"] = s.emailVerified
+        }
+        token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+        token.Header["kid"] = "k1"
+        idToken, _ := token.SignedString(key)
+        _ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+    })
+    s.srv = httptest.NewServer(mux)
+    t.Cleanup(s.srv.Close)
+    return s
+}
+
+// newOIDCTestRouter serves Start and Callback for provider "stub". The controller has
+// no database, so only the branches before the user lookup can be exercised.
+func newOIDCTestRouter(t *testing.T, stub *oidcStub, trustEmail bool) *gin.Engine {
+    t.Helper()
+    keys, err := utils.LoadKeySet("", true)
+    if err != nil {
+        t.Fatal(err)
+    }
+    oc := &OIDCController{
+        Auth: &AuthController{AccessSecret: "test-secret", Keys: keys},
+        Providers: map[string]*oidc.Provider{
+            "stub": oidc.NewProvider(oidc.Config{Name: "stub", Issuer: stub.srv.URL, ClientID: "seb", RedirectURL: "https://seb.test/callback"}),
+        },
+        TrustEmail: map[string]bool{"stub": trustEmail},
+    }
+    gin.SetMode(gin.TestMode)
+    r := gin.New()
+    r.GET("/api/v1/auth/oidc/:provider/start", oc.Start)
+    r.GET("/api/v1/auth/oidc/:provider/callback", oc.Callback)
+    return r
+}
+
+// startOIDCLogin runs Start and lets the stub record the authorization request. It
+// returns the state and the state cookie.
+func startOIDCLogin(t *testing.T, r *gin.Engine, stub *oidcStub) (string, *http.Cookie) {
+    t.Helper()
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/stub/start?format=json", nil))
+    if w.Code != http.StatusOK {
+        t.Fatalf("start: %d %s", w.Code, w.Body.String())
+    }
+    var body struct {
+        AuthorizationURL string `json:"authorization_url"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    u, err := url.Parse(body.AuthorizationURL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    q := u.Query()
+    if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+        t.Fatalf("authorization request without PKCE or nonce: %s", body.AuthorizationURL)
+    }
+    stub.challenge, stub.nonce = q.Get("code_challenge"), q.Get("nonce")
+    var cookie *http.Cookie
+    for _, c := range w.Result().Cookies() {
+        if c.Name == oidcStateCookie {
+            cookie = c
+        }
+    }
+    if cookie == nil || !cookie.HttpOnly {
+        t.Fatal("start did not set an HttpOnly state cookie")
+    }
+    return q.Get("state"), cookie
+}
+
+func TestOIDCCallback(t *testing.T) {
+    cases := []struct {
+        name          string
+        trustEmail    bool
+        emailVerified interface{}
+        idNonce       string
+        // query of the callback; "{state}" is replaced by the state of the login
+        query      string
+        noCookie   bool
+        wantStatus int
+        wantError  string
+    }{
+        {name: "missing state cookie", query: "state={state}&code=good-code", noCookie: true, wantStatus: http.StatusBadRequest, wantError: "missing oidc state"},
+        {name: "state mismatch", query: "state=forged&code=good-code", wantStatus: http.StatusBadRequest, wantError: "invalid oidc state"},
+        {name: "provider error", query: "error=access_denied", wantStatus: http.StatusUnauthorized, wantError: "access_denied"},
+        {name: "missing code", query: "state={state}", wantStatus: http.StatusBadRequest, wantError: "missing code"},
+        {name: "code rejected", query: "state={state}&code=bad-code", wantStatus: http.StatusUnauthorized, wantError: "invalid_grant"},
+        {name: "nonce mismatch", idNonce: "replayed", emailVerified: true, query: "state={state}&code=good-code", wantStatus: http.StatusUnauthorized, wantError: "nonce mismatch"},
+        {name: "email not verified", emailVerified: false, query: "state={state}&code=good-code", wantStatus: http.StatusUnauthorized, wantError: "email is not verified"},
+        {name: "email_verified omitted", query: "state={state}&code=good-code", wantStatus: http.StatusUnauthorized, wantError: "email is not verified"},
+        {name: "email_verified false with trusted email", trustEmail: true, emailVerified: false, query: "state={state}&code=good-code", wantStatus: http.StatusUnauthorized, wantError: "email is not verified"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            stub := newOIDCStub(t)
+            stub.emailVerified = tc.emailVerified
+            stub.idNonce = tc.idNonce
+            r := newOIDCTestRouter(t, stub, tc.trustEmail)
+            state, cookie := startOIDCLogin(t, r, stub)
+
+            req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/stub/callback?"+strings.ReplaceAll(tc.query, "{state}", url.QueryEscape(state)), nil)
+            if !tc.noCookie {
+                req.AddCookie(cookie)
+            }
+            w := httptest.NewRecorder()
+            r.ServeHTTP(w, req)
+            if w.Code != tc.wantStatus || !strings.Contains(w.Body.String(), tc.wantError) {
+                t.Fatalf("got %d %s, want %d with %q", w.Code, w.Body.String(), tc.wantStatus, tc.wantError)
+            }
+        })
+    }
+}
+
+func TestOIDCCallbackStateIsSingleUse(t *testing.T) {
+    stub := newOIDCStub(t)
+    r := newOIDCTestRouter(t, stub, false)
+    state, cookie := startOIDCLogin(t, r, stub)
+
+    req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/stub/callback?code=bad-code&state="+url.QueryEscape(state), nil)
+    req.AddCookie(cookie)
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    cleared := false
+    for _, c := range w.Result().Cookies() {
+        if c.Name == oidcStateCookie && c.MaxAge < 0 {
+            cleared = true
+        }
+    }
+    if !cleared {
+        t.Fatal("callback did not clear the state cookie")
+    }
+}
+
+func TestOIDCCallbackRejectsOtherTokenKind(t *testing.T) {
+    stub := newOIDCStub(t)
+    r := newOIDCTestRouter(t, stub, false)
+    state, cookie := startOIDCLogin(t, r, stub)
+
+    // Same key, audience and state, but not an oidc_state token
+    raw, err := (&utils.KeySet{AllowHMAC: true}).Sign(oidcStateClaims{
+        Type:     "access",
+        Provider: "stub",
+        State:    state,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Audience:  jwt.ClaimStrings{oidcStateAudience},
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+        },
+    }, "test-secret")
+    if err != nil {
+        t.Fatal(err)
+    }
+    cookie.Value = raw
+    req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/stub/callback?code=good-code&state="+url.QueryEscape(state), nil)
+    req.AddCookie(cookie)
+    w := httptest.NewRecorder()
+    r.ServeHTTP(w, req)
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("got %d %s, want 400", w.Code, w.Body.String())
+    }
+}
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+    "strconv"
+    "strings"
+
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+// passwordPolicy reads the policy from AppConfig (password_min_length,
+// password_min_classes, password_denylist) falling back to env config.
+func passwordPolicy(db *gorm.DB, cfg *config.Config) (utils.PasswordPolicy, error) {
+    policy := utils.PasswordPolicy{MinLength: 8, MinClasses: 2}
+    fallbackLength, fallbackClasses, fallbackDeny := "", "", ""
+    if cfg != nil {
+        fallbackLength, fallbackClasses, fallbackDeny = cfg.PasswordMinLength, cfg.PasswordMinClasses, cfg.PasswordDenyList
+    }
+    length, err := appConfigValue(db, "password_min_length", fallbackLength)
+    if err != nil {
+        return policy, err
+    }
+    if n, convErr := strconv.Atoi(length); convErr == nil && n > 0 {
+        policy.MinLength = n
+    }
+    classes, err := appConfigValue(db, "password_min_classes", fallbackClasses)
+    if err != nil {
+        return policy, err
+    }
+    if n, convErr := strconv.Atoi(classes); convErr == nil && n >= 1 && n <= 4 {
+        policy.MinClasses = n
+    }
+    deny, err := appConfigValue(db, "password_denylist", fallbackDeny)
+    if err != nil {
+        return policy, err
+    }
+    for _, d := range strings.Split(deny, ",") {
+        if d = strings.TrimSpace(d); d != "" {
+            policy.DenyList = append(policy.DenyList, d)
+        }
+    }
+    return policy, nil
+}
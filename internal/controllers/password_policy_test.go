@@ -0,0 +1,85 @@
+package controllers
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/zaqqye/seb_backend_v1/internal/middleware"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func TestRegisterAppliesPasswordPolicy(t *testing.T) {
+    db := newTestDB(t)
+    admin := createTestUser(t, db, models.User{FullName: "Admin", Email: "admin@school.test", Role: "admin"}, "rahasia123")
+    a := newTestAuthController(db)
+    register := func(email, password string) (int, string) {
+        body, err := json.Marshal(map[string]string{"full_name": "Budi Santoso", "email": email, "password": password, "role": "pengawas"})
+        if err != nil {
+            t.Fatal(err)
+        }
+        w := callHandler(a.Register, http.MethodPost, "/api/v1/admin/users", string(body), &admin)
+        return w.Code, w.Body.String()
+    }
+
+    for _, weak := range []string{"abc123", "alllowercase", "password1", "Guru-Kelas-1"} {
+        if code, body := register("guru@school.test", weak); code != http.StatusBadRequest {
+            t.Fatalf("password %q: got %d %s, want 400", weak, code, body)
+        }
+    }
+    if code, body := register("guru@school.test", "Kuda-Laut-77"); code != http.StatusCreated {
+        t.Fatalf("strong password: got %d %s, want 201", code, body)
+    }
+    var u models.User
+    if err := db.Where("email = ?", "guru@school.test").First(&u).Error; err != nil {
+        t.Fatal(err)
+    }
+    if !u.MustChangePassword {
+        t.Fatal("registered user must change the admin-chosen password")
+    }
+}
+
+func TestMustChangePasswordGate(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas", MustChangePassword: true}, "rahasia123")
+    a := newTestAuthController(db)
+    cfg := middleware.AuthConfig{JWTSecret: a.AccessSecret}
+
+    access, _ := loginTokens(t, a, guru.Email, "rahasia123")
+    for path, want := range map[string]int{
+        "/api/v1/rooms":         http.StatusForbidden,
+        "/api/v1/auth/me":       http.StatusNoContent,
+        "/api/v1/auth/password": http.StatusNoContent,
+        "/api/v1/auth/logout":   http.StatusNoContent,
+    } {
+        w := probe(db, cfg, path, access)
+        if w.Code != want {
+            t.Fatalf("%s: got %d %s, want %d", path, w.Code, w.Body.String(), want)
+        }
+        if want == http.StatusForbidden && !strings.Contains(w.Body.String(), `"must_change_password":true`) {
+            t.Fatalf("%s: body %s lacks must_change_password", path, w.Body.String())
+        }
+    }
+
+    w := callHandler(a.ChangePassword, http.MethodPost, "/api/v1/auth/password", `{"current_password":"rahasia123","new_password":"rahasia"}`, &guru)
+    if w.Code != http.StatusBadRequest {
+        t.Fatalf("weak new password: got %d %s, want 400", w.Code, w.Body.String())
+    }
+    w = callHandler(a.ChangePassword, http.MethodPost, "/api/v1/auth/password", `{"current_password":"rahasia123","new_password":"Kuda-Laut-77"}`, &guru)
+    if w.Code != http.StatusOK {
+        t.Fatalf("change password: %d %s", w.Code, w.Body.String())
+    }
+    var body struct {
+        AccessToken string `json:"access_token"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if w := probe(db, cfg, "/api/v1/rooms", body.AccessToken); w.Code != http.StatusNoContent {
+        t.Fatalf("after change: got %d %s, want 204", w.Code, w.Body.String())
+    }
+    if w := probe(db, cfg, "/api/v1/auth/me", access); w.Code != http.StatusUnauthorized {
+        t.Fatalf("token from before the change: got %d, want 401", w.Code)
+    }
+}
@@ -0,0 +1,292 @@
+package controllers
+
+import (
+    "bytes"
+    "encoding/csv"
+    "fmt"
+    "net/http"
+    "runtime"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+// maxPasswordResetUsers bounds one bulk reset; every password is bcrypt-hashed while the
+// request waits.
+const maxPasswordResetUsers = 500
+
+type issuedCredential struct {
+    UserID   string
+    FullName string
+    Email    string
+    Username string
+    Kelas    string
+    Jurusan  string
+    Room     string
+    Password string
+}
+
+// PasswordResetController resets passwords in bulk and returns the generated
+// credentials as CSV or PDF in the same response; they are never stored.
+type PasswordResetController struct {
+    DB *gorm.DB
+}
+
+func NewPasswordResetController(db *gorm.DB) *PasswordResetController {
+    return &PasswordResetController{DB: db}
+}
+
+type resetPasswordsRequest struct {
+    UserIDs []string `json:"user_ids"`
+    Role    string   `json:"role"`
+    Kelas   string   `json:"kelas"`
+    Jurusan string   `json:"jurusan"`
+    RoomID  string   `json:"room_id"`
+    Length  int      `json:"length"` // generated password length, default 10
+    Format  string   `json:"format"` // csv (default) or pdf
+}
+
+// ResetPasswords generates a random password for every matching user, forces a
+// password change on next login, revokes all of their sessions and responds with the
+// credentials file. The file is the only copy of the passwords.
+func (pc *PasswordResetController) ResetPasswords(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    actor := uVal.(models.User)
+
+    var req resetPasswordsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    role := strings.ToLower(strings.TrimSpace(req.Role))
+    kelas := strings.ToLower(strings.TrimSpace(req.Kelas))
+    jurusan := strings.ToLower(strings.TrimSpace(req.Jurusan))
+    roomID := strings.TrimSpace(req.RoomID)
+    if len(req.UserIDs) == 0 && role == "" && kelas == "" && jurusan == "" && roomID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids or at least one filter (role, kelas, jurusan, room_id) is required"})
+        return
+    }
+    if role != "" && !IsValidRole(role) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role"})
+        return
+    }
+    if req.Length != 0 && (req.Length < 8 || req.Length > 32) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "length must be between 8 and 32"})
+        return
+    }
+    if _, err := toUUIDSlice(req.UserIDs); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids must be UUIDs"})
+        return
+    }
+    if roomID != "" {
+        if _, err := uuid.Parse(roomID); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+            return
+        }
+    }
+    format := strings.ToLower(strings.TrimSpace(req.Format))
+    if format == "" {
+        format = "csv"
+    }
+    if format != "csv" && format != "pdf" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or pdf"})
+        return
+    }
+
+    // Never reset the calling admin, they would lose access mid-operation
+    q := pc.DB.Model(&models.User{}).Where("users.id <> ?", actor.ID)
+    if len(req.UserIDs) > 0 {
+        q = q.Where("users.id IN ?", req.UserIDs)
+    }
+    if role != "" {
+        q = q.Where("users.role = ?", role)
+    }
+    if kelas != "" {
+        q = q.Where("LOWER(users.kelas) = ?", kelas)
+    }
+    if jurusan != "" {
+        q = q.Where("LOWER(users.jurusan) = ?", jurusan)
+    }
+    if roomID != "" {
+        q = q.Where("users.id IN (?)", pc.DB.Table("room_students").Select("user_id_ref").Where("room_id_ref = ? AND deleted_at IS NULL", roomID).Where(models.CurrentTermCond("term_id_ref")))
+    }
+    var users []models.User
+    if err := q.Order("users.kelas ASC, users.full_name ASC").Limit(maxPasswordResetUsers + 1).Find(&users).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(users) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "no users matched"})
+        return
+    }
+    if len(users) > maxPasswordResetUsers {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("more than %d users matched; narrow the filters", maxPasswordResetUsers)})
+        return
+    }
+
+    ids := make([]string, 0, len(users))
+    for _, u := range users {
+        ids = append(ids, u.ID)
+    }
+    type roomRow struct {
+        UserID   string
+        RoomName string
+    }
+    var roomRows []roomRow
+    if err := pc.DB.Table("room_students rs").
+        Select("rs.user_id_ref AS user_id, r.name AS room_name").
+        Joins("JOIN rooms r ON r.id = rs.room_id_ref").
+        Where("rs.user_id_ref IN ? AND rs.deleted_at IS NULL", ids).
+        Where(models.CurrentTermCond("rs.term_id_ref")).
+        Order("rs.created_at ASC").
+        Scan(&roomRows).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    roomByUser := map[string]string{}
+    for _, r := range roomRows {
+        roomByUser[r.UserID] = r.RoomName
+    }
+
+    rows := make([]issuedCredential, 0, len(users))
+    for _, u := range users {
+        plain, err := utils.GeneratePassword(req.Length)
+        if err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate password"})
+            return
+        }
+        rows = append(rows, issuedCredential{
+            UserID:   u.ID,
+            FullName: u.FullName,
+            Email:    u.Email,
+            Username: u.Username,
+            Kelas:    u.Kelas,
+            Jurusan:  u.Jurusan,
+            Room:     roomByUser[u.ID],
+            Password: plain,
+        })
+    }
+    hashes, err := hashCredentials(rows)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+        return
+    }
+
+    if err := pc.DB.Transaction(func(tx *gorm.DB) error {
+        for id, hashed := range hashes {
+            if err := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+                "password":             hashed,
+                "must_change_password": true,
+            }).Error; err != nil {
+                return err
+            }
+        }
+        if err := tx.Model(&models.RefreshToken{}).
+            Where("user_id_ref IN ? AND revoked_at IS NULL", ids).
+            Update("revoked_at", time.Now().UTC()).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.User{}).Where("id IN ?", ids).
+            UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error
+    }); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    filename := "credentials-" + time.Now().UTC().Format("20060102-150405")
+    c.Header("Cache-Control", "no-store")
+    c.Header("X-Reset-Count", strconv.Itoa(len(rows)))
+    if format == "pdf" {
+        c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".pdf"))
+        c.Data(http.StatusOK, "application/pdf", credentialsPDF(rows))
+        return
+    }
+    var buf bytes.Buffer
+    w := csv.NewWriter(&buf)
+    _ = w.Write([]string{"user_id", "full_name", "email", "username", "kelas", "jurusan", "room", "password"})
+    for _, r := range rows {
+        _ = w.Write(csvSafeRow(r.UserID, r.FullName, r.Email, r.Username, r.Kelas, r.Jurusan, r.Room, r.Password))
+    }
+    w.Flush()
+    c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+    c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// hashCredentials bcrypt-hashes the generated passwords on all CPUs, keyed by user id.
+func hashCredentials(rows []issuedCredential) (map[string]string, error) {
+    hashed := make([]string, len(rows))
+    errs := make([]error, len(rows))
+    next := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < runtime.NumCPU(); w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                hashed[i], errs[i] = utils.HashPassword(rows[i].Password)
+            }
+        }()
+    }
+    for i := range rows {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    out := make(map[string]string, len(rows))
+    for i, r := range rows {
+        if errs[i] != nil {
+            return nil, errs[i]
+        }
+        out[r.UserID] = hashed[i]
+    }
+    return out, nil
+}
+
+// csvSafeRow prefixes cells that a spreadsheet would read as a formula with a quote.
+func csvSafeRow(cells ...string) []string {
+    for i, v := range cells {
+        if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+            cells[i] = "'" + v
+        }
+    }
+    return cells
+}
+
+// credentialLogin is the identifier printed for the user to log in with.
+func credentialLogin(r issuedCredential) string {
+    if r.Username != "" {
+        return r.Username
+    }
+    return r.Email
+}
+
+// credentialsPDF lays out one cut-out slip per user, ten slips per page.
+func credentialsPDF(rows []issuedCredential) []byte {
+    const slipsPerPage = 10
+    lines := make([]string, 0, len(rows)*6)
+    for i, r := range rows {
+        if i > 0 && i%slipsPerPage == 0 {
+            lines = append(lines, "\f")
+        }
+        room := r.Room
+        if room == "" {
+            room = "-"
+        }
+        lines = append(lines,
+            fmt.Sprintf("Nama     : %s", r.FullName),
+            fmt.Sprintf("Kelas    : %s %s   Ruang: %s", r.Kelas, r.Jurusan, room),
+            fmt.Sprintf("Login    : %s", credentialLogin(r)),
+            fmt.Sprintf("Password : %s   (wajib diganti saat login pertama)", r.Password),
+            strings.Repeat("- ", 40),
+        )
+    }
+    return utils.TextPDF(lines, 5*slipsPerPage+1)
+}
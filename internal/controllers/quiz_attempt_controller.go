@@ -0,0 +1,298 @@
+package controllers
+
+import (
+    "context"
+    "crypto/subtle"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/moodle"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
+)
+
+// QuizAttemptController keeps models.QuizAttempt in sync with Moodle, by polling
+// mod_quiz_get_user_attempts for linked siswa and/or through a webhook.
+type QuizAttemptController struct {
+    DB            *gorm.DB
+    Hubs          *ws.Hubs
+    Client        *moodle.Client
+    QuizIDs       []int64
+    PollInterval  time.Duration
+    // PollTimeout bounds one poll round; PollWorkers is the number of concurrent calls.
+    PollTimeout   time.Duration
+    PollWorkers   int
+    WebhookSecret string
+}
+
+func NewQuizAttemptController(db *gorm.DB, hubs *ws.Hubs, cfg *config.Config) *QuizAttemptController {
+    qc := &QuizAttemptController{
+        DB:            db,
+        Hubs:          hubs,
+        Client:        moodle.NewClient(cfg.MoodleURL, cfg.MoodleWSToken),
+        PollInterval:  60 * time.Second,
+        PollTimeout:   5 * time.Minute,
+        PollWorkers:   8,
+        WebhookSecret: strings.TrimSpace(cfg.MoodleWebhookSecret),
+    }
+    for _, s := range strings.Split(cfg.MoodleQuizIDs, ",") {
+        if id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil && id > 0 {
+            qc.QuizIDs = append(qc.QuizIDs, id)
+        }
+    }
+    if v := strings.TrimSpace(cfg.MoodleQuizPollSeconds); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            qc.PollInterval = time.Duration(n) * time.Second
+        }
+    }
+    return qc
+}
+
+// RunPoller polls the configured quizzes until ctx is cancelled. It returns
+// immediately when polling is not configured. A round that outlasts the interval
+// delays the next one rather than overlapping it.
+func (qc *QuizAttemptController) RunPoller(ctx context.Context) {
+    if !qc.Client.Configured() || len(qc.QuizIDs) == 0 || qc.PollInterval <= 0 {
+        return
+    }
+    ticker := time.NewTicker(qc.PollInterval)
+    defer ticker.Stop()
+    for {
+        pollCtx, cancel := context.WithTimeout(ctx, qc.PollTimeout)
+        if err := qc.pollOnce(pollCtx); err != nil {
+            log.Printf("quiz attempt poll: %v", err)
+        }
+        cancel()
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// pollOnce fetches the attempts of the active siswa linked to Moodle and assigned to a
+// room of the active term, PollWorkers calls at a time. What was fetched before ctx
+// ended is still ingested.
+func (qc *QuizAttemptController) pollOnce(ctx context.Context) error {
+    var moodleIDs []int64
+    if err := qc.DB.Model(&models.User{}).
+        Where("role = ? AND active = ? AND moodle_user_id IS NOT NULL", "siswa", true).
+        Where("id IN (?)", qc.DB.Model(&models.RoomStudent{}).Select("user_id_ref").Where(models.CurrentTermCond("term_id_ref"))).
+        Pluck("moodle_user_id", &moodleIDs).Error; err != nil {
+        return err
+    }
+    type job struct{ quizID, userID int64 }
+    jobs := make(chan job)
+    var (
+        mu       sync.Mutex
+        wg       sync.WaitGroup
+        attempts []moodle.QuizAttempt
+    )
+    workers := qc.PollWorkers
+    if workers < 1 {
+        workers = 1
+    }
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := range jobs {
+                list, err := qc.Client.UserAttempts(ctx, j.quizID, j.userID, "all")
+                if err != nil {
+                    if ctx.Err() == nil {
+                        log.Printf("quiz attempt poll quiz=%d user=%d: %v", j.quizID, j.userID, err)
+                    }
+                    continue
+                }
+                mu.Lock()
+                attempts = append(attempts, list...)
+                mu.Unlock()
+            }
+        }()
+    }
+send:
+    for _, quizID := range qc.QuizIDs {
+        for _, uid := range moodleIDs {
+            select {
+            case jobs <- job{quizID, uid}:
+            case <-ctx.Done():
+                break send
+            }
+        }
+    }
+    close(jobs)
+    wg.Wait()
+
+    if _, err := qc.ingest(attempts); err != nil {
+        return err
+    }
+    return ctx.Err()
+}
+
+func unixTimePtr(sec int64) *time.Time {
+    if sec <= 0 {
+        return nil
+    }
+    t := time.Unix(sec, 0).UTC()
+    return &t
+}
+
+func sameTimePtr(a, b *time.Time) bool {
+    if a == nil || b == nil {
+        return a == b
+    }
+    return a.Equal(*b)
+}
+
+// ingest upserts attempts of known siswa and pushes a monitoring update for every
+// student whose attempt changed. Returns the number of stored changes. The poller and
+// the webhook may ingest the same attempt concurrently, so rows are written with
+// ON CONFLICT (moodle_attempt_id).
+func (qc *QuizAttemptController) ingest(attempts []moodle.QuizAttempt) (int, error) {
+    if len(attempts) == 0 {
+        return 0, nil
+    }
+    moodleUserIDs := make([]int64, 0, len(attempts))
+    attemptIDs := make([]int64, 0, len(attempts))
+    for _, a := range attempts {
+        moodleUserIDs = append(moodleUserIDs, a.UserID)
+        attemptIDs = append(attemptIDs, a.ID)
+    }
+    var users []models.User
+    if err := qc.DB.Select("id", "moodle_user_id").
+        Where("role = ? AND moodle_user_id IN ?", "siswa", moodleUserIDs).
+        Find(&users).Error; err != nil {
+        return 0, err
+    }
+    userByMoodle := map[int64]string{}
+    for _, u := range users {
+        userByMoodle[*u.MoodleUserID] = u.ID
+    }
+    var existing []models.QuizAttempt
+    if err := qc.DB.Where("moodle_attempt_id IN ?", attemptIDs).Find(&existing).Error; err != nil {
+        return 0, err
+    }
+    byAttempt := map[int64]models.QuizAttempt{}
+    for _, e := range existing {
+        byAttempt[e.MoodleAttemptID] = e
+    }
+
+    changedUsers := map[string]bool{}
+    changes := 0
+    for _, a := range attempts {
+        userID, ok := userByMoodle[a.UserID]
+        if !ok || a.Preview != 0 || a.ID == 0 {
+            continue
+        }
+        rec := models.QuizAttempt{
+            MoodleAttemptID: a.ID,
+            MoodleQuizID:    a.Quiz,
+            UserIDRef:       userID,
+            State:           a.State,
+            StartedAt:       unixTimePtr(a.TimeStart),
+            FinishedAt:      unixTimePtr(a.TimeFinish),
+        }
+        if a.TimeCheckState != nil && (a.State == "inprogress" || a.State == "overdue") {
+            rec.DueAt = unixTimePtr(*a.TimeCheckState)
+        }
+        if old, ok := byAttempt[a.ID]; ok && old.State == rec.State && sameTimePtr(old.FinishedAt, rec.FinishedAt) && sameTimePtr(old.DueAt, rec.DueAt) {
+            continue
+        }
+        if err := qc.DB.Clauses(clause.OnConflict{
+            Columns:   []clause.Column{{Name: "moodle_attempt_id"}},
+            DoUpdates: clause.AssignmentColumns([]string{"state", "finished_at", "due_at", "updated_at"}),
+        }).Create(&rec).Error; err != nil {
+            return changes, err
+        }
+        byAttempt[a.ID] = rec
+        changedUsers[userID] = true
+        changes++
+    }
+    for userID := range changedUsers {
+        broadcastStudentStatus(qc.DB, qc.Hubs, userID)
+    }
+    return changes, nil
+}
+
+type quizWebhookRequest struct {
+    Attempts []moodle.QuizAttempt `json:"attempts"`
+}
+
+// Webhook receives attempts pushed by Moodle (same shape as mod_quiz_get_user_attempts:
+// {"attempts": [...]}), authenticated by the X-Moodle-Webhook-Secret header.
+func (qc *QuizAttemptController) Webhook(c *gin.Context) {
+    if qc.WebhookSecret == "" {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "moodle webhook not configured"})
+        return
+    }
+    if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Moodle-Webhook-Secret")), []byte(qc.WebhookSecret)) != 1 {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid webhook secret"})
+        return
+    }
+    var req quizWebhookRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    n, err := qc.ingest(req.Attempts)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"received": len(req.Attempts), "updated": n})
+}
+
+// currentQuizAttempts returns, per user, the open attempt if there is one, otherwise
+// the most recently started attempt.
+func currentQuizAttempts(db *gorm.DB, userIDs []string) (map[string]models.QuizAttempt, error) {
+    out := map[string]models.QuizAttempt{}
+    if len(userIDs) == 0 {
+        return out, nil
+    }
+    var attempts []models.QuizAttempt
+    if err := db.Where("user_id_ref IN ?", userIDs).
+        Order("CASE WHEN state IN ('inprogress', 'overdue') THEN 0 ELSE 1 END, started_at DESC NULLS LAST").
+        Find(&attempts).Error; err != nil {
+        return nil, err
+    }
+    for _, a := range attempts {
+        if _, ok := out[a.UserIDRef]; !ok {
+            out[a.UserIDRef] = a
+        }
+    }
+    return out, nil
+}
+
+// quizSnapshot converts an attempt for REST/WS output; nil when there is none.
+func quizSnapshot(a models.QuizAttempt, ok bool, now time.Time) *ws.MonitoringQuiz {
+    if !ok {
+        return nil
+    }
+    q := &ws.MonitoringQuiz{
+        AttemptID:  a.MoodleAttemptID,
+        QuizID:     a.MoodleQuizID,
+        State:      a.State,
+        StartedAt:  a.StartedAt,
+        FinishedAt: a.FinishedAt,
+        DueAt:      a.DueAt,
+        UpdatedAt:  a.UpdatedAt,
+    }
+    if a.State == "inprogress" && a.DueAt != nil {
+        remaining := int64(a.DueAt.Sub(now).Seconds())
+        if remaining < 0 {
+            remaining = 0
+        }
+        q.TimeRemainingSeconds = &remaining
+    }
+    return q
+}
@@ -8,7 +8,7 @@ import (
     "strings"
 
     "github.com/gin-gonic/gin"
-    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v5/pgconn"
     "gorm.io/gorm"
 
     "github.com/zaqqye/seb_backend_v1/internal/models"
@@ -19,13 +19,19 @@ type RoomController struct {
 }
 
 type createRoomRequest struct {
-    Name   string `json:"name" binding:"required"`
-    Active *bool  `json:"active"`
+    Name        string `json:"name" binding:"required"`
+    Active      *bool  `json:"active"`
+    Capacity    int    `json:"capacity"`
+    SeatRows    int    `json:"seat_rows"`
+    SeatColumns int    `json:"seat_columns"`
 }
 
 type updateRoomRequest struct {
-    Name   *string `json:"name"`
-    Active *bool   `json:"active"`
+    Name        *string `json:"name"`
+    Active      *bool   `json:"active"`
+    Capacity    *int    `json:"capacity"`
+    SeatRows    *int    `json:"seat_rows"`
+    SeatColumns *int    `json:"seat_columns"`
 }
 
 func (rc *RoomController) ListRooms(c *gin.Context) {
@@ -72,9 +78,14 @@ func (rc *RoomController) ListRooms(c *gin.Context) {
     qText := strings.TrimSpace(c.Query("q"))
     activeStr := strings.TrimSpace(strings.ToLower(c.Query("active")))
 
+    // Deleted rooms are only listed for admins
+    withDeleted := isAdmin && includeDeleted(c)
     base := rc.DB.Model(&models.Room{})
+    if withDeleted {
+        base = base.Unscoped()
+    }
     if !isAdmin && currentUser.ID != "" {
-        sub := rc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ?", currentUser.ID)
+        sub := rc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ? AND deleted_at IS NULL", currentUser.ID).Where(models.CurrentTermCond("term_id_ref"))
         base = base.Where("id IN (?)", sub)
     }
     if qText != "" {
@@ -101,8 +112,11 @@ func (rc *RoomController) ListRooms(c *gin.Context) {
 
     var rooms []models.Room
     listQ := rc.DB.Model(&models.Room{}).Order(order)
+    if withDeleted {
+        listQ = listQ.Unscoped()
+    }
     if !isAdmin && currentUser.ID != "" {
-        sub := rc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ?", currentUser.ID)
+        sub := rc.DB.Table("room_supervisors").Select("room_id_ref").Where("user_id_ref = ? AND deleted_at IS NULL", currentUser.ID).Where(models.CurrentTermCond("term_id_ref"))
         listQ = listQ.Where("id IN (?)", sub)
     }
     // reapply filters on list query
@@ -129,13 +143,20 @@ func (rc *RoomController) ListRooms(c *gin.Context) {
 
     out := make([]gin.H, 0, len(rooms))
     for _, r := range rooms {
-        out = append(out, gin.H{
+        entry := gin.H{
             "id":         r.ID,
             "name":       r.Name,
-            "active":     r.Active,
-            "created_at": r.CreatedAt,
-            "updated_at": r.UpdatedAt,
-        })
+            "active":       r.Active,
+            "capacity":     r.Capacity,
+            "seat_rows":    r.SeatRows,
+            "seat_columns": r.SeatColumns,
+            "created_at":   r.CreatedAt,
+            "updated_at":   r.UpdatedAt,
+        }
+        if withDeleted {
+            entry["deleted_at"] = r.DeletedAt
+        }
+        out = append(out, entry)
     }
     meta := gin.H{"total": total, "all": all}
     if !all {
@@ -163,7 +184,11 @@ func (rc *RoomController) CreateRoom(c *gin.Context) {
     if req.Active != nil {
         active = *req.Active
     }
-    room := models.Room{Name: req.Name, Active: active}
+    room := models.Room{Name: req.Name, Active: active, Capacity: req.Capacity, SeatRows: req.SeatRows, SeatColumns: req.SeatColumns}
+    if err := validateRoomLayout(&room); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
     if err := rc.DB.Create(&room).Error; err != nil {
         var pgErr *pgconn.PgError
         if errors.As(err, &pgErr) && pgErr.Code == "23505" {
@@ -212,7 +237,33 @@ func (rc *RoomController) UpdateRoom(c *gin.Context) {
     if req.Active != nil {
         room.Active = *req.Active
     }
-    if err := rc.DB.Save(&room).Error; err != nil {
+    if req.Capacity != nil {
+        room.Capacity = *req.Capacity
+    }
+    if req.SeatRows != nil {
+        room.SeatRows = *req.SeatRows
+    }
+    if req.SeatColumns != nil {
+        room.SeatColumns = *req.SeatColumns
+    }
+    if err := validateRoomLayout(&room); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if err := rc.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&room).Error; err != nil {
+            return err
+        }
+        if err := checkRoomCapacity(tx, room.ID); err != nil {
+            return err
+        }
+        return clearSeatsOutsideGrid(tx, room)
+    }); err != nil {
+        var full *roomFullError
+        if errors.As(err, &full) {
+            c.JSON(http.StatusConflict, gin.H{"error": "room already has more siswa than the new capacity"})
+            return
+        }
         var pgErr *pgconn.PgError
         if errors.As(err, &pgErr) && pgErr.Code == "23505" {
             c.JSON(http.StatusConflict, gin.H{"error": "room name already exists"})
@@ -230,9 +281,14 @@ func (rc *RoomController) DeleteRoom(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
         return
     }
-    if err := rc.DB.Where("id = ?", id).Delete(&models.Room{}).Error; err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+    if permanentDelete(c) {
+        deleteWithDependencies(c, rc.DB, "room", &models.Room{}, id, roomDependencies)
         return
     }
-    c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+    softDelete(c, rc.DB, "room", &models.Room{}, id, "room_id_ref", nil)
+}
+
+// RestoreRoom undoes a soft delete, including the assignments deleted with the room.
+func (rc *RoomController) RestoreRoom(c *gin.Context) {
+    restoreDeleted(c, rc.DB, "room", &models.Room{}, strings.TrimSpace(c.Param("id")), "room_id_ref")
 }
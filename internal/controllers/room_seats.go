@@ -0,0 +1,298 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "math/rand"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/jackc/pgx/v5/pgconn"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// maxSeatGrid bounds seat_rows and seat_columns of a room.
+const maxSeatGrid = 100
+
+// roomFullError is returned when an assignment would put more siswa in a room than its
+// capacity allows.
+type roomFullError struct {
+    RoomName string
+    Capacity int
+}
+
+func (e *roomFullError) Error() string {
+    return fmt.Sprintf("room '%s' is full (capacity %d)", e.RoomName, e.Capacity)
+}
+
+// validateRoomLayout checks the capacity and seat grid of a room being created or updated.
+func validateRoomLayout(room *models.Room) error {
+    if room.Capacity < 0 || room.SeatRows < 0 || room.SeatColumns < 0 {
+        return errors.New("capacity, seat_rows and seat_columns must not be negative")
+    }
+    if room.SeatRows > maxSeatGrid || room.SeatColumns > maxSeatGrid {
+        return fmt.Errorf("seat_rows and seat_columns must not exceed %d", maxSeatGrid)
+    }
+    if (room.SeatRows == 0) != (room.SeatColumns == 0) {
+        return errors.New("seat_rows and seat_columns must be set together")
+    }
+    if seats := room.SeatRows * room.SeatColumns; seats > 0 && room.Capacity > seats {
+        return fmt.Errorf("capacity %d exceeds the %d seats of the grid", room.Capacity, seats)
+    }
+    return nil
+}
+
+// roomOccupancy locks the room row, so concurrent assignments to it serialize, and
+// returns it with the number of siswa assigned for the active term.
+func roomOccupancy(tx *gorm.DB, roomID string) (models.Room, int, error) {
+    var room models.Room
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", roomID).First(&room).Error; err != nil {
+        return room, 0, err
+    }
+    var n int64
+    if err := tx.Model(&models.RoomStudent{}).Where("room_id_ref = ?", roomID).Where(models.CurrentTermCond("term_id_ref")).Count(&n).Error; err != nil {
+        return room, 0, err
+    }
+    return room, int(n), nil
+}
+
+// checkRoomCapacity fails with *roomFullError when the room holds more siswa than its
+// capacity. Call it after assigning siswa, in the same transaction.
+func checkRoomCapacity(tx *gorm.DB, roomID string) error {
+    room, n, err := roomOccupancy(tx, roomID)
+    if err != nil {
+        return err
+    }
+    if room.Capacity > 0 && n > room.Capacity {
+        return &roomFullError{RoomName: room.Name, Capacity: room.Capacity}
+    }
+    return nil
+}
+
+// clearSeatsOutsideGrid unseats the siswa of the active term whose seat no longer exists
+// after the grid of the room shrank.
+func clearSeatsOutsideGrid(tx *gorm.DB, room models.Room) error {
+    return tx.Model(&models.RoomStudent{}).
+        Where("room_id_ref = ? AND seat_row IS NOT NULL AND (seat_row > ? OR seat_column > ?)", room.ID, room.SeatRows, room.SeatColumns).
+        Where(models.CurrentTermCond("term_id_ref")).
+        Updates(map[string]interface{}{"seat_row": nil, "seat_column": nil}).Error
+}
+
+type seatEntry struct {
+    SeatRow    *int   `json:"seat_row"`
+    SeatColumn *int   `json:"seat_column"`
+    UserID     string `json:"user_id"`
+    FullName   string `json:"full_name"`
+    Username   string `json:"username"`
+    Kelas      string `json:"kelas"`
+}
+
+// roomSeatMap lists the siswa of the room for the active term by seat, row by row, with
+// the ones not seated yet under "unseated".
+func roomSeatMap(db *gorm.DB, room models.Room) (gin.H, error) {
+    var rows []seatEntry
+    if err := db.Table("room_students AS rs").
+        Select("rs.seat_row, rs.seat_column, u.id AS user_id, u.full_name, u.username, u.kelas").
+        Joins("JOIN users u ON u.id = rs.user_id_ref").
+        Where("rs.room_id_ref = ? AND rs.deleted_at IS NULL", room.ID).
+        Where(models.CurrentTermCond("rs.term_id_ref")).
+        Order("rs.seat_row, rs.seat_column, u.full_name").
+        Scan(&rows).Error; err != nil {
+        return nil, err
+    }
+    seats := []seatEntry{}
+    unseated := []seatEntry{}
+    for _, r := range rows {
+        if r.SeatRow == nil {
+            unseated = append(unseated, r)
+        } else {
+            seats = append(seats, r)
+        }
+    }
+    return gin.H{
+        "room": gin.H{
+            "id":           room.ID,
+            "name":         room.Name,
+            "capacity":     room.Capacity,
+            "seat_rows":    room.SeatRows,
+            "seat_columns": room.SeatColumns,
+        },
+        "students": len(rows),
+        "seats":    seats,
+        "unseated": unseated,
+    }, nil
+}
+
+// SeatMap returns the seat map of a room. Pengawas only see rooms they supervise.
+func (ac *AssignmentController) SeatMap(c *gin.Context) {
+    roomID := strings.TrimSpace(c.Param("id"))
+    if roomID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+        return
+    }
+    if !ac.canViewRoom(c, roomID) {
+        return
+    }
+    var room models.Room
+    if err := ac.DB.Where("id = ?", roomID).First(&room).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+        return
+    }
+    out, err := roomSeatMap(ac.DB, room)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, out)
+}
+
+type autoAssignSeatsRequest struct {
+    Order string `json:"order"`
+}
+
+var errNoSeatGrid = errors.New("room has no seat grid; set seat_rows and seat_columns first")
+
+// AutoAssignSeats reseats every siswa of the room for the active term, row by row, in
+// alphabetical (default) or random order, and returns the new seat map.
+func (ac *AssignmentController) AutoAssignSeats(c *gin.Context) {
+    roomID := strings.TrimSpace(c.Param("id"))
+    if roomID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id"})
+        return
+    }
+    var req autoAssignSeatsRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    order := strings.ToLower(strings.TrimSpace(req.Order))
+    if order == "" {
+        order = "alphabetical"
+    }
+    if order != "alphabetical" && order != "random" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "order must be alphabetical or random"})
+        return
+    }
+
+    var room models.Room
+    var studentIDs []string
+    err := ac.DB.Transaction(func(tx *gorm.DB) error {
+        var err error
+        if room, _, err = roomOccupancy(tx, roomID); err != nil {
+            return err
+        }
+        if room.SeatRows == 0 {
+            return errNoSeatGrid
+        }
+        var ids []string
+        if err := tx.Table("room_students AS rs").
+            Joins("JOIN users u ON u.id = rs.user_id_ref").
+            Where("rs.room_id_ref = ? AND rs.deleted_at IS NULL", room.ID).
+            Where(models.CurrentTermCond("rs.term_id_ref")).
+            Order("LOWER(u.full_name), u.username").
+            Pluck("rs.id", &ids).Error; err != nil {
+            return err
+        }
+        if seats := room.SeatRows * room.SeatColumns; len(ids) > seats {
+            return &roomFullError{RoomName: room.Name, Capacity: seats}
+        }
+        if order == "random" {
+            rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+        }
+        // Unseat everyone first so the seat index never sees two siswa on one seat
+        if err := tx.Model(&models.RoomStudent{}).Where("id IN ?", ids).
+            Updates(map[string]interface{}{"seat_row": nil, "seat_column": nil}).Error; err != nil {
+            return err
+        }
+        for i, id := range ids {
+            seat := map[string]interface{}{"seat_row": i/room.SeatColumns + 1, "seat_column": i%room.SeatColumns + 1}
+            if err := tx.Model(&models.RoomStudent{}).Where("id = ?", id).Updates(seat).Error; err != nil {
+                return err
+            }
+        }
+        return tx.Model(&models.RoomStudent{}).Where("id IN ?", ids).Pluck("user_id_ref", &studentIDs).Error
+    })
+    var full *roomFullError
+    switch {
+    case err == nil:
+    case errors.Is(err, gorm.ErrRecordNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+        return
+    case errors.Is(err, errNoSeatGrid):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    case errors.As(err, &full):
+        c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("room '%s' has more siswa than its %d seats", full.RoomName, full.Capacity)})
+        return
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    for _, id := range studentIDs {
+        go broadcastStudentStatus(ac.DB, ac.Hubs, id)
+    }
+    out, err := roomSeatMap(ac.DB, room)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    out["order"] = order
+    c.JSON(http.StatusOK, out)
+}
+
+type setSeatRequest struct {
+    SeatRow    *int `json:"seat_row"`
+    SeatColumn *int `json:"seat_column"`
+}
+
+// SetSeat seats a siswa of the room on a given seat; null seat_row and seat_column unseat them.
+func (ac *AssignmentController) SetSeat(c *gin.Context) {
+    roomID := strings.TrimSpace(c.Param("id"))
+    userID := strings.TrimSpace(c.Param("user_id"))
+    if roomID == "" || userID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid room_id or user_id"})
+        return
+    }
+    var req setSeatRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if (req.SeatRow == nil) != (req.SeatColumn == nil) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "seat_row and seat_column must be set together"})
+        return
+    }
+    var room models.Room
+    if err := ac.DB.Where("id = ?", roomID).First(&room).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+        return
+    }
+    if req.SeatRow != nil && (*req.SeatRow < 1 || *req.SeatRow > room.SeatRows || *req.SeatColumn < 1 || *req.SeatColumn > room.SeatColumns) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("seat is outside the %dx%d grid of the room", room.SeatRows, room.SeatColumns)})
+        return
+    }
+    res := ac.DB.Model(&models.RoomStudent{}).
+        Where("user_id_ref = ? AND room_id_ref = ?", userID, room.ID).
+        Where(models.CurrentTermCond("term_id_ref")).
+        Updates(map[string]interface{}{"seat_row": req.SeatRow, "seat_column": req.SeatColumn})
+    if res.Error != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(res.Error, &pgErr) && pgErr.Code == "23505" {
+            c.JSON(http.StatusConflict, gin.H{"error": "seat is already taken"})
+            return
+        }
+        c.JSON(http.StatusBadRequest, gin.H{"error": res.Error.Error()})
+        return
+    }
+    if res.RowsAffected == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": errStudentNotInRoom.Error()})
+        return
+    }
+    go broadcastStudentStatus(ac.DB, ac.Hubs, userID)
+    c.JSON(http.StatusOK, gin.H{"message": "updated", "seat_row": req.SeatRow, "seat_column": req.SeatColumn})
+}
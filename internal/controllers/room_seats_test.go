@@ -0,0 +1,151 @@
+package controllers
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+type seatMapResult struct {
+    Students int         `json:"students"`
+    Seats    []seatEntry `json:"seats"`
+    Unseated []seatEntry `json:"unseated"`
+}
+
+func seatRoom(t *testing.T, db *gorm.DB, room *models.Room, names ...string) []models.User {
+    t.Helper()
+    mustCreate(t, db, room)
+    users := make([]models.User, 0, len(names))
+    for _, name := range names {
+        u := createTestUser(t, db, models.User{FullName: name, Email: fmt.Sprintf("%s@school.test", name), Role: "siswa"}, "rahasia123")
+        mustCreate(t, db, &models.RoomStudent{UserIDRef: u.ID, RoomIDRef: room.ID})
+        users = append(users, u)
+    }
+    return users
+}
+
+func TestAutoAssignSeats(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    room := models.Room{Name: "Lab 1", Active: true, SeatRows: 2, SeatColumns: 2}
+    seatRoom(t, db, &room, "Cici", "ani", "Budi")
+    param := gin.Param{Key: "id", Value: room.ID}
+
+    w := callHandler(ac.AutoAssignSeats, http.MethodPost, "/", "", nil, param)
+    if w.Code != http.StatusOK {
+        t.Fatalf("auto assign: %d %s", w.Code, w.Body.String())
+    }
+    var res seatMapResult
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+        t.Fatal(err)
+    }
+    // alphabetical, case-insensitive, row by row
+    want := []struct {
+        name     string
+        row, col int
+    }{{"ani", 1, 1}, {"Budi", 1, 2}, {"Cici", 2, 1}}
+    if res.Students != 3 || len(res.Seats) != 3 || len(res.Unseated) != 0 {
+        t.Fatalf("seat map %+v, want 3 seated siswa", res)
+    }
+    for i, s := range res.Seats {
+        if s.FullName != want[i].name || *s.SeatRow != want[i].row || *s.SeatColumn != want[i].col {
+            t.Fatalf("seat %d = %s at %d/%d, want %+v", i, s.FullName, *s.SeatRow, *s.SeatColumn, want[i])
+        }
+    }
+
+    w = callHandler(ac.AutoAssignSeats, http.MethodPost, "/", `{"order":"random"}`, nil, param)
+    if w.Code != http.StatusOK {
+        t.Fatalf("random auto assign: %d %s", w.Code, w.Body.String())
+    }
+    res = seatMapResult{}
+    if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+        t.Fatal(err)
+    }
+    taken := map[[2]int]bool{}
+    for _, s := range res.Seats {
+        seat := [2]int{*s.SeatRow, *s.SeatColumn}
+        if taken[seat] || seat[0] > 2 || seat[1] > 2 {
+            t.Fatalf("random order produced seat %v twice or outside the grid", seat)
+        }
+        taken[seat] = true
+    }
+    if len(taken) != 3 {
+        t.Fatalf("random order seated %d siswa, want 3", len(taken))
+    }
+
+    if w := callHandler(ac.AutoAssignSeats, http.MethodPost, "/", `{"order":"by-height"}`, nil, param); w.Code != http.StatusBadRequest {
+        t.Fatalf("unknown order: %d, want 400", w.Code)
+    }
+}
+
+func TestAutoAssignSeatsRejects(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    noGrid := models.Room{Name: "Aula", Active: true}
+    seatRoom(t, db, &noGrid, "ani")
+    small := models.Room{Name: "Lab 1", Active: true, SeatRows: 1, SeatColumns: 2}
+    seatRoom(t, db, &small, "budi", "cici", "dewi")
+
+    if w := callHandler(ac.AutoAssignSeats, http.MethodPost, "/", "", nil, gin.Param{Key: "id", Value: noGrid.ID}); w.Code != http.StatusBadRequest {
+        t.Fatalf("room without grid: %d %s, want 400", w.Code, w.Body.String())
+    }
+    if w := callHandler(ac.AutoAssignSeats, http.MethodPost, "/", "", nil, gin.Param{Key: "id", Value: small.ID}); w.Code != http.StatusConflict {
+        t.Fatalf("more siswa than seats: %d %s, want 409", w.Code, w.Body.String())
+    }
+    if n := countRows(t, db, "room_students", "room_id_ref = ? AND seat_row IS NOT NULL", small.ID); n != 0 {
+        t.Fatalf("a rejected auto assign seated %d siswa", n)
+    }
+}
+
+func TestSetSeat(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    room := models.Room{Name: "Lab 1", Active: true, SeatRows: 2, SeatColumns: 2}
+    users := seatRoom(t, db, &room, "ani", "budi")
+    set := func(user models.User, body string) int {
+        return callHandler(ac.SetSeat, http.MethodPut, "/", body, nil,
+            gin.Param{Key: "id", Value: room.ID}, gin.Param{Key: "user_id", Value: user.ID}).Code
+    }
+
+    for _, tc := range []struct {
+        name string
+        user models.User
+        body string
+        want int
+    }{
+        {"free seat", users[0], `{"seat_row":1,"seat_column":2}`, http.StatusOK},
+        {"taken seat", users[1], `{"seat_row":1,"seat_column":2}`, http.StatusConflict},
+        {"outside the grid", users[1], `{"seat_row":3,"seat_column":1}`, http.StatusBadRequest},
+        {"row without column", users[1], `{"seat_row":1}`, http.StatusBadRequest},
+        {"unseat", users[0], `{"seat_row":null,"seat_column":null}`, http.StatusOK},
+        {"seat freed by unseat", users[1], `{"seat_row":1,"seat_column":2}`, http.StatusOK},
+    } {
+        if code := set(tc.user, tc.body); code != tc.want {
+            t.Fatalf("%s: got %d, want %d", tc.name, code, tc.want)
+        }
+    }
+}
+
+func TestMoveStudentIntoFullRoom(t *testing.T) {
+    db := newTestDB(t)
+    ac := &AssignmentController{DB: db}
+    from := models.Room{Name: "Lab 1", Active: true}
+    full := models.Room{Name: "Lab 2", Active: true, Capacity: 1}
+    users := seatRoom(t, db, &from, "ani")
+    seatRoom(t, db, &full, "budi")
+
+    w := callHandler(ac.MoveStudent, http.MethodPost, "/", `{"room_id":"`+full.ID+`"}`, nil,
+        gin.Param{Key: "id", Value: from.ID}, gin.Param{Key: "user_id", Value: users[0].ID})
+    if w.Code != http.StatusConflict {
+        t.Fatalf("move into a full room: %d %s, want 409", w.Code, w.Body.String())
+    }
+    if n := countRows(t, db, "room_students", "user_id_ref = ? AND room_id_ref = ? AND deleted_at IS NULL", users[0].ID, from.ID); n != 1 {
+        t.Fatal("a rejected move removed the siswa from the source room")
+    }
+}
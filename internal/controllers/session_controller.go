@@ -0,0 +1,195 @@
+package controllers
+
+import (
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// SessionController lists and revokes refresh-token sessions, for the current user
+// and (admin) for any user.
+type SessionController struct {
+    DB *gorm.DB
+}
+
+type sessionRow struct {
+    SessionID        string     `gorm:"column:session_id"`
+    SessionStartedAt *time.Time `gorm:"column:session_started_at"`
+    Platform         string     `gorm:"column:platform"`
+    IPAddress        string     `gorm:"column:ip_address"`
+    UserAgent        string     `gorm:"column:user_agent"`
+    LastRefreshAt    time.Time  `gorm:"column:last_refresh_at"`
+    ExpiresAt        time.Time  `gorm:"column:expires_at"`
+    DeviceRef        *string    `gorm:"column:device_ref"`
+    DeviceID         *string    `gorm:"column:device_id"`
+    DeviceModel      *string    `gorm:"column:device_model"`
+    OSVersion        *string    `gorm:"column:os_version"`
+}
+
+// activeSessions returns one row per live session (non-revoked, unexpired refresh token).
+func activeSessions(db *gorm.DB, userID string) ([]sessionRow, error) {
+    var rows []sessionRow
+    err := db.Table("refresh_tokens AS rt").
+        Select(`
+            COALESCE(rt.session_id, rt.id) AS session_id,
+            COALESCE(rt.session_started_at, rt.created_at) AS session_started_at,
+            rt.platform, rt.ip_address, rt.user_agent,
+            rt.created_at AS last_refresh_at,
+            rt.expires_at,
+            d.id AS device_ref, d.device_id AS device_id, d.model AS device_model, d.os_version AS os_version`).
+        Joins("LEFT JOIN devices d ON d.id = rt.device_id_ref").
+        Where("rt.user_id_ref = ? AND rt.revoked_at IS NULL AND rt.expires_at > ?", userID, time.Now().UTC()).
+        Order("rt.created_at DESC").
+        Scan(&rows).Error
+    return rows, err
+}
+
+// revokeSession revokes the active refresh token of one of the user's sessions. Ids
+// that are not UUIDs match no session.
+func revokeSession(db *gorm.DB, userID, sessionID string) (int64, error) {
+    if _, err := uuid.Parse(userID); err != nil {
+        return 0, nil
+    }
+    if _, err := uuid.Parse(sessionID); err != nil {
+        return 0, nil
+    }
+    res := db.Model(&models.RefreshToken{}).
+        Where("user_id_ref = ? AND revoked_at IS NULL AND COALESCE(session_id, id) = ?", userID, sessionID).
+        Update("revoked_at", time.Now().UTC())
+    return res.RowsAffected, res.Error
+}
+
+func sessionsResponse(rows []sessionRow, currentSessionID string) []gin.H {
+    out := make([]gin.H, 0, len(rows))
+    for _, r := range rows {
+        var device gin.H
+        if r.DeviceRef != nil {
+            device = gin.H{
+                "id":         *r.DeviceRef,
+                "device_id":  strOrEmptyPtr(r.DeviceID),
+                "model":      strOrEmptyPtr(r.DeviceModel),
+                "os_version": strOrEmptyPtr(r.OSVersion),
+            }
+        }
+        out = append(out, gin.H{
+            "id":              r.SessionID,
+            "current":         currentSessionID != "" && r.SessionID == currentSessionID,
+            "platform":        r.Platform,
+            "ip_address":      r.IPAddress,
+            "user_agent":      r.UserAgent,
+            "device":          device,
+            "started_at":      r.SessionStartedAt,
+            "last_refresh_at": r.LastRefreshAt,
+            "expires_at":      r.ExpiresAt,
+        })
+    }
+    return out
+}
+
+func strOrEmptyPtr(val *string) string {
+    if val == nil {
+        return ""
+    }
+    return *val
+}
+
+// ListMine returns the current user's active sessions.
+func (sc *SessionController) ListMine(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    user := uVal.(models.User)
+    rows, err := activeSessions(sc.DB, user.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"data": sessionsResponse(rows, c.GetString("session_id"))})
+}
+
+// RevokeMine revokes one of the current user's sessions.
+func (sc *SessionController) RevokeMine(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    user := uVal.(models.User)
+    sessionID := strings.TrimSpace(c.Param("session_id"))
+    if sessionID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid session_id"})
+        return
+    }
+    n, err := revokeSession(sc.DB, user.ID, sessionID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if n == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
+
+// RevokeAllMine revokes all of the current user's sessions, including access tokens.
+func (sc *SessionController) RevokeAllMine(c *gin.Context) {
+    uVal, _ := c.Get("user")
+    user := uVal.(models.User)
+    if err := invalidateUserTokens(sc.DB, user.ID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
+
+// ListForUser returns active sessions of :user_id (admin).
+func (sc *SessionController) ListForUser(c *gin.Context) {
+    userID := strings.TrimSpace(c.Param("user_id"))
+    var u models.User
+    if err := sc.DB.Where("id = ?", userID).First(&u).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+        return
+    }
+    rows, err := activeSessions(sc.DB, u.ID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"data": sessionsResponse(rows, "")})
+}
+
+// RevokeForUser revokes one session of :user_id (admin).
+func (sc *SessionController) RevokeForUser(c *gin.Context) {
+    userID := strings.TrimSpace(c.Param("user_id"))
+    sessionID := strings.TrimSpace(c.Param("session_id"))
+    if userID == "" || sessionID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id or session_id"})
+        return
+    }
+    n, err := revokeSession(sc.DB, userID, sessionID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if n == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
+
+// RevokeAllForUser revokes every session of :user_id (admin), including access tokens.
+func (sc *SessionController) RevokeAllForUser(c *gin.Context) {
+    userID := strings.TrimSpace(c.Param("user_id"))
+    var u models.User
+    if err := sc.DB.Where("id = ?", userID).First(&u).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+        return
+    }
+    if err := invalidateUserTokens(sc.DB, u.ID); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "revoked"})
+}
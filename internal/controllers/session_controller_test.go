@@ -0,0 +1,80 @@
+package controllers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
+)
+
+func TestSessionsListAndRevoke(t *testing.T) {
+    db := newTestDB(t)
+    guru := createTestUser(t, db, models.User{FullName: "Guru", Email: "guru@school.test", Role: "pengawas"}, "rahasia123")
+    other := createTestUser(t, db, models.User{FullName: "Lain", Email: "lain@school.test", Role: "pengawas"}, "rahasia123")
+    a := newTestAuthController(db)
+    sc := &SessionController{DB: db}
+
+    _, phone := loginTokens(t, a, guru.Email, "rahasia123")
+    _, laptop := loginTokens(t, a, guru.Email, "rahasia123")
+    _, otherRefresh := loginTokens(t, a, other.Email, "rahasia123")
+    sessionOf := func(refresh string) string {
+        t.Helper()
+        var rec models.RefreshToken
+        if err := db.Where("token_hash = ?", utils.SHA256Hex(refresh)).First(&rec).Error; err != nil {
+            t.Fatal(err)
+        }
+        return rec.SessionID
+    }
+    listed := func() []string {
+        t.Helper()
+        w := callHandler(sc.ListMine, http.MethodGet, "/api/v1/auth/sessions", "", &guru)
+        if w.Code != http.StatusOK {
+            t.Fatalf("list: %d %s", w.Code, w.Body.String())
+        }
+        var body struct {
+            Data []struct {
+                ID string `json:"id"`
+            } `json:"data"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+            t.Fatal(err)
+        }
+        ids := make([]string, 0, len(body.Data))
+        for _, s := range body.Data {
+            ids = append(ids, s.ID)
+        }
+        return ids
+    }
+    revoke := func(sessionID string) int {
+        return callHandler(sc.RevokeMine, http.MethodPost, "/api/v1/auth/sessions/"+sessionID+"/revoke", "", &guru,
+            gin.Param{Key: "session_id", Value: sessionID}).Code
+    }
+
+    if ids := listed(); len(ids) != 2 {
+        t.Fatalf("sessions = %v, want the two logins", ids)
+    }
+    phoneSession := sessionOf(phone)
+    if code := revoke(phoneSession); code != http.StatusOK {
+        t.Fatalf("revoke own session: %d", code)
+    }
+    if ids := listed(); len(ids) != 1 || ids[0] != sessionOf(laptop) {
+        t.Fatalf("sessions after revoke = %v, want only the laptop", ids)
+    }
+    if w := refreshWith(t, a, phone); w.Code != http.StatusUnauthorized {
+        t.Fatalf("refresh of a revoked session: %d %s", w.Code, w.Body.String())
+    }
+    if w := refreshWith(t, a, laptop); w.Code != http.StatusOK {
+        t.Fatalf("refresh of the remaining session: %d %s", w.Code, w.Body.String())
+    }
+
+    // Unknown, foreign and malformed ids are all "not found"
+    for _, id := range []string{phoneSession, sessionOf(otherRefresh), "not-a-uuid"} {
+        if code := revoke(id); code != http.StatusNotFound {
+            t.Fatalf("revoke %q: %d, want 404", id, code)
+        }
+    }
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "github.com/jackc/pgx/v5/pgconn"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// includeDeleted reports whether a listing asked for soft-deleted rows too.
+func includeDeleted(c *gin.Context) bool {
+    return strings.EqualFold(c.Query("include_deleted"), "true") || c.Query("include_deleted") == "1"
+}
+
+func permanentDelete(c *gin.Context) bool {
+    return strings.EqualFold(c.Query("permanent"), "true") || c.Query("permanent") == "1"
+}
+
+var errAlreadyDeleted = errors.New("already deleted")
+
+// softDelete marks the row of model with id as deleted. Room assignments referencing it
+// through assignmentColumn (when set) are soft-deleted with the same timestamp, so that
+// restore brings back exactly those. after runs in the same transaction.
+func softDelete(c *gin.Context, db *gorm.DB, entity string, model interface{}, id, assignmentColumn string, after func(tx *gorm.DB) error) {
+    if _, err := uuid.Parse(id); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    now := time.Now().UTC().Truncate(time.Microsecond)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        res := tx.Model(model).Where("id = ?", id).Update("deleted_at", now)
+        if res.Error != nil {
+            return res.Error
+        }
+        if res.RowsAffected == 0 {
+            var n int64
+            if err := tx.Unscoped().Model(model).Where("id = ?", id).Count(&n).Error; err != nil {
+                return err
+            }
+            if n > 0 {
+                return errAlreadyDeleted
+            }
+            return errDeleteNotFound
+        }
+        if assignmentColumn != "" {
+            for _, m := range []interface{}{&models.RoomStudent{}, &models.RoomSupervisor{}} {
+                if err := tx.Model(m).Where(assignmentColumn+" = ?", id).Update("deleted_at", now).Error; err != nil {
+                    return err
+                }
+            }
+        }
+        if after != nil {
+            return after(tx)
+        }
+        return nil
+    })
+    switch {
+    case err == nil:
+        c.JSON(http.StatusOK, gin.H{"message": "deleted", "deleted_at": now})
+    case errors.Is(err, errDeleteNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": entity + " not found"})
+    case errors.Is(err, errAlreadyDeleted):
+        c.JSON(http.StatusConflict, gin.H{"error": entity + " is already deleted"})
+    default:
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    }
+}
+
+// restoreDeleted clears deleted_at of the row of model with id and of the room
+// assignments that were deleted together with it. Returns 409 when a live row now holds
+// the same unique value (name, code, email, ...).
+func restoreDeleted(c *gin.Context, db *gorm.DB, entity string, model interface{}, id, assignmentColumn string) {
+    if _, err := uuid.Parse(id); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+        return
+    }
+    var deletedAt []*time.Time
+    if err := db.Unscoped().Model(model).Where("id = ?", id).Pluck("deleted_at", &deletedAt).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    if len(deletedAt) == 0 {
+        c.JSON(http.StatusNotFound, gin.H{"error": entity + " not found"})
+        return
+    }
+    if deletedAt[0] == nil {
+        c.JSON(http.StatusConflict, gin.H{"error": entity + " is not deleted"})
+        return
+    }
+    restored := int64(0)
+    err := db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Unscoped().Model(model).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+            return err
+        }
+        if assignmentColumn == "" {
+            return nil
+        }
+        for _, m := range []interface{}{&models.RoomStudent{}, &models.RoomSupervisor{}} {
+            res := tx.Unscoped().Model(m).Where(assignmentColumn+" = ? AND deleted_at = ?", id, *deletedAt[0]).Update("deleted_at", nil)
+            if res.Error != nil {
+                return res.Error
+            }
+            restored += res.RowsAffected
+        }
+        return nil
+    })
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            c.JSON(http.StatusConflict, gin.H{"error": "cannot restore " + entity + ": " + pgErr.Detail})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"message": "restored", "restored_assignments": restored})
+}
+
+// PurgeJob permanently removes soft-deleted users, rooms, majors and room assignments
+// once they are older than the retention period, together with the rows referencing them.
+type PurgeJob struct {
+    DB        *gorm.DB
+    Retention time.Duration
+    Interval  time.Duration
+}
+
+func NewPurgeJob(db *gorm.DB, cfg *config.Config) *PurgeJob {
+    pj := &PurgeJob{DB: db, Retention: 30 * 24 * time.Hour, Interval: time.Hour}
+    if v := strings.TrimSpace(cfg.SoftDeleteRetentionDays); v != "" {
+        if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+            pj.Retention = time.Duration(n) * 24 * time.Hour
+        }
+    }
+    return pj
+}
+
+// Run purges every Interval until ctx is cancelled; a zero retention disables it.
+func (pj *PurgeJob) Run(ctx context.Context) {
+    if pj.Retention <= 0 {
+        return
+    }
+    ticker := time.NewTicker(pj.Interval)
+    defer ticker.Stop()
+    for {
+        purged, skipped, err := pj.purgeOnce(time.Now().UTC().Add(-pj.Retention))
+        if err != nil {
+            log.Printf("soft delete purge: %v", err)
+        }
+        if purged > 0 || skipped > 0 {
+            log.Printf("soft delete purge: %d rows purged, %d skipped", purged, skipped)
+        }
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// purgeOnce purges the users, rooms and majors deleted before cutoff, one transaction per
+// row. A row that fails (e.g. referenced from a table its dependency list misses) is
+// logged and skipped so the rest of the batch still goes; the next run retries it.
+// err is only set when the candidates cannot be listed.
+func (pj *PurgeJob) purgeOnce(cutoff time.Time) (purged, skipped int, err error) {
+    for _, m := range []interface{}{&models.RoomStudent{}, &models.RoomSupervisor{}} {
+        if err := pj.DB.Unscoped().Where("deleted_at < ?", cutoff).Delete(m).Error; err != nil {
+            return purged, skipped, err
+        }
+    }
+    targets := []struct {
+        entity string
+        model  func() interface{}
+        deps   []dependency
+    }{
+        {"user", func() interface{} { return &models.User{} }, userDependencies},
+        {"room", func() interface{} { return &models.Room{} }, roomDependencies},
+        {"major", func() interface{} { return &models.Major{} }, majorDependencies},
+    }
+    for _, t := range targets {
+        var ids []string
+        if err := pj.DB.Unscoped().Model(t.model()).Where("deleted_at < ?", cutoff).Pluck("id", &ids).Error; err != nil {
+            return purged, skipped, err
+        }
+        for _, id := range ids {
+            if err := pj.DB.Transaction(func(tx *gorm.DB) error {
+                if err := removeDependencies(tx, id, t.deps); err != nil {
+                    return err
+                }
+                return tx.Unscoped().Where("id = ?", id).Delete(t.model()).Error
+            }); err != nil {
+                log.Printf("soft delete purge: skip %s %s: %v", t.entity, id, err)
+                skipped++
+                continue
+            }
+            purged++
+        }
+    }
+    return purged, skipped, nil
+}
@@ -0,0 +1,120 @@
+package controllers
+
+import (
+    "encoding/json"
+    "net/http"
+    "testing"
+    "time"
+
+    "github.com/gin-gonic/gin"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+func TestSoftDeleteAndRestoreRoom(t *testing.T) {
+    db := newTestDB(t)
+    rc := &RoomController{DB: db}
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    ani := createTestUser(t, db, models.User{FullName: "Ani", Email: "ani@school.test", Role: "siswa"}, "rahasia123")
+    room := models.Room{Name: "Lab 1", Active: true}
+    mustCreate(t, db, &room)
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: room.ID})
+    // removed from the room before: must stay removed after the restore
+    earlier := models.RoomStudent{UserIDRef: ani.ID, RoomIDRef: room.ID}
+    mustCreate(t, db, &earlier)
+    if err := db.Delete(&earlier).Error; err != nil {
+        t.Fatal(err)
+    }
+    param := gin.Param{Key: "id", Value: room.ID}
+
+    if w := callHandler(rc.DeleteRoom, http.MethodDelete, "/", "", nil, param); w.Code != http.StatusOK {
+        t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+    }
+    if n := countRows(t, db, "rooms", "id = ? AND deleted_at IS NULL", room.ID); n != 0 {
+        t.Fatal("room still live after the delete")
+    }
+    if n := countRows(t, db, "room_students", "room_id_ref = ? AND deleted_at IS NULL", room.ID); n != 0 {
+        t.Fatalf("%d live assignments of a deleted room", n)
+    }
+    if w := callHandler(rc.DeleteRoom, http.MethodDelete, "/", "", nil, param); w.Code != http.StatusConflict {
+        t.Fatalf("second delete: %d, want 409", w.Code)
+    }
+
+    w := callHandler(rc.RestoreRoom, http.MethodPost, "/", "", nil, param)
+    if w.Code != http.StatusOK {
+        t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+    }
+    var body struct {
+        RestoredAssignments int64 `json:"restored_assignments"`
+    }
+    if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+        t.Fatal(err)
+    }
+    if body.RestoredAssignments != 1 {
+        t.Fatalf("restored %d assignments, want 1", body.RestoredAssignments)
+    }
+    if n := countRows(t, db, "room_students", "room_id_ref = ? AND deleted_at IS NULL", room.ID); n != 1 {
+        t.Fatalf("%d live assignments after restore, want only budi's", n)
+    }
+    if w := callHandler(rc.RestoreRoom, http.MethodPost, "/", "", nil, param); w.Code != http.StatusConflict {
+        t.Fatalf("restore of a live room: %d, want 409", w.Code)
+    }
+}
+
+func TestRestoreRoomNameTaken(t *testing.T) {
+    db := newTestDB(t)
+    rc := &RoomController{DB: db}
+    room := models.Room{Name: "Lab 1", Active: true}
+    mustCreate(t, db, &room)
+    param := gin.Param{Key: "id", Value: room.ID}
+    if w := callHandler(rc.DeleteRoom, http.MethodDelete, "/", "", nil, param); w.Code != http.StatusOK {
+        t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+    }
+    // the name is free again once the room is deleted
+    mustCreate(t, db, &models.Room{Name: "Lab 1", Active: true})
+    if w := callHandler(rc.RestoreRoom, http.MethodPost, "/", "", nil, param); w.Code != http.StatusConflict {
+        t.Fatalf("restore over a live name: %d %s, want 409", w.Code, w.Body.String())
+    }
+}
+
+func TestPurgeSkipsFailingRows(t *testing.T) {
+    db := newTestDB(t)
+    budi := createTestUser(t, db, models.User{FullName: "Budi", Email: "budi@school.test", Role: "siswa"}, "rahasia123")
+    old := time.Now().UTC().Add(-48 * time.Hour)
+    blocked := models.Room{Name: "Lab 1", Active: true}
+    purgeable := models.Room{Name: "Lab 2", Active: true}
+    recent := models.Room{Name: "Lab 3", Active: true}
+    for _, r := range []*models.Room{&blocked, &purgeable, &recent} {
+        mustCreate(t, db, r)
+    }
+    mustCreate(t, db, &models.RoomStudent{UserIDRef: budi.ID, RoomIDRef: purgeable.ID})
+    db.Model(&models.RoomStudent{}).Where("room_id_ref = ?", purgeable.ID).Update("deleted_at", old)
+    db.Model(&models.Room{}).Where("id IN ?", []string{blocked.ID, purgeable.ID}).Update("deleted_at", old)
+    db.Model(&models.Room{}).Where("id = ?", recent.ID).Update("deleted_at", time.Now().UTC())
+    // a reference roomDependencies does not know about makes the purge of Lab 1 fail
+    for _, stmt := range []string{
+        "CREATE TABLE purge_blockers (room_id_ref uuid REFERENCES rooms (id))",
+        "INSERT INTO purge_blockers VALUES ('" + blocked.ID + "')",
+    } {
+        if err := db.Exec(stmt).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    pj := &PurgeJob{DB: db, Retention: 24 * time.Hour}
+    purged, skipped, err := pj.purgeOnce(time.Now().UTC().Add(-pj.Retention))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if purged != 1 || skipped != 1 {
+        t.Fatalf("purged %d, skipped %d; want 1 and 1", purged, skipped)
+    }
+    for id, want := range map[string]int64{blocked.ID: 1, purgeable.ID: 0, recent.ID: 1} {
+        if n := countRows(t, db, "rooms", "id = ?", id); n != want {
+            t.Fatalf("room %s: %d rows, want %d", id, n, want)
+        }
+    }
+    if n := countRows(t, db, "room_students", "room_id_ref = ?", purgeable.ID); n != 0 {
+        t.Fatalf("%d assignments of the purged room remain", n)
+    }
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/config"
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// singleRoomPerStudent reads AppConfig single_room_per_student, falling back to env
+// SINGLE_ROOM_PER_STUDENT. It is on unless set to false: a siswa is then in at most one
+// room per term and changes rooms through the move endpoint.
+func singleRoomPerStudent(db *gorm.DB, cfg *config.Config) (bool, error) {
+    fallback := ""
+    if cfg != nil {
+        fallback = cfg.SingleRoomPerStudent
+    }
+    v, err := appConfigValue(db, "single_room_per_student", fallback)
+    if err != nil {
+        return false, err
+    }
+    switch strings.ToLower(v) {
+    case "false", "0", "no", "off":
+        return false, nil
+    }
+    return true, nil
+}
+
+// studentRoomConflict is returned by checkSingleRoom when the siswa is already in
+// another room of the active term.
+type studentRoomConflict struct {
+    RoomID   string
+    RoomName string
+}
+
+func (e *studentRoomConflict) Error() string {
+    return fmt.Sprintf("siswa is already in room '%s'; move them instead", e.RoomName)
+}
+
+// checkSingleRoom locks the siswa's user row, so concurrent assignments serialize, and
+// fails with *studentRoomConflict when they are in a room other than roomID for the
+// active term. Call it in the transaction that assigns the siswa.
+func checkSingleRoom(tx *gorm.DB, userID, roomID string) error {
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userID).First(&models.User{}).Error; err != nil {
+        return err
+    }
+    var other struct {
+        RoomID   string
+        RoomName string
+    }
+    if err := tx.Table("room_students AS rs").
+        Select("r.id AS room_id, r.name AS room_name").
+        Joins("JOIN rooms r ON r.id = rs.room_id_ref").
+        Where("rs.user_id_ref = ? AND rs.room_id_ref <> ? AND rs.deleted_at IS NULL", userID, roomID).
+        Where(models.CurrentTermCond("rs.term_id_ref")).
+        Limit(1).
+        Scan(&other).Error; err != nil {
+        return err
+    }
+    if other.RoomID != "" {
+        return &studentRoomConflict{RoomID: other.RoomID, RoomName: other.RoomName}
+    }
+    return nil
+}
+
+// studentRoom returns the room assignment of a siswa for the active term, nil when there
+// is none. If several exist (single_room_per_student off, or rows from before it was
+// enforced) the most recent one is authoritative.
+func studentRoom(db *gorm.DB, userID string) (*models.RoomStudent, error) {
+    var rs models.RoomStudent
+    if err := db.Where("user_id_ref = ?", userID).Where(models.CurrentTermCond("term_id_ref")).Order("created_at DESC").Take(&rs).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    return &rs, nil
+}
+
+// studentRoomJoin joins "rs" to the studentRoom of each siswa "u" in list queries.
+var studentRoomJoin = "LEFT JOIN LATERAL (SELECT room_id_ref, seat_row, seat_column FROM room_students WHERE user_id_ref = u.id AND deleted_at IS NULL AND " +
+    models.CurrentTermCond("term_id_ref") + " ORDER BY created_at DESC LIMIT 1) rs ON TRUE"
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/ws"
+)
+
+// Supported AlertRule conditions.
+const (
+    ruleConditionUnlockWithoutExitCode = "unlocked_without_exit_code"
+    ruleConditionLockFlips             = "lock_flips"
+)
+
+// Supported AlertRule actions.
+const (
+    ruleActionBlock           = "block"
+    ruleActionForceLogout     = "force_logout"
+    ruleActionAlertSupervisor = "alert_supervisor"
+)
+
+// exitCodeUnlockWindow is how long an exit code consumed by a pengawas/admin on
+// behalf of a student authorizes the student's next unlock.
+const exitCodeUnlockWindow = 5 * time.Minute
+
+var validRuleConditions = map[string]struct{}{
+    ruleConditionUnlockWithoutExitCode: {},
+    ruleConditionLockFlips:             {},
+}
+
+var validRuleActions = map[string]struct{}{
+    ruleActionBlock:           {},
+    ruleActionForceLogout:     {},
+    ruleActionAlertSupervisor: {},
+}
+
+func ruleActions(rule models.AlertRule) []string {
+    var actions []string
+    if len(rule.Actions) == 0 {
+        return actions
+    }
+    if err := json.Unmarshal(rule.Actions, &actions); err != nil {
+        log.Printf("alert rule %s: invalid actions: %v", rule.ID, err)
+        return nil
+    }
+    return actions
+}
+
+// updateStudentStatus applies change to the status row of a user and saves it in one
+// transaction. The user row is locked first, so concurrent writes for one student
+// serialize and every lock transition is recorded exactly once, then the active
+// AlertRules run against the transition. Rule alerts are pushed to the dashboards
+// after the commit; broadcasting the new status is left to the caller.
+func updateStudentStatus(db *gorm.DB, hubs *ws.Hubs, userID string, change func(st *models.StudentStatus) error) (models.StudentStatus, error) {
+    var st models.StudentStatus
+    var alerts []ws.MonitoringAlert
+    err := db.Transaction(func(tx *gorm.DB) error {
+        var user models.User
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "full_name").Where("id = ?", userID).First(&user).Error; err != nil {
+            return err
+        }
+        if err := tx.Where("user_id_ref = ?", userID).First(&st).Error; err != nil {
+            if !errors.Is(err, gorm.ErrRecordNotFound) {
+                return err
+            }
+            st = models.StudentStatus{UserIDRef: userID}
+        }
+        if err := change(&st); err != nil {
+            return err
+        }
+        var roomID *string
+        rs, err := studentRoom(tx, userID)
+        if err != nil {
+            return err
+        }
+        if rs != nil {
+            roomID = &rs.RoomIDRef
+        }
+        if alerts, err = evaluateStudentRules(tx, user, &st, roomID); err != nil {
+            return err
+        }
+        return tx.Save(&st).Error
+    })
+    if err != nil {
+        return st, err
+    }
+    if hubs != nil && hubs.Monitoring != nil {
+        for _, alert := range alerts {
+            hubs.Monitoring.BroadcastAlert(alert)
+        }
+    }
+    return st, nil
+}
+
+// evaluateStudentRules records a lock transition of st and runs the active AlertRules
+// against it. Actions are applied to st in place for the caller to save; the alerts for
+// alert_supervisor are returned to be pushed once the transaction commits.
+func evaluateStudentRules(tx *gorm.DB, user models.User, st *models.StudentStatus, roomID *string) ([]ws.MonitoringAlert, error) {
+    now := time.Now().UTC()
+
+    var last models.StudentStatusEvent
+    err := tx.Where("user_id_ref = ?", st.UserIDRef).Order("created_at DESC").First(&last).Error
+    if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, fmt.Errorf("rules: load last event: %w", err)
+    }
+    hasLast := err == nil
+    if hasLast && last.Locked == st.Locked {
+        return nil, nil
+    }
+
+    event := models.StudentStatusEvent{UserIDRef: st.UserIDRef, Locked: st.Locked}
+    if !st.Locked {
+        event.ExitCodeBacked = !st.UnauthorizedUnlock
+    }
+    if err := tx.Create(&event).Error; err != nil {
+        return nil, fmt.Errorf("rules: record event: %w", err)
+    }
+    if !hasLast {
+        // First observation only establishes a baseline; it is not a transition.
+        return nil, nil
+    }
+
+    var rules []models.AlertRule
+    if err := tx.Where("active = ?", true).Find(&rules).Error; err != nil {
+        return nil, fmt.Errorf("rules: load rules: %w", err)
+    }
+
+    var alerts []ws.MonitoringAlert
+    blocked := false
+    forceLogout := false
+    for _, rule := range rules {
+        matched, message, err := matchRule(tx, rule, st, event, now)
+        if err != nil {
+            return nil, fmt.Errorf("rules: evaluate %s: %w", rule.ID, err)
+        }
+        if !matched {
+            continue
+        }
+        if rule.CooldownSeconds > 0 {
+            var recent int64
+            if err := tx.Model(&models.Alert{}).
+                Where("rule_id_ref = ? AND user_id_ref = ? AND created_at >= ?", rule.ID, st.UserIDRef, now.Add(-time.Duration(rule.CooldownSeconds)*time.Second)).
+                Count(&recent).Error; err != nil {
+                return nil, fmt.Errorf("rules: cooldown check %s: %w", rule.ID, err)
+            }
+            if recent > 0 {
+                continue
+            }
+        }
+
+        actions := ruleActions(rule)
+        ruleID := rule.ID
+        userID := st.UserIDRef
+        alert := models.Alert{
+            Type:      "rule_triggered",
+            UserIDRef: &userID,
+            RoomIDRef: roomID,
+            RuleIDRef: &ruleID,
+            Message:   message,
+        }
+        if err := tx.Create(&alert).Error; err != nil {
+            return nil, fmt.Errorf("rules: record alert %s: %w", rule.ID, err)
+        }
+        for _, action := range actions {
+            switch action {
+            case ruleActionBlock:
+                blocked = true
+            case ruleActionForceLogout:
+                forceLogout = true
+            case ruleActionAlertSupervisor:
+                alerts = append(alerts, ws.MonitoringAlert{
+                    Type:      "rule_alert",
+                    ID:        alert.ID,
+                    RuleID:    &ruleID,
+                    RuleName:  rule.Name,
+                    StudentID: st.UserIDRef,
+                    FullName:  user.FullName,
+                    RoomID:    roomID,
+                    Message:   message,
+                    Actions:   actions,
+                    CreatedAt: alert.CreatedAt,
+                })
+            }
+        }
+    }
+
+    // Both actions keep the student out of the exam until a pengawas allows it again.
+    if blocked || forceLogout {
+        st.BlockedFromExam = true
+    }
+    if forceLogout {
+        st.ForceLogoutAt = &now
+    }
+    return alerts, nil
+}
+
+func matchRule(db *gorm.DB, rule models.AlertRule, st *models.StudentStatus, event models.StudentStatusEvent, now time.Time) (bool, string, error) {
+    switch rule.Condition {
+    case ruleConditionUnlockWithoutExitCode:
+        if st.Locked || event.ExitCodeBacked {
+            return false, "", nil
+        }
+        return true, "student unlocked without using an exit code", nil
+    case ruleConditionLockFlips:
+        threshold := rule.Threshold
+        if threshold <= 0 {
+            threshold = 3
+        }
+        window := time.Duration(rule.WindowSeconds) * time.Second
+        if window <= 0 {
+            window = 5 * time.Minute
+        }
+        var flips int64
+        if err := db.Model(&models.StudentStatusEvent{}).
+            Where("user_id_ref = ? AND created_at >= ?", st.UserIDRef, now.Add(-window)).
+            Count(&flips).Error; err != nil {
+            return false, "", err
+        }
+        if flips < int64(threshold) {
+            return false, "", nil
+        }
+        return true, fmt.Sprintf("%d lock/unlock changes within %s", flips, window), nil
+    default:
+        return false, "", nil
+    }
+}
+
+// raiseStudentAlert stores an alert for a siswa and pushes it, tagged with alertType,
+// to the dashboards supervising the student's room.
+func raiseStudentAlert(db *gorm.DB, hubs *ws.Hubs, user models.User, alertType, message string) {
+    var roomID *string
+    if rs, err := studentRoom(db, user.ID); err == nil && rs != nil {
+        roomID = &rs.RoomIDRef
+    }
+    userID := user.ID
+    alert := models.Alert{
+        Type:      alertType,
+        UserIDRef: &userID,
+        RoomIDRef: roomID,
+        Message:   message,
+    }
+    if err := db.Create(&alert).Error; err != nil {
+        log.Printf("%s alert: %v", alertType, err)
+        return
+    }
+    if hubs == nil || hubs.Monitoring == nil {
+        return
+    }
+    hubs.Monitoring.BroadcastAlert(ws.MonitoringAlert{
+        Type:      alertType,
+        ID:        alert.ID,
+        StudentID: user.ID,
+        FullName:  user.FullName,
+        RoomID:    roomID,
+        Message:   alert.Message,
+        CreatedAt: alert.CreatedAt,
+    })
+}
@@ -1,8 +1,10 @@
 package controllers
 
 import (
+    "errors"
     "net/http"
     "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
     "gorm.io/gorm"
@@ -16,6 +18,8 @@ type StudentStatusController struct {
     Hubs *ws.Hubs
 }
 
+var errBlockedBySupervisor = errors.New("blocked_by_supervisor")
+
 type updateStatusRequest struct {
     AppVersion      string `json:"app_version"`
     Locked          *bool  `json:"locked"`
@@ -43,48 +47,51 @@ func (sc *StudentStatusController) UpdateSelf(c *gin.Context) {
         return
     }
 
-    var st models.StudentStatus
-    err := sc.DB.Where("user_id_ref = ?", user.ID).First(&st).Error
-    if err != nil {
-        if err == gorm.ErrRecordNotFound {
-            st = models.StudentStatus{UserIDRef: user.ID}
-            if req.AppVersion != "" { st.AppVersion = req.AppVersion }
-            if req.Locked != nil { st.Locked = *req.Locked }
-            if req.BlockedFromExam != nil { st.BlockedFromExam = *req.BlockedFromExam }
-            // If locking requested but blocked, prevent
-            if st.Locked {
-                // Check blocked flag default false
-            }
-            if err := sc.DB.Create(&st).Error; err != nil {
-                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-                return
-            }
-        } else {
-            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-            return
-        }
-    } else {
-        // Existing status
+    unauthorizedUnlock := false
+    st, err := updateStudentStatus(sc.DB, sc.Hubs, user.ID, func(st *models.StudentStatus) error {
         if req.AppVersion != "" {
             st.AppVersion = req.AppVersion
         }
         if req.Locked != nil {
             // If trying to lock while blocked, deny
             if *req.Locked && st.BlockedFromExam {
-                c.JSON(http.StatusForbidden, gin.H{"error": "blocked_by_supervisor"})
-                return
+                return errBlockedBySupervisor
+            }
+            // Leaving lockdown must be backed by a recently consumed exit code
+            if role == "siswa" && st.Locked && !*req.Locked {
+                now := time.Now().UTC()
+                if st.UnlockAuthorizedUntil != nil && !now.After(*st.UnlockAuthorizedUntil) {
+                    st.UnauthorizedUnlock = false
+                } else {
+                    st.UnauthorizedUnlock = true
+                    st.UnauthorizedUnlockAt = &now
+                    unauthorizedUnlock = true
+                }
+                st.UnlockAuthorizedUntil = nil
             }
             st.Locked = *req.Locked
         }
         if req.BlockedFromExam != nil {
             st.BlockedFromExam = *req.BlockedFromExam
         }
-        if err := sc.DB.Save(&st).Error; err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return nil
+    })
+    if err != nil {
+        if errors.Is(err, errBlockedBySupervisor) {
+            c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
             return
         }
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    if unauthorizedUnlock {
+        go func() {
+            raiseStudentAlert(sc.DB, sc.Hubs, user, "unauthorized_unlock", "student left lockdown without an exit code")
+            broadcastStudentStatus(sc.DB, sc.Hubs, user.ID)
+        }()
+    } else {
+        go broadcastStudentStatus(sc.DB, sc.Hubs, user.ID)
     }
-    go broadcastStudentStatus(sc.DB, sc.Hubs, user.ID)
 
     c.JSON(http.StatusOK, gin.H{
         "app_version":       st.AppVersion,
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+    "errors"
+    "net/http"
+    "regexp"
+    "strings"
+
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+var (
+    errIdentifierRequired = errors.New("email is required (siswa may use username/NIS instead)")
+    errInvalidUsername    = errors.New("username must be 3-64 characters of letters, digits, '.', '_' or '-'")
+    errEmailTaken         = errors.New("email already exists")
+    errUsernameTaken      = errors.New("username already exists")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9._-]{3,64}$`)
+
+// normalizeUsername lowercases a username/NIS; usernames are matched case-insensitively.
+func normalizeUsername(s string) string {
+    return strings.ToLower(strings.TrimSpace(s))
+}
+
+// checkUserIdentifiers validates the login identifiers of a user being created or
+// updated (excludeID = the user's own id on update). Staff need an email; siswa need
+// an email or a username. Conflicts return errEmailTaken / errUsernameTaken.
+func checkUserIdentifiers(db *gorm.DB, role, email, username, excludeID string) error {
+    if username != "" && !usernamePattern.MatchString(username) {
+        return errInvalidUsername
+    }
+    if email == "" && (role != "siswa" || username == "") {
+        return errIdentifierRequired
+    }
+    exists := func(where string, arg string) (bool, error) {
+        q := db.Model(&models.User{}).Where(where, arg)
+        if excludeID != "" {
+            q = q.Where("id <> ?", excludeID)
+        }
+        var n int64
+        err := q.Count(&n).Error
+        return n > 0, err
+    }
+    if email != "" {
+        taken, err := exists("email = ?", email)
+        if err != nil {
+            return err
+        }
+        if taken {
+            return errEmailTaken
+        }
+    }
+    if username != "" {
+        taken, err := exists("LOWER(username) = ?", username)
+        if err != nil {
+            return err
+        }
+        if taken {
+            return errUsernameTaken
+        }
+    }
+    return nil
+}
+
+// identifierErrorStatus maps checkUserIdentifiers errors to an HTTP status.
+func identifierErrorStatus(err error) int {
+    switch {
+    case errors.Is(err, errEmailTaken), errors.Is(err, errUsernameTaken):
+        return http.StatusConflict
+    case errors.Is(err, errIdentifierRequired), errors.Is(err, errInvalidUsername):
+        return http.StatusBadRequest
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// findUserByIdentifier looks a user up by email (identifiers containing '@') or by
+// username/NIS.
+func findUserByIdentifier(db *gorm.DB, identifier string) (models.User, error) {
+    var user models.User
+    identifier = strings.TrimSpace(identifier)
+    if identifier == "" {
+        return user, gorm.ErrRecordNotFound
+    }
+    if strings.Contains(identifier, "@") {
+        err := db.Where("email = ?", identifier).First(&user).Error
+        return user, err
+    }
+    err := db.Where("LOWER(username) = ?", normalizeUsername(identifier)).First(&user).Error
+    return user, err
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+    "errors"
+    "net/http"
+    "strings"
+
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+var (
+    errMajorNotFound  = errors.New("jurusan/major not found; use an existing major id, code or name")
+    errMajorAmbiguous = errors.New("major name matches several majors; use the code")
+)
+
+// resolveMajor finds a major by id, code or name (case-insensitive). An empty value
+// returns nil (no major).
+func resolveMajor(db *gorm.DB, value string) (*models.Major, error) {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return nil, nil
+    }
+    var m models.Major
+    if _, err := uuid.Parse(value); err == nil {
+        if err := db.Where("id = ?", value).First(&m).Error; err == nil {
+            return &m, nil
+        } else if !errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, err
+        }
+    }
+    lower := strings.ToLower(value)
+    if err := db.Where("LOWER(code) = ?", lower).First(&m).Error; err == nil {
+        return &m, nil
+    } else if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, err
+    }
+    var byName []models.Major
+    if err := db.Where("LOWER(name) = ?", lower).Limit(2).Find(&byName).Error; err != nil {
+        return nil, err
+    }
+    switch len(byName) {
+    case 0:
+        return nil, errMajorNotFound
+    case 1:
+        return &byName[0], nil
+    default:
+        return nil, errMajorAmbiguous
+    }
+}
+
+// majorErrorStatus maps resolveMajor errors to an HTTP status.
+func majorErrorStatus(err error) int {
+    if errors.Is(err, errMajorNotFound) || errors.Is(err, errMajorAmbiguous) {
+        return http.StatusBadRequest
+    }
+    return http.StatusInternalServerError
+}
+
+// firstNonBlank returns the first value that is not empty after trimming.
+func firstNonBlank(vals ...string) string {
+    for _, v := range vals {
+        if strings.TrimSpace(v) != "" {
+            return strings.TrimSpace(v)
+        }
+    }
+    return ""
+}
+
+// setUserMajor links u to m (nil clears) and mirrors the code into Jurusan.
+func setUserMajor(u *models.User, m *models.Major) {
+    if m == nil {
+        u.MajorIDRef = nil
+        u.Jurusan = ""
+        return
+    }
+    id := m.ID
+    u.MajorIDRef = &id
+    u.Jurusan = m.Code
+}
+
+// majorBlock is the major object embedded in user responses (nil when unlinked).
+func majorBlock(m *models.Major) interface{} {
+    if m == nil {
+        return nil
+    }
+    return gin.H{"id": m.ID, "code": m.Code, "name": m.Name}
+}
+
+// majorsByID loads the majors referenced by users.
+func majorsByID(db *gorm.DB, users []models.User) (map[string]*models.Major, error) {
+    ids := make([]string, 0, len(users))
+    for _, u := range users {
+        if u.MajorIDRef != nil {
+            ids = append(ids, *u.MajorIDRef)
+        }
+    }
+    out := map[string]*models.Major{}
+    if len(ids) == 0 {
+        return out, nil
+    }
+    var majors []models.Major
+    if err := db.Where("id IN ?", ids).Find(&majors).Error; err != nil {
+        return nil, err
+    }
+    for i := range majors {
+        out[majors[i].ID] = &majors[i]
+    }
+    return out, nil
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+    "net/url"
+    "os"
+    "strings"
+    "testing"
+
+    "github.com/google/uuid"
+    "gorm.io/driver/postgres"
+    "gorm.io/gorm"
+    "gorm.io/gorm/logger"
+
+    "github.com/zaqqye/seb_backend_v1/internal/models"
+)
+
+// newTestDB returns a Postgres database whose connections use an empty schema of their
+// own, dropped when the test ends. TEST_DATABASE_URL must point at a database the tests
+// may create schemas in; without it the test is skipped.
+func newTestDB(t *testing.T) *gorm.DB {
+    t.Helper()
+    dsn := strings.TrimSpace(os.Getenv("TEST_DATABASE_URL"))
+    if dsn == "" {
+        t.Skip("TEST_DATABASE_URL is not set")
+    }
+    cfg := &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)}
+    admin, err := gorm.Open(postgres.Open(dsn), cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+    // pg_trgm goes to public so the operator classes resolve from every test schema
+    for _, stmt := range []string{"CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public", "CREATE SCHEMA " + schema} {
+        if err := admin.Exec(stmt).Error; err != nil {
+            t.Fatal(err)
+        }
+    }
+    t.Cleanup(func() {
+        if err := admin.Exec("DROP SCHEMA " + schema + " CASCADE").Error; err != nil {
+            t.Logf("drop schema %s: %v", schema, err)
+        }
+        if sqlDB, err := admin.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+
+    path := schema + ",public"
+    if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+        q := u.Query()
+        q.Set("search_path", path)
+        u.RawQuery = q.Encode()
+        dsn = u.String()
+    } else {
+        dsn += " search_path=" + path
+    }
+    db, err := gorm.Open(postgres.Open(dsn), cfg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        if sqlDB, err := db.DB(); err == nil {
+            sqlDB.Close()
+        }
+    })
+    return db
+}
+
+func mustExec(t *testing.T, db *gorm.DB, sql string, args ...interface{}) {
+    t.Helper()
+    if err := db.Exec(sql, args...).Error; err != nil {
+        t.Fatalf("%s: %v", sql, err)
+    }
+}
+
+func constraintExists(t *testing.T, db *gorm.DB, name string) bool {
+    t.Helper()
+    var n int64
+    if err := db.Raw("SELECT count(*) FROM pg_constraint WHERE conname = ? AND connamespace = current_schema()::regnamespace", name).Scan(&n).Error; err != nil {
+        t.Fatal(err)
+    }
+    return n > 0
+}
+
+func TestForeignKeysRefuseOrphanedRows(t *testing.T) {
+    db := newTestDB(t)
+    if err := Migrate(db); err != nil {
+        t.Fatal(err)
+    }
+    // a database from before the constraint, holding a row of a deleted user
+    mustExec(t, db, "ALTER TABLE room_students DROP CONSTRAINT fk_room_students_user")
+    room := models.Room{Name: "Lab 1", Active: true}
+    if err := db.Create(&room).Error; err != nil {
+        t.Fatal(err)
+    }
+    mustExec(t, db, "INSERT INTO room_students (id, user_id_ref, room_id_ref) VALUES (?, ?, ?)", uuid.NewString(), uuid.NewString(), room.ID)
+    mustExec(t, db, "DELETE FROM schema_migrations WHERE version = 1")
+
+    err := Migrate(db)
+    if err == nil || !strings.Contains(err.Error(), "fk_room_students_user: 1 rows of room_students.user_id_ref") {
+        t.Fatalf("migrate with an orphan: %v, want the orphan count", err)
+    }
+    var n int64
+    db.Table("room_students").Count(&n)
+    if n != 1 || constraintExists(t, db, "fk_room_students_user") {
+        t.Fatalf("failed migration changed the data: %d rows, constraint %v", n, constraintExists(t, db, "fk_room_students_user"))
+    }
+
+    mustExec(t, db, "DELETE FROM room_students c WHERE NOT EXISTS (SELECT 1 FROM users p WHERE p.id = c.user_id_ref)")
+    if err := Migrate(db); err != nil {
+        t.Fatalf("migrate after cleanup: %v", err)
+    }
+    if !constraintExists(t, db, "fk_room_students_user") {
+        t.Fatal("constraint not added after cleanup")
+    }
+}
@@ -0,0 +1,291 @@
+package database
+
+import (
+    "embed"
+    "fmt"
+    "io"
+    "io/fs"
+    "log"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gorm.io/gorm"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the pg_advisory_lock key that serializes migrations, so replicas
+// starting at the same time apply each migration once.
+const migrationLockKey int64 = 5_301_046_001
+
+const createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version bigint PRIMARY KEY,
+    name text NOT NULL,
+    applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+// Migration is one numbered schema change, read from migrations/NNNN_name.up.sql and
+// the matching NNNN_name.down.sql. Each runs in its own transaction.
+type Migration struct {
+    Version int
+    Name    string
+    Up      string
+    Down    string
+}
+
+// MigrationState is a known migration and when it was applied (nil while pending).
+type MigrationState struct {
+    Version   int
+    Name      string
+    AppliedAt *time.Time
+}
+
+func loadMigrations() ([]Migration, error) {
+    entries, err := fs.ReadDir(migrationFiles, "migrations")
+    if err != nil {
+        return nil, err
+    }
+    byVersion := map[int]*Migration{}
+    for _, e := range entries {
+        file := e.Name()
+        var direction string
+        switch {
+        case strings.HasSuffix(file, ".up.sql"):
+            direction = "up"
+        case strings.HasSuffix(file, ".down.sql"):
+            direction = "down"
+        default:
+            continue
+        }
+        num, name, ok := strings.Cut(strings.TrimSuffix(file, "."+direction+".sql"), "_")
+        version, err := strconv.Atoi(num)
+        if !ok || err != nil || version <= 0 {
+            return nil, fmt.Errorf("migration %s: expected NNNN_name.%s.sql", file, direction)
+        }
+        body, err := migrationFiles.ReadFile("migrations/" + file)
+        if err != nil {
+            return nil, err
+        }
+        m := byVersion[version]
+        if m == nil {
+            m = &Migration{Version: version, Name: name}
+            byVersion[version] = m
+        } else if m.Name != name {
+            return nil, fmt.Errorf("migration %d: conflicting names %q and %q", version, m.Name, name)
+        }
+        if direction == "up" {
+            m.Up = string(body)
+        } else {
+            m.Down = string(body)
+        }
+    }
+    out := make([]Migration, 0, len(byVersion))
+    for _, m := range byVersion {
+        if m.Up == "" {
+            return nil, fmt.Errorf("migration %04d_%s: missing up file", m.Version, m.Name)
+        }
+        out = append(out, *m)
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+    return out, nil
+}
+
+// withMigrationLock runs fn on a single connection holding the migration advisory lock.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+    return db.Connection(func(conn *gorm.DB) error {
+        if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+            return err
+        }
+        defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+        if err := conn.Exec(createSchemaMigrations).Error; err != nil {
+            return err
+        }
+        return fn(conn)
+    })
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]time.Time, error) {
+    var rows []struct {
+        Version   int
+        AppliedAt time.Time
+    }
+    if err := db.Raw("SELECT version, applied_at FROM schema_migrations").Scan(&rows).Error; err != nil {
+        return nil, err
+    }
+    out := make(map[int]time.Time, len(rows))
+    for _, r := range rows {
+        out[r.Version] = r.AppliedAt
+    }
+    return out, nil
+}
+
+// Migrate applies all pending migrations.
+func Migrate(db *gorm.DB) error {
+    applied, err := MigrateUp(db, 0)
+    for _, m := range applied {
+        log.Printf("migration %04d_%s applied", m.Version, m.Name)
+    }
+    return err
+}
+
+// MigrateUp applies up to steps pending migrations in version order (all when steps <= 0)
+// and returns the ones applied, also when a later one fails.
+func MigrateUp(db *gorm.DB, steps int) ([]Migration, error) {
+    migrations, err := loadMigrations()
+    if err != nil {
+        return nil, err
+    }
+    var applied []Migration
+    err = withMigrationLock(db, func(conn *gorm.DB) error {
+        done, err := appliedMigrations(conn)
+        if err != nil {
+            return err
+        }
+        for _, m := range migrations {
+            if _, ok := done[m.Version]; ok {
+                continue
+            }
+            if steps > 0 && len(applied) == steps {
+                break
+            }
+            if err := conn.Transaction(func(tx *gorm.DB) error {
+                if err := tx.Exec(m.Up).Error; err != nil {
+                    return err
+                }
+                return tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name).Error
+            }); err != nil {
+                return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+            }
+            applied = append(applied, m)
+        }
+        return nil
+    })
+    return applied, err
+}
+
+// MigrateDown rolls back the steps most recently applied migrations (at least one).
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+    migrations, err := loadMigrations()
+    if err != nil {
+        return nil, err
+    }
+    if steps <= 0 {
+        steps = 1
+    }
+    known := make(map[int]Migration, len(migrations))
+    for _, m := range migrations {
+        known[m.Version] = m
+    }
+    var reverted []Migration
+    err = withMigrationLock(db, func(conn *gorm.DB) error {
+        done, err := appliedMigrations(conn)
+        if err != nil {
+            return err
+        }
+        versions := make([]int, 0, len(done))
+        for v := range done {
+            versions = append(versions, v)
+        }
+        sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+        for _, v := range versions {
+            if len(reverted) == steps {
+                break
+            }
+            m, ok := known[v]
+            if !ok {
+                return fmt.Errorf("migration %04d is applied but unknown to this build", v)
+            }
+            if m.Down == "" {
+                return fmt.Errorf("migration %04d_%s has no down file", m.Version, m.Name)
+            }
+            if err := conn.Transaction(func(tx *gorm.DB) error {
+                if err := tx.Exec(m.Down).Error; err != nil {
+                    return err
+                }
+                return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version).Error
+            }); err != nil {
+                return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+            }
+            reverted = append(reverted, m)
+        }
+        return nil
+    })
+    return reverted, err
+}
+
+// MigrationStatus lists the known migrations with their applied time.
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+    migrations, err := loadMigrations()
+    if err != nil {
+        return nil, err
+    }
+    done := map[int]time.Time{}
+    if db.Migrator().HasTable("schema_migrations") {
+        if done, err = appliedMigrations(db); err != nil {
+            return nil, err
+        }
+    }
+    out := make([]MigrationState, 0, len(migrations))
+    for _, m := range migrations {
+        st := MigrationState{Version: m.Version, Name: m.Name}
+        if at, ok := done[m.Version]; ok {
+            st.AppliedAt = &at
+        }
+        out = append(out, st)
+    }
+    return out, nil
+}
+
+// RunMigrateCommand implements `migrate up [n]`, `migrate down [n]` and `migrate status`,
+// writing progress to w.
+func RunMigrateCommand(db *gorm.DB, args []string, w io.Writer) error {
+    if len(args) == 0 {
+        return fmt.Errorf("usage: migrate up [n] | down [n] | status")
+    }
+    steps := 0
+    if len(args) > 1 {
+        n, err := strconv.Atoi(args[1])
+        if err != nil || n <= 0 {
+            return fmt.Errorf("invalid step count %q", args[1])
+        }
+        steps = n
+    }
+    switch args[0] {
+    case "up":
+        applied, err := MigrateUp(db, steps)
+        for _, m := range applied {
+            fmt.Fprintf(w, "applied  %04d_%s\n", m.Version, m.Name)
+        }
+        if err == nil && len(applied) == 0 {
+            fmt.Fprintln(w, "no pending migrations")
+        }
+        return err
+    case "down":
+        reverted, err := MigrateDown(db, steps)
+        for _, m := range reverted {
+            fmt.Fprintf(w, "reverted %04d_%s\n", m.Version, m.Name)
+        }
+        if err == nil && len(reverted) == 0 {
+            fmt.Fprintln(w, "no applied migrations")
+        }
+        return err
+    case "status":
+        states, err := MigrationStatus(db)
+        if err != nil {
+            return err
+        }
+        for _, st := range states {
+            applied := "pending"
+            if st.AppliedAt != nil {
+                applied = st.AppliedAt.UTC().Format(time.RFC3339)
+            }
+            fmt.Fprintf(w, "%04d_%-32s %s\n", st.Version, st.Name, applied)
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown migrate command %q (want up, down or status)", args[0])
+    }
+}
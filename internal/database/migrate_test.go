@@ -0,0 +1,123 @@
+package database
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+    migrations, err := loadMigrations()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(migrations) == 0 || migrations[0].Version != 1 || migrations[0].Name != "baseline" {
+        t.Fatalf("migrations start with %+v, want 0001_baseline", migrations)
+    }
+    for i, m := range migrations {
+        if i > 0 && m.Version <= migrations[i-1].Version {
+            t.Fatalf("migration %04d_%s is out of order", m.Version, m.Name)
+        }
+        if strings.TrimSpace(m.Down) == "" {
+            t.Fatalf("migration %04d_%s has no down file", m.Version, m.Name)
+        }
+    }
+}
+
+func tableExists(t *testing.T, db *gorm.DB, name string) bool {
+    t.Helper()
+    var n int64
+    if err := db.Raw("SELECT count(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?", name).Scan(&n).Error; err != nil {
+        t.Fatal(err)
+    }
+    return n > 0
+}
+
+func pendingMigrations(t *testing.T, db *gorm.DB) int {
+    t.Helper()
+    states, err := MigrationStatus(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    pending := 0
+    for _, st := range states {
+        if st.AppliedAt == nil {
+            pending++
+        }
+    }
+    return pending
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+    db := newTestDB(t)
+    migrations, err := loadMigrations()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if n := pendingMigrations(t, db); n != len(migrations) {
+        t.Fatalf("fresh database: %d pending, want %d", n, len(migrations))
+    }
+
+    applied, err := MigrateUp(db, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(applied) != len(migrations) || pendingMigrations(t, db) != 0 {
+        t.Fatalf("applied %d of %d migrations", len(applied), len(migrations))
+    }
+    for _, table := range []string{"users", "rooms", "room_students", "refresh_tokens", "login_attempts"} {
+        if !tableExists(t, db, table) {
+            t.Fatalf("table %s missing after migrate up", table)
+        }
+    }
+    if again, err := MigrateUp(db, 0); err != nil || len(again) != 0 {
+        t.Fatalf("second migrate up applied %d (%v), want nothing", len(again), err)
+    }
+
+    reverted, err := MigrateDown(db, len(migrations))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(reverted) != len(migrations) || pendingMigrations(t, db) != len(migrations) {
+        t.Fatalf("reverted %d of %d migrations", len(reverted), len(migrations))
+    }
+    for _, table := range []string{"users", "rooms", "room_students"} {
+        if tableExists(t, db, table) {
+            t.Fatalf("table %s left after migrate down", table)
+        }
+    }
+
+    if err := Migrate(db); err != nil {
+        t.Fatalf("migrate up after down: %v", err)
+    }
+    if pendingMigrations(t, db) != 0 {
+        t.Fatal("migrations pending after the second migrate up")
+    }
+}
+
+func TestRunMigrateCommandSteps(t *testing.T) {
+    db := newTestDB(t)
+    var out bytes.Buffer
+    if err := RunMigrateCommand(db, []string{"up", "1"}, &out); err != nil {
+        t.Fatal(err)
+    }
+    states, err := MigrationStatus(db)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if states[0].AppliedAt == nil || pendingMigrations(t, db) != len(states)-1 {
+        t.Fatalf("up 1 applied %+v", states)
+    }
+    out.Reset()
+    if err := RunMigrateCommand(db, []string{"status"}, &out); err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(out.String(), "baseline") {
+        t.Fatalf("status output %q lacks the baseline", out.String())
+    }
+    if err := RunMigrateCommand(db, []string{"sideways"}, &out); err == nil {
+        t.Fatal("unknown subcommand accepted")
+    }
+}
@@ -0,0 +1,21 @@
+-- Drops the whole schema, including all data.
+DROP TABLE IF EXISTS academic_terms CASCADE;
+DROP TABLE IF EXISTS classes CASCADE;
+DROP TABLE IF EXISTS quiz_attempts CASCADE;
+DROP TABLE IF EXISTS sso_tokens CASCADE;
+DROP TABLE IF EXISTS login_attempts CASCADE;
+DROP TABLE IF EXISTS device_bindings CASCADE;
+DROP TABLE IF EXISTS devices CASCADE;
+DROP TABLE IF EXISTS student_status_events CASCADE;
+DROP TABLE IF EXISTS alerts CASCADE;
+DROP TABLE IF EXISTS alert_rules CASCADE;
+DROP TABLE IF EXISTS app_configs CASCADE;
+DROP TABLE IF EXISTS student_statuses CASCADE;
+DROP TABLE IF EXISTS refresh_tokens CASCADE;
+DROP TABLE IF EXISTS sdui_screens CASCADE;
+DROP TABLE IF EXISTS room_students CASCADE;
+DROP TABLE IF EXISTS room_supervisors CASCADE;
+DROP TABLE IF EXISTS exit_codes CASCADE;
+DROP TABLE IF EXISTS majors CASCADE;
+DROP TABLE IF EXISTS rooms CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
@@ -0,0 +1,536 @@
+-- Baseline: the schema previously created by gorm AutoMigrate and database.createIndexes.
+-- Every statement is idempotent so databases created by those releases are adopted as-is.
+
+CREATE TABLE IF NOT EXISTS users (
+    id uuid PRIMARY KEY,
+    full_name text,
+    email text,
+    username varchar(64) NOT NULL DEFAULT '',
+    password text,
+    role text,
+    kelas text,
+    class_id_ref uuid,
+    jurusan text,
+    major_id_ref uuid,
+    active boolean,
+    token_version bigint NOT NULL DEFAULT 0,
+    must_change_password boolean NOT NULL DEFAULT false,
+    moodle_user_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_moodle_user_id ON users (moodle_user_id);
+CREATE INDEX IF NOT EXISTS idx_users_major_id_ref ON users (major_id_ref);
+CREATE INDEX IF NOT EXISTS idx_users_class_id_ref ON users (class_id_ref);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id uuid PRIMARY KEY,
+    name text,
+    active boolean,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_rooms_deleted_at ON rooms (deleted_at);
+
+CREATE TABLE IF NOT EXISTS majors (
+    id uuid PRIMARY KEY,
+    code text,
+    name text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_majors_deleted_at ON majors (deleted_at);
+
+CREATE TABLE IF NOT EXISTS exit_codes (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    student_user_id_ref uuid,
+    room_id_ref uuid,
+    code text,
+    reusable boolean,
+    term_id_ref uuid,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_used_at ON exit_codes (used_at);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_term_id_ref ON exit_codes (term_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_reusable ON exit_codes (reusable);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exit_codes_code ON exit_codes (code);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_room_id_ref ON exit_codes (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_student_user_id_ref ON exit_codes (student_user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_user_id_ref ON exit_codes (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS room_supervisors (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    room_id_ref uuid,
+    term_id_ref uuid,
+    created_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_room_supervisors_deleted_at ON room_supervisors (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_room_supervisors_term_id_ref ON room_supervisors (term_id_ref);
+CREATE INDEX IF NOT EXISTS idx_room_supervisors_room_id_ref ON room_supervisors (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_room_supervisors_user_id_ref ON room_supervisors (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS room_students (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    room_id_ref uuid,
+    term_id_ref uuid,
+    created_at timestamptz,
+    deleted_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_room_students_deleted_at ON room_students (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_room_students_term_id_ref ON room_students (term_id_ref);
+CREATE INDEX IF NOT EXISTS idx_room_students_room_id_ref ON room_students (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_room_students_user_id_ref ON room_students (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS sdui_screens (
+    id uuid PRIMARY KEY,
+    name text,
+    platform text,
+    role text,
+    schema_version bigint DEFAULT 1,
+    screen_version bigint DEFAULT 1,
+    active boolean DEFAULT true,
+    payload jsonb,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS uniq_sdui ON sdui_screens (name,platform,role);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id uuid PRIMARY KEY,
+    token_id text,
+    user_id_ref uuid,
+    token_hash text,
+    expires_at timestamptz,
+    revoked_at timestamptz,
+    replaced_by_token_id text,
+    session_id uuid,
+    session_started_at timestamptz,
+    platform varchar(32),
+    device_id_ref uuid,
+    ip_address varchar(64),
+    user_agent varchar(255),
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens (expires_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id_ref ON refresh_tokens (user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_token_id ON refresh_tokens (token_id);
+
+CREATE TABLE IF NOT EXISTS student_statuses (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    app_version varchar(64),
+    locked boolean,
+    blocked_from_exam boolean,
+    force_logout_at timestamptz,
+    unlock_authorized_until timestamptz,
+    unauthorized_unlock boolean,
+    unauthorized_unlock_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_unauthorized_unlock ON student_statuses (unauthorized_unlock);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_force_logout_at ON student_statuses (force_logout_at);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_blocked_from_exam ON student_statuses (blocked_from_exam);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_locked ON student_statuses (locked);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_student_statuses_user_id_ref ON student_statuses (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS app_configs (
+    key varchar(128) PRIMARY KEY,
+    value text,
+    description text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id uuid PRIMARY KEY,
+    name varchar(128),
+    condition varchar(64),
+    threshold bigint DEFAULT 0,
+    window_seconds bigint DEFAULT 0,
+    cooldown_seconds bigint DEFAULT 0,
+    actions jsonb,
+    active boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_alert_rules_active ON alert_rules (active);
+CREATE INDEX IF NOT EXISTS idx_alert_rules_condition ON alert_rules (condition);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id uuid PRIMARY KEY,
+    type varchar(64),
+    user_id_ref uuid,
+    room_id_ref uuid,
+    rule_id_ref uuid,
+    message text,
+    acknowledged_at timestamptz,
+    acknowledged_by uuid,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts (created_at);
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_id_ref ON alerts (rule_id_ref);
+CREATE INDEX IF NOT EXISTS idx_alerts_room_id_ref ON alerts (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_alerts_user_id_ref ON alerts (user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_alerts_type ON alerts (type);
+
+CREATE TABLE IF NOT EXISTS student_status_events (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    locked boolean,
+    exit_code_backed boolean,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_student_status_events_created_at ON student_status_events (created_at);
+CREATE INDEX IF NOT EXISTS idx_student_status_events_user_id_ref ON student_status_events (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS devices (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    device_id varchar(128),
+    platform varchar(32),
+    model varchar(128),
+    os_version varchar(64),
+    app_version varchar(64),
+    first_seen_at timestamptz,
+    last_seen_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_devices_last_seen_at ON devices (last_seen_at);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_user_device ON devices (user_id_ref,device_id);
+
+CREATE TABLE IF NOT EXISTS device_bindings (
+    id uuid PRIMARY KEY,
+    user_id_ref uuid,
+    device_id_ref uuid,
+    bound_at timestamptz,
+    expires_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_device_bindings_expires_at ON device_bindings (expires_at);
+CREATE INDEX IF NOT EXISTS idx_device_bindings_device_id_ref ON device_bindings (device_id_ref);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_bindings_user_id_ref ON device_bindings (user_id_ref);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id uuid PRIMARY KEY,
+    kind varchar(16),
+    subject varchar(255),
+    failures bigint NOT NULL DEFAULT 0,
+    last_failure_at timestamptz,
+    blocked_until timestamptz,
+    locked_out boolean,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_locked_out ON login_attempts (locked_out);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_blocked_until ON login_attempts (blocked_until);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_login_attempt_key ON login_attempts (kind,subject);
+
+CREATE TABLE IF NOT EXISTS sso_tokens (
+    id uuid PRIMARY KEY,
+    jti varchar(64),
+    user_id_ref uuid,
+    audience varchar(255),
+    expires_at timestamptz,
+    used_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_sso_tokens_expires_at ON sso_tokens (expires_at);
+CREATE INDEX IF NOT EXISTS idx_sso_tokens_user_id_ref ON sso_tokens (user_id_ref);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sso_tokens_jti ON sso_tokens (jti);
+
+CREATE TABLE IF NOT EXISTS quiz_attempts (
+    id uuid PRIMARY KEY,
+    moodle_attempt_id bigint,
+    moodle_quiz_id bigint,
+    user_id_ref uuid,
+    state varchar(32),
+    started_at timestamptz,
+    finished_at timestamptz,
+    due_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_quiz_attempts_user_id_ref ON quiz_attempts (user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_quiz_attempts_moodle_quiz_id ON quiz_attempts (moodle_quiz_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quiz_attempts_moodle_attempt_id ON quiz_attempts (moodle_attempt_id);
+
+CREATE TABLE IF NOT EXISTS classes (
+    id uuid PRIMARY KEY,
+    name varchar(64) NOT NULL,
+    grade_level bigint NOT NULL DEFAULT 0,
+    major_id_ref uuid,
+    academic_year varchar(16) NOT NULL DEFAULT '',
+    homeroom_teacher_id_ref uuid,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_classes_homeroom_teacher_id_ref ON classes (homeroom_teacher_id_ref);
+CREATE INDEX IF NOT EXISTS idx_classes_major_id_ref ON classes (major_id_ref);
+CREATE INDEX IF NOT EXISTS idx_classes_grade_level ON classes (grade_level);
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_class_name_year ON classes (name,academic_year);
+
+CREATE TABLE IF NOT EXISTS academic_terms (
+    id uuid PRIMARY KEY,
+    name varchar(64) NOT NULL,
+    academic_year varchar(16) NOT NULL,
+    semester bigint NOT NULL DEFAULT 0,
+    starts_on timestamptz,
+    ends_on timestamptz,
+    active boolean NOT NULL DEFAULT false,
+    archived_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_academic_terms_archived_at ON academic_terms (archived_at);
+CREATE INDEX IF NOT EXISTS idx_academic_terms_academic_year ON academic_terms (academic_year);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_academic_terms_name ON academic_terms (name);
+
+-- Extensions
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Exit codes
+CREATE INDEX IF NOT EXISTS idx_exit_codes_room ON exit_codes (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_student ON exit_codes (student_user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_user ON exit_codes (user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_used ON exit_codes (used_at);
+CREATE INDEX IF NOT EXISTS idx_exit_codes_unused_code ON exit_codes USING btree (code) WHERE used_at IS NULL;
+
+-- Room assignments / supervisors
+CREATE INDEX IF NOT EXISTS idx_room_students_room ON room_students (room_id_ref);
+CREATE INDEX IF NOT EXISTS idx_room_supervisors_room_user ON room_supervisors (room_id_ref, user_id_ref);
+
+-- Assignments are unique per term among rows that are not soft-deleted
+DROP INDEX IF EXISTS uniq_student_room;
+DROP INDEX IF EXISTS uniq_user_room;
+DROP INDEX IF EXISTS uniq_student_room_term;
+DROP INDEX IF EXISTS uniq_user_room_term;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_room_students_live ON room_students (user_id_ref, room_id_ref, term_id_ref) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_room_supervisors_live ON room_supervisors (user_id_ref, room_id_ref, term_id_ref) WHERE deleted_at IS NULL;
+
+-- Academic terms: one active term; assignments and exit codes reference a term
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_academic_terms_active ON academic_terms (active) WHERE active;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_students_term') THEN
+        ALTER TABLE room_students ADD CONSTRAINT fk_room_students_term FOREIGN KEY (term_id_ref) REFERENCES academic_terms (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_supervisors_term') THEN
+        ALTER TABLE room_supervisors ADD CONSTRAINT fk_room_supervisors_term FOREIGN KEY (term_id_ref) REFERENCES academic_terms (id);
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_exit_codes_term') THEN
+        ALTER TABLE exit_codes ADD CONSTRAINT fk_exit_codes_term FOREIGN KEY (term_id_ref) REFERENCES academic_terms (id);
+    END IF;
+END $$;
+
+-- Student statuses
+CREATE INDEX IF NOT EXISTS idx_student_statuses_user ON student_statuses (user_id_ref);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_flags ON student_statuses (locked, blocked_from_exam);
+CREATE INDEX IF NOT EXISTS idx_student_statuses_updated ON student_statuses (updated_at);
+CREATE INDEX IF NOT EXISTS idx_student_status_events_user_created ON student_status_events (user_id_ref, created_at DESC);
+
+-- Alerts
+CREATE INDEX IF NOT EXISTS idx_alerts_rule_user_created ON alerts (rule_id_ref, user_id_ref, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_unacked ON alerts (created_at DESC) WHERE acknowledged_at IS NULL;
+
+-- Users
+CREATE INDEX IF NOT EXISTS idx_users_role ON users (role);
+CREATE INDEX IF NOT EXISTS idx_users_active ON users (active);
+CREATE INDEX IF NOT EXISTS idx_users_kelas ON users (kelas);
+CREATE INDEX IF NOT EXISTS idx_users_jurusan ON users (jurusan);
+CREATE INDEX IF NOT EXISTS idx_users_fullname_trgm ON users USING GIN (lower(full_name) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING GIN (lower(email) gin_trgm_ops);
+
+-- Email/username are optional but unique when set (replaces the former idx_users_email)
+DROP INDEX IF EXISTS idx_users_email;
+
+-- Soft-deleted users release their email/username (replaces uniq_users_email / uniq_users_username)
+DROP INDEX IF EXISTS uniq_users_email;
+DROP INDEX IF EXISTS uniq_users_username;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_users_email_live ON users (email) WHERE email <> '' AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_users_username_live ON users (lower(username)) WHERE username <> '' AND deleted_at IS NULL;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_users_major') THEN
+        ALTER TABLE users ADD CONSTRAINT fk_users_major FOREIGN KEY (major_id_ref) REFERENCES majors (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+-- Classes
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_users_class') THEN
+        ALTER TABLE users ADD CONSTRAINT fk_users_class FOREIGN KEY (class_id_ref) REFERENCES classes (id) ON DELETE SET NULL;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_classes_major') THEN
+        ALTER TABLE classes ADD CONSTRAINT fk_classes_major FOREIGN KEY (major_id_ref) REFERENCES majors (id) ON DELETE SET NULL;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_classes_homeroom') THEN
+        ALTER TABLE classes ADD CONSTRAINT fk_classes_homeroom FOREIGN KEY (homeroom_teacher_id_ref) REFERENCES users (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+-- Rooms and majors: names/codes are unique among rows that are not soft-deleted
+DROP INDEX IF EXISTS idx_rooms_name;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_rooms_name ON rooms (name) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_majors_code;
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_majors_code ON majors (code) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_rooms_active ON rooms (active);
+CREATE INDEX IF NOT EXISTS idx_rooms_name_trgm ON rooms USING GIN (lower(name) gin_trgm_ops);
+
+-- SDUI
+CREATE INDEX IF NOT EXISTS idx_sdui_active_name_platform ON sdui_screens (active, name, platform);
+
+-- Foreign keys. A database created before them may hold rows pointing at a missing
+-- parent. Those are never removed here: the migration fails with the number of orphans
+-- per constraint, and the operator cleans them up (README, "Orphaned rows") and retries.
+DO $$
+DECLARE
+    fk record;
+    n bigint;
+    report text := '';
+BEGIN
+    FOR fk IN SELECT * FROM (VALUES
+        ('fk_room_students_user', 'room_students', 'user_id_ref', 'users'),
+        ('fk_room_students_room', 'room_students', 'room_id_ref', 'rooms'),
+        ('fk_room_supervisors_user', 'room_supervisors', 'user_id_ref', 'users'),
+        ('fk_room_supervisors_room', 'room_supervisors', 'room_id_ref', 'rooms'),
+        ('fk_exit_codes_creator', 'exit_codes', 'user_id_ref', 'users'),
+        ('fk_exit_codes_student', 'exit_codes', 'student_user_id_ref', 'users'),
+        ('fk_exit_codes_room', 'exit_codes', 'room_id_ref', 'rooms'),
+        ('fk_student_status_events_user', 'student_status_events', 'user_id_ref', 'users'),
+        ('fk_quiz_attempts_user', 'quiz_attempts', 'user_id_ref', 'users'),
+        ('fk_alerts_user', 'alerts', 'user_id_ref', 'users'),
+        ('fk_alerts_room', 'alerts', 'room_id_ref', 'rooms'),
+        ('fk_alerts_rule', 'alerts', 'rule_id_ref', 'alert_rules'),
+        ('fk_alerts_acknowledged_by', 'alerts', 'acknowledged_by', 'users'),
+        ('fk_student_statuses_user', 'student_statuses', 'user_id_ref', 'users'),
+        ('fk_refresh_tokens_user', 'refresh_tokens', 'user_id_ref', 'users'),
+        ('fk_refresh_tokens_device', 'refresh_tokens', 'device_id_ref', 'devices'),
+        ('fk_sso_tokens_user', 'sso_tokens', 'user_id_ref', 'users'),
+        ('fk_devices_user', 'devices', 'user_id_ref', 'users'),
+        ('fk_device_bindings_user', 'device_bindings', 'user_id_ref', 'users'),
+        ('fk_device_bindings_device', 'device_bindings', 'device_id_ref', 'devices')
+    ) AS t (conname, tbl, col, parent) LOOP
+        IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = fk.conname) THEN
+            EXECUTE format('SELECT count(*) FROM %I c WHERE c.%I IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %I p WHERE p.id = c.%I)',
+                fk.tbl, fk.col, fk.parent, fk.col) INTO n;
+            IF n > 0 THEN
+                report := report || format(E'\n  %s: %s rows of %s.%s reference a missing %s row', fk.conname, n, fk.tbl, fk.col, fk.parent);
+            END IF;
+        END IF;
+    END LOOP;
+    IF report <> '' THEN
+        RAISE EXCEPTION 'orphaned rows block the foreign keys:%', report
+            USING HINT = 'delete or unlink these rows (see README, "Orphaned rows") and run the migration again';
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_students_user') THEN
+        ALTER TABLE room_students ADD CONSTRAINT fk_room_students_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_students_room') THEN
+        ALTER TABLE room_students ADD CONSTRAINT fk_room_students_room FOREIGN KEY (room_id_ref) REFERENCES rooms (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_supervisors_user') THEN
+        ALTER TABLE room_supervisors ADD CONSTRAINT fk_room_supervisors_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_room_supervisors_room') THEN
+        ALTER TABLE room_supervisors ADD CONSTRAINT fk_room_supervisors_room FOREIGN KEY (room_id_ref) REFERENCES rooms (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_exit_codes_creator') THEN
+        ALTER TABLE exit_codes ADD CONSTRAINT fk_exit_codes_creator FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_exit_codes_student') THEN
+        ALTER TABLE exit_codes ADD CONSTRAINT fk_exit_codes_student FOREIGN KEY (student_user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_exit_codes_room') THEN
+        ALTER TABLE exit_codes ADD CONSTRAINT fk_exit_codes_room FOREIGN KEY (room_id_ref) REFERENCES rooms (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_student_status_events_user') THEN
+        ALTER TABLE student_status_events ADD CONSTRAINT fk_student_status_events_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_quiz_attempts_user') THEN
+        ALTER TABLE quiz_attempts ADD CONSTRAINT fk_quiz_attempts_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_alerts_user') THEN
+        ALTER TABLE alerts ADD CONSTRAINT fk_alerts_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_alerts_room') THEN
+        ALTER TABLE alerts ADD CONSTRAINT fk_alerts_room FOREIGN KEY (room_id_ref) REFERENCES rooms (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_alerts_rule') THEN
+        ALTER TABLE alerts ADD CONSTRAINT fk_alerts_rule FOREIGN KEY (rule_id_ref) REFERENCES alert_rules (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_alerts_acknowledged_by') THEN
+        ALTER TABLE alerts ADD CONSTRAINT fk_alerts_acknowledged_by FOREIGN KEY (acknowledged_by) REFERENCES users (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_student_statuses_user') THEN
+        ALTER TABLE student_statuses ADD CONSTRAINT fk_student_statuses_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_refresh_tokens_user') THEN
+        ALTER TABLE refresh_tokens ADD CONSTRAINT fk_refresh_tokens_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_refresh_tokens_device') THEN
+        ALTER TABLE refresh_tokens ADD CONSTRAINT fk_refresh_tokens_device FOREIGN KEY (device_id_ref) REFERENCES devices (id) ON DELETE SET NULL;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_sso_tokens_user') THEN
+        ALTER TABLE sso_tokens ADD CONSTRAINT fk_sso_tokens_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_devices_user') THEN
+        ALTER TABLE devices ADD CONSTRAINT fk_devices_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_device_bindings_user') THEN
+        ALTER TABLE device_bindings ADD CONSTRAINT fk_device_bindings_user FOREIGN KEY (user_id_ref) REFERENCES users (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_device_bindings_device') THEN
+        ALTER TABLE device_bindings ADD CONSTRAINT fk_device_bindings_device FOREIGN KEY (device_id_ref) REFERENCES devices (id) ON DELETE CASCADE;
+    END IF;
+END $$;
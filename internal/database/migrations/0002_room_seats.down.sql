@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS uniq_room_students_seat;
+ALTER TABLE room_students DROP COLUMN IF EXISTS seat_column;
+ALTER TABLE room_students DROP COLUMN IF EXISTS seat_row;
+ALTER TABLE rooms DROP COLUMN IF EXISTS seat_columns;
+ALTER TABLE rooms DROP COLUMN IF EXISTS seat_rows;
+ALTER TABLE rooms DROP COLUMN IF EXISTS capacity;
@@ -0,0 +1,10 @@
+-- Room capacity and seat grid; a seat per room assignment.
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS capacity bigint NOT NULL DEFAULT 0;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS seat_rows bigint NOT NULL DEFAULT 0;
+ALTER TABLE rooms ADD COLUMN IF NOT EXISTS seat_columns bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE room_students ADD COLUMN IF NOT EXISTS seat_row bigint;
+ALTER TABLE room_students ADD COLUMN IF NOT EXISTS seat_column bigint;
+
+-- A seat holds one siswa per room and term among rows that are not soft-deleted
+CREATE UNIQUE INDEX IF NOT EXISTS uniq_room_students_seat ON room_students (room_id_ref, term_id_ref, seat_row, seat_column) WHERE deleted_at IS NULL AND seat_row IS NOT NULL;
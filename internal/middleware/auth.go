@@ -10,17 +10,55 @@ import (
     "gorm.io/gorm"
 
     "github.com/zaqqye/seb_backend_v1/internal/models"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
 )
 
 type AuthConfig struct {
     JWTSecret    string
     JWTExpiresIn time.Duration
+    // Keys verifies RS256/EdDSA tokens by kid; HS256 with JWTSecret is accepted while Keys.AllowHMAC
+    Keys         *utils.KeySet
 }
 
+// passwordChangePaths stay reachable for users flagged with MustChangePassword.
+var passwordChangePaths = map[string]struct{}{
+    "/api/v1/auth/password": {},
+    "/api/v1/auth/logout":   {},
+    "/api/v1/auth/me":       {},
+}
+
+// Token kinds carried in the "typ" claim. Every token is signed with the same key once
+// JWT_SIGNING_KEYS is set, so verifiers must check the kind they expect.
+const (
+    TokenTypeAccess  = "access"
+    TokenTypeRefresh = "refresh"
+)
+
+// IsTokenType reports whether a verified token is of kind want. HS256 tokens issued before
+// the typ claim existed carry none; they still count as want while HMAC is accepted (the
+// key set rejects HS256 otherwise), since access and refresh tokens used to be signed with
+// different secrets. Tokens signed by a kid-identified key must always carry typ.
+func IsTokenType(token *jwt.Token, typ, want string) bool {
+    if typ == want {
+        return true
+    }
+    _, legacy := token.Method.(*jwt.SigningMethodHMAC)
+    return legacy && typ == ""
+}
+
+// AuthMethodOIDC marks sessions started through an OpenID Connect provider. They never
+// used the local password, so MustChangePassword does not gate them.
+const AuthMethodOIDC = "oidc"
+
 type Claims struct {
-    UserID  string `json:"user_id"`
-    Role    string `json:"role"`
-    Email   string `json:"email"`
+    Type      string `json:"typ"`
+    UserID    string `json:"user_id"`
+    Role      string `json:"role"`
+    Email     string `json:"email"`
+    SessionID string `json:"sid,omitempty"`
+    // TokenVersion must match User.TokenVersion; see bumps on logout-all, password/role change, deactivation.
+    TokenVersion int `json:"tv"`
+    AuthMethod   string `json:"auth,omitempty"`
     jwt.RegisteredClaims
 }
 
@@ -34,10 +72,8 @@ func AuthMiddleware(db *gorm.DB, cfg AuthConfig) gin.HandlerFunc {
         tokenStr := strings.TrimSpace(auth[len("Bearer "):])
 
         claims := &Claims{}
-        token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-            return []byte(cfg.JWTSecret), nil
-        })
-        if err != nil || !token.Valid {
+        token, err := jwt.ParseWithClaims(tokenStr, claims, cfg.Keys.Keyfunc(cfg.JWTSecret))
+        if err != nil || !token.Valid || !IsTokenType(token, claims.Type, TokenTypeAccess) {
             c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
             return
         }
@@ -48,6 +84,11 @@ func AuthMiddleware(db *gorm.DB, cfg AuthConfig) gin.HandlerFunc {
             return
         }
 
+        if claims.TokenVersion != user.TokenVersion {
+            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+            return
+        }
+
         // Optional: force-logout check using StudentStatus.ForceLogoutAt vs token iat
         role := strings.ToLower(user.Role)
         if role == "siswa" {
@@ -62,7 +103,15 @@ func AuthMiddleware(db *gorm.DB, cfg AuthConfig) gin.HandlerFunc {
             }
         }
 
+        if user.MustChangePassword && claims.AuthMethod != AuthMethodOIDC {
+            if _, ok := passwordChangePaths[c.Request.URL.Path]; !ok {
+                c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "password change required", "must_change_password": true})
+                return
+            }
+        }
+
         c.Set("user", user)
+        c.Set("session_id", claims.SessionID)
         c.Next()
     }
 }
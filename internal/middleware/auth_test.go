@@ -0,0 +1,31 @@
+package middleware
+
+import (
+    "testing"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+func TestIsTokenType(t *testing.T) {
+    hs256 := &jwt.Token{Method: jwt.SigningMethodHS256}
+    rs256 := &jwt.Token{Method: jwt.SigningMethodRS256}
+    cases := []struct {
+        name  string
+        token *jwt.Token
+        typ   string
+        want  string
+        ok    bool
+    }{
+        {"matching kind", rs256, TokenTypeAccess, TokenTypeAccess, true},
+        {"other kind", rs256, TokenTypeRefresh, TokenTypeAccess, false},
+        {"untyped kid-signed token", rs256, "", TokenTypeAccess, false},
+        {"legacy HS256 access token", hs256, "", TokenTypeAccess, true},
+        {"legacy HS256 refresh token", hs256, "", TokenTypeRefresh, true},
+        {"typed HS256 token of another kind", hs256, TokenTypeRefresh, TokenTypeAccess, false},
+    }
+    for _, tc := range cases {
+        if got := IsTokenType(tc.token, tc.typ, tc.want); got != tc.ok {
+            t.Errorf("%s: got %v, want %v", tc.name, got, tc.ok)
+        }
+    }
+}
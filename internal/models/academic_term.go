@@ -0,0 +1,36 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// AcademicTerm is a school year or semester ("2025/2026 Ganjil"). Room assignments
+// and exit codes belong to a term; at most one term is active at a time.
+type AcademicTerm struct {
+    ID           string     `gorm:"type:uuid;primaryKey"`
+    Name         string     `gorm:"size:64;not null;uniqueIndex"`
+    AcademicYear string     `gorm:"size:16;not null;index"`
+    Semester     int        `gorm:"not null;default:0"`
+    StartsOn     *time.Time
+    EndsOn       *time.Time
+    Active       bool       `gorm:"not null;default:false"`
+    ArchivedAt   *time.Time `gorm:"index"`
+    CreatedAt    time.Time
+    UpdatedAt    time.Time
+}
+
+func (t *AcademicTerm) BeforeCreate(tx *gorm.DB) (err error) {
+    if t.ID == "" {
+        t.ID = uuid.NewString()
+    }
+    return nil
+}
+
+// CurrentTermCond is a SQL condition limiting a term_id_ref column to the active term.
+// While no term is active every row matches, so installs without terms behave as before.
+func CurrentTermCond(column string) string {
+    return "(" + column + " IN (SELECT id FROM academic_terms WHERE active) OR NOT EXISTS (SELECT 1 FROM academic_terms WHERE active))"
+}
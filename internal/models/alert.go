@@ -0,0 +1,52 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/datatypes"
+    "gorm.io/gorm"
+)
+
+// AlertRule is an admin-managed rule evaluated whenever a student's status changes.
+// Condition decides when the rule fires; Actions is a JSON array of action names
+// (block, force_logout, alert_supervisor) executed when it does.
+type AlertRule struct {
+    ID              string         `gorm:"type:uuid;primaryKey"`
+    Name            string         `gorm:"size:128"`
+    Condition       string         `gorm:"size:64;index"`
+    Threshold       int            `gorm:"default:0"`
+    WindowSeconds   int            `gorm:"default:0"`
+    CooldownSeconds int            `gorm:"default:0"`
+    Actions         datatypes.JSON `gorm:"type:jsonb"`
+    Active          bool           `gorm:"index"`
+    CreatedAt       time.Time
+    UpdatedAt       time.Time
+}
+
+func (r *AlertRule) BeforeCreate(tx *gorm.DB) (err error) {
+    if r.ID == "" {
+        r.ID = uuid.NewString()
+    }
+    return nil
+}
+
+// Alert is a persisted notification raised for pengawas/admin, e.g. when an AlertRule fires.
+type Alert struct {
+    ID             string     `gorm:"type:uuid;primaryKey"`
+    Type           string     `gorm:"size:64;index"`
+    UserIDRef      *string    `gorm:"type:uuid;index"`
+    RoomIDRef      *string    `gorm:"type:uuid;index"`
+    RuleIDRef      *string    `gorm:"type:uuid;index"`
+    Message        string     `gorm:"type:text"`
+    AcknowledgedAt *time.Time
+    AcknowledgedBy *string    `gorm:"type:uuid"`
+    CreatedAt      time.Time  `gorm:"index"`
+}
+
+func (a *Alert) BeforeCreate(tx *gorm.DB) (err error) {
+    if a.ID == "" {
+        a.ID = uuid.NewString()
+    }
+    return nil
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// Class is a school class (kelas) such as "XII IPA 1" in one academic year.
+// Siswa link to it through User.ClassIDRef.
+type Class struct {
+    ID                   string    `gorm:"type:uuid;primaryKey"`
+    Name                 string    `gorm:"size:64;not null;uniqueIndex:uniq_class_name_year"`
+    GradeLevel           int       `gorm:"not null;default:0;index"`
+    MajorIDRef           *string   `gorm:"type:uuid;index"`
+    AcademicYear         string    `gorm:"size:16;not null;default:'';uniqueIndex:uniq_class_name_year"`
+    HomeroomTeacherIDRef *string   `gorm:"type:uuid;index"`
+    CreatedAt            time.Time
+    UpdatedAt            time.Time
+}
+
+func (c *Class) BeforeCreate(tx *gorm.DB) (err error) {
+    if c.ID == "" {
+        c.ID = uuid.NewString()
+    }
+    return nil
+}
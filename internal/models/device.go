@@ -0,0 +1,47 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// Device is a client device a user has logged in from, keyed by the app-provided device id.
+type Device struct {
+    ID          string    `gorm:"type:uuid;primaryKey"`
+    UserIDRef   string    `gorm:"type:uuid;uniqueIndex:uniq_user_device"`
+    DeviceID    string    `gorm:"size:128;uniqueIndex:uniq_user_device"`
+    Platform    string    `gorm:"size:32"`
+    Model       string    `gorm:"size:128"`
+    OSVersion   string    `gorm:"size:64"`
+    AppVersion  string    `gorm:"size:64"`
+    FirstSeenAt time.Time
+    LastSeenAt  time.Time `gorm:"index"`
+    CreatedAt   time.Time
+    UpdatedAt   time.Time
+}
+
+func (d *Device) BeforeCreate(tx *gorm.DB) (err error) {
+    if d.ID == "" {
+        d.ID = uuid.NewString()
+    }
+    return nil
+}
+
+// DeviceBinding pins a siswa to one Device until ExpiresAt (nil = until reset by pengawas/admin).
+type DeviceBinding struct {
+    ID          string     `gorm:"type:uuid;primaryKey"`
+    UserIDRef   string     `gorm:"type:uuid;uniqueIndex"`
+    DeviceIDRef string     `gorm:"type:uuid;index"`
+    BoundAt     time.Time
+    ExpiresAt   *time.Time `gorm:"index"`
+    CreatedAt   time.Time
+}
+
+func (b *DeviceBinding) BeforeCreate(tx *gorm.DB) (err error) {
+    if b.ID == "" {
+        b.ID = uuid.NewString()
+    }
+    return nil
+}
@@ -14,6 +14,7 @@ type ExitCode struct {
     RoomIDRef        *string    `gorm:"type:uuid;index"`
     Code             string     `gorm:"uniqueIndex"`
     Reusable         bool       `gorm:"index"`
+    TermIDRef        *string    `gorm:"type:uuid;index"`
     UsedAt           *time.Time `gorm:"index"`
     CreatedAt        time.Time
 }
@@ -27,11 +28,15 @@ func (e *ExitCode) BeforeCreate(tx *gorm.DB) (err error) {
 
 // RoomSupervisor maps a pengawas/admin user to rooms they supervise.
 // Admins are allowed everywhere by role; this mapping is primarily for pengawas scope.
+// Assignments belong to an academic term (TermIDRef) and are unique per term among
+// rows that are not deleted (uniq_room_supervisors_live).
 type RoomSupervisor struct {
-	ID        string    `gorm:"type:uuid;primaryKey"`
-	UserIDRef string    `gorm:"type:uuid;uniqueIndex:uniq_user_room"`
-	RoomIDRef string    `gorm:"type:uuid;uniqueIndex:uniq_user_room;index"`
+	ID        string  `gorm:"type:uuid;primaryKey"`
+	UserIDRef string  `gorm:"type:uuid;index"`
+	RoomIDRef string  `gorm:"type:uuid;index"`
+	TermIDRef *string `gorm:"type:uuid;index"`
 	CreatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 func (rs *RoomSupervisor) BeforeCreate(tx *gorm.DB) (err error) {
@@ -41,12 +46,18 @@ func (rs *RoomSupervisor) BeforeCreate(tx *gorm.DB) (err error) {
     return nil
 }
 
-// RoomStudent maps a siswa user to rooms they belong to.
+// RoomStudent maps a siswa user to rooms they belong to in an academic term, unique
+// among rows that are not deleted (uniq_room_students_live).
 type RoomStudent struct {
-	ID        string    `gorm:"type:uuid;primaryKey"`
-	UserIDRef string    `gorm:"type:uuid;uniqueIndex:uniq_student_room"`
-	RoomIDRef string    `gorm:"type:uuid;uniqueIndex:uniq_student_room;index"`
-	CreatedAt time.Time
+	ID         string  `gorm:"type:uuid;primaryKey"`
+	UserIDRef  string  `gorm:"type:uuid;index"`
+	RoomIDRef  string  `gorm:"type:uuid;index"`
+	TermIDRef  *string `gorm:"type:uuid;index"`
+	// Seat in the room's grid, 1-based; nil until seated (uniq_room_students_seat).
+	SeatRow    *int
+	SeatColumn *int
+	CreatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
 }
 
 func (rs *RoomStudent) BeforeCreate(tx *gorm.DB) (err error) {
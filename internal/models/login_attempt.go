@@ -0,0 +1,30 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// LoginAttempt tracks consecutive failed logins for one throttle key: an account
+// (Kind "account", Subject = login identifier) or a client IP (Kind "ip").
+type LoginAttempt struct {
+    ID            string     `gorm:"type:uuid;primaryKey"`
+    Kind          string     `gorm:"size:16;uniqueIndex:uniq_login_attempt_key"`
+    Subject       string     `gorm:"size:255;uniqueIndex:uniq_login_attempt_key"`
+    Failures      int        `gorm:"not null;default:0"`
+    LastFailureAt time.Time
+    // BlockedUntil is the backoff/lockout deadline; attempts before it are rejected unchecked
+    BlockedUntil  *time.Time `gorm:"index"`
+    LockedOut     bool       `gorm:"index"`
+    CreatedAt     time.Time
+    UpdatedAt     time.Time
+}
+
+func (a *LoginAttempt) BeforeCreate(tx *gorm.DB) (err error) {
+    if a.ID == "" {
+        a.ID = uuid.NewString()
+    }
+    return nil
+}
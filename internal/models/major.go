@@ -9,10 +9,12 @@ import (
 
 type Major struct {
     ID        string    `gorm:"type:uuid;primaryKey"`
-    Code      string    `gorm:"uniqueIndex"`
+    // Code is unique among majors that are not deleted (uniq_majors_code).
+    Code      string
     Name      string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 func (m *Major) BeforeCreate(tx *gorm.DB) (err error) {
@@ -16,8 +16,15 @@ type StudentStatus struct {
     Locked          bool       `gorm:"index"`
     BlockedFromExam bool       `gorm:"index"`
     ForceLogoutAt   *time.Time `gorm:"index"`
-    CreatedAt       time.Time
-    UpdatedAt       time.Time
+    // UnlockAuthorizedUntil is set when an exit code is consumed for the student;
+    // an unlock before this time counts as authorized.
+    UnlockAuthorizedUntil *time.Time
+    // UnauthorizedUnlock flags that the latest unlock was not backed by an exit code.
+    // Cleared by an authorized unlock or when a pengawas allows the exam again.
+    UnauthorizedUnlock   bool       `gorm:"index"`
+    UnauthorizedUnlockAt *time.Time
+    CreatedAt            time.Time
+    UpdatedAt            time.Time
 }
 
 func (s *StudentStatus) BeforeCreate(tx *gorm.DB) (err error) {
@@ -26,3 +33,19 @@ func (s *StudentStatus) BeforeCreate(tx *gorm.DB) (err error) {
     }
     return nil
 }
+
+// StudentStatusEvent records lock/unlock transitions of a siswa, used by AlertRule evaluation.
+type StudentStatusEvent struct {
+    ID             string    `gorm:"type:uuid;primaryKey"`
+    UserIDRef      string    `gorm:"type:uuid;index"`
+    Locked         bool
+    ExitCodeBacked bool
+    CreatedAt      time.Time `gorm:"index"`
+}
+
+func (e *StudentStatusEvent) BeforeCreate(tx *gorm.DB) (err error) {
+    if e.ID == "" {
+        e.ID = uuid.NewString()
+    }
+    return nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// QuizAttempt mirrors a Moodle quiz attempt of a siswa (polled or pushed by webhook).
+type QuizAttempt struct {
+    ID              string     `gorm:"type:uuid;primaryKey"`
+    MoodleAttemptID int64      `gorm:"uniqueIndex"`
+    MoodleQuizID    int64      `gorm:"index"`
+    UserIDRef       string     `gorm:"type:uuid;index"`
+    State           string     `gorm:"size:32"`
+    StartedAt       *time.Time
+    FinishedAt      *time.Time
+    // DueAt is when an open attempt runs out of time (Moodle timecheckstate).
+    DueAt           *time.Time
+    CreatedAt       time.Time
+    UpdatedAt       time.Time
+}
+
+func (a *QuizAttempt) BeforeCreate(tx *gorm.DB) (err error) {
+    if a.ID == "" {
+        a.ID = uuid.NewString()
+    }
+    return nil
+}
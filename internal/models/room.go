@@ -8,11 +8,18 @@ import (
 )
 
 type Room struct {
-    ID        string    `gorm:"type:uuid;primaryKey"`
-    Name      string    `gorm:"uniqueIndex"`
-    Active    bool
-    CreatedAt time.Time
-    UpdatedAt time.Time
+    ID          string `gorm:"type:uuid;primaryKey"`
+    // Name is unique among rooms that are not deleted (uniq_rooms_name).
+    Name        string
+    Active      bool
+    // Capacity caps the siswa assigned per term; 0 means unlimited.
+    Capacity    int `gorm:"not null;default:0"`
+    // SeatRows x SeatColumns is the seat grid, both 0 when the room has none.
+    SeatRows    int `gorm:"not null;default:0"`
+    SeatColumns int `gorm:"not null;default:0"`
+    CreatedAt   time.Time
+    UpdatedAt   time.Time
+    DeletedAt   gorm.DeletedAt `gorm:"index"`
 }
 
 func (r *Room) BeforeCreate(tx *gorm.DB) (err error) {
@@ -0,0 +1,26 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// SSOToken records an issued Moodle SSO token by jti so it can be redeemed only once.
+type SSOToken struct {
+    ID        string     `gorm:"type:uuid;primaryKey"`
+    JTI       string     `gorm:"size:64;uniqueIndex"`
+    UserIDRef string     `gorm:"type:uuid;index"`
+    Audience  string     `gorm:"size:255"`
+    ExpiresAt time.Time  `gorm:"index"`
+    UsedAt    *time.Time
+    CreatedAt time.Time
+}
+
+func (t *SSOToken) BeforeCreate(tx *gorm.DB) (err error) {
+    if t.ID == "" {
+        t.ID = uuid.NewString()
+    }
+    return nil
+}
@@ -7,6 +7,8 @@ import (
     "gorm.io/gorm"
 )
 
+// RefreshToken is one rotation of a login session. Rotating keeps SessionID, so the
+// non-revoked token of a SessionID represents the active session.
 type RefreshToken struct {
     ID               string    `gorm:"type:uuid;primaryKey"`
     TokenID          string    `gorm:"index"` // jti
@@ -15,6 +17,13 @@ type RefreshToken struct {
     ExpiresAt        time.Time `gorm:"index"`
     RevokedAt        *time.Time
     ReplacedByTokenID *string
+    // Session metadata captured at login and refreshed on rotation
+    SessionID        string    `gorm:"type:uuid;index"`
+    SessionStartedAt *time.Time
+    Platform         string    `gorm:"size:32"`
+    DeviceIDRef      *string   `gorm:"type:uuid"`
+    IPAddress        string    `gorm:"size:64"`
+    UserAgent        string    `gorm:"size:255"`
     CreatedAt        time.Time
 }
 
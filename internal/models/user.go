@@ -8,16 +8,33 @@ import (
 )
 
 type User struct {
-    ID        string    `gorm:"type:uuid;primaryKey"`
-    FullName  string
-    Email     string    `gorm:"uniqueIndex"`
-    Password  string
-    Role      string
-    Kelas     string
-    Jurusan   string
-    Active    bool
-    CreatedAt time.Time
-    UpdatedAt time.Time
+    ID                 string    `gorm:"type:uuid;primaryKey"`
+    FullName           string
+    // Email is optional for siswa; Username (usually the NIS) is an alternative login.
+    // Both are unique when set, see the partial indexes in the baseline migration.
+    Email              string
+    Username           string    `gorm:"size:64;not null;default:''"`
+    Password           string
+    Role               string
+    // Kelas mirrors the name of the linked Class (ClassIDRef) when set.
+    Kelas              string
+    ClassIDRef         *string   `gorm:"type:uuid;index"`
+    // Jurusan mirrors the code of the linked Major (MajorIDRef); older rows may still
+    // hold free text until reconciled via POST /admin/majors/reconcile-users.
+    Jurusan            string
+    MajorIDRef         *string   `gorm:"type:uuid;index"`
+    Active             bool
+    // TokenVersion is embedded in access tokens; bumping it invalidates all issued tokens.
+    TokenVersion       int       `gorm:"not null;default:0"`
+    // MustChangePassword is set for admin-chosen passwords (import, reset); the user is
+    // limited to POST /auth/password until they pick their own.
+    MustChangePassword bool      `gorm:"not null;default:false"`
+    // MoodleUserID links the user to its Moodle account (set by the Moodle sync).
+    MoodleUserID       *int64    `gorm:"uniqueIndex"`
+    CreatedAt          time.Time
+    UpdatedAt          time.Time
+    // DeletedAt marks a soft-deleted user; restorable until purged.
+    DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
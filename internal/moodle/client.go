@@ -0,0 +1,222 @@
+// Package moodle is a minimal client for the Moodle REST web service
+// (webservice/rest/server.php, moodlewsrestformat=json).
+package moodle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls web service functions with a service token.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(strings.TrimSpace(baseURL), "/"),
+		Token:      strings.TrimSpace(token),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Configured reports whether a base URL and token are set.
+func (c *Client) Configured() bool {
+	return c != nil && c.BaseURL != "" && c.Token != ""
+}
+
+// Error is a web service exception returned by Moodle (HTTP 200 with an
+// exception body).
+type Error struct {
+	Exception string `json:"exception"`
+	ErrorCode string `json:"errorcode"`
+	Message   string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("moodle: %s (%s)", e.Message, e.ErrorCode)
+}
+
+// Call invokes wsfunction with params and decodes the JSON response into out.
+func (c *Client) Call(ctx context.Context, wsfunction string, params url.Values, out interface{}) error {
+	if !c.Configured() {
+		return errors.New("moodle: client not configured")
+	}
+	form := url.Values{}
+	for k, v := range params {
+		form[k] = v
+	}
+	form.Set("wstoken", c.Token)
+	form.Set("wsfunction", wsfunction)
+	form.Set("moodlewsrestformat", "json")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/webservice/rest/server.php", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("moodle %s: %w", wsfunction, err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return fmt.Errorf("moodle %s: status %d: %w", wsfunction, resp.StatusCode, err)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		var wsErr Error
+		if json.Unmarshal(raw, &wsErr) == nil && wsErr.Exception != "" {
+			return &wsErr
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("moodle %s: status %d", wsfunction, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("moodle %s: %w", wsfunction, err)
+	}
+	return nil
+}
+
+// User is the subset of the Moodle user record used for synchronisation.
+type User struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"firstname"`
+	LastName  string `json:"lastname"`
+	FullName  string `json:"fullname"`
+	Email     string `json:"email"`
+	IDNumber  string `json:"idnumber"`
+	Suspended bool   `json:"suspended"`
+	Roles     []Role `json:"roles,omitempty"`
+}
+
+// Role is a course role of an enrolled user.
+type Role struct {
+	RoleID    int64  `json:"roleid"`
+	ShortName string `json:"shortname"`
+}
+
+// DisplayName returns fullname, or first and last name when fullname is absent.
+func (u User) DisplayName() string {
+	if strings.TrimSpace(u.FullName) != "" {
+		return strings.TrimSpace(u.FullName)
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// Cohort is a site or category cohort.
+type Cohort struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	IDNumber    string `json:"idnumber"`
+	Description string `json:"description"`
+	Visible     bool   `json:"visible"`
+}
+
+// GetUsers calls core_user_get_users with one criterion (e.g. email=% for all users).
+func (c *Client) GetUsers(ctx context.Context, key, value string) ([]User, error) {
+	params := url.Values{}
+	params.Set("criteria[0][key]", key)
+	params.Set("criteria[0][value]", value)
+	var body struct {
+		Users []User `json:"users"`
+	}
+	if err := c.Call(ctx, "core_user_get_users", params, &body); err != nil {
+		return nil, err
+	}
+	return body.Users, nil
+}
+
+// EnrolledUsers calls core_enrol_get_enrolled_users for a course.
+func (c *Client) EnrolledUsers(ctx context.Context, courseID int64) ([]User, error) {
+	params := url.Values{}
+	params.Set("courseid", strconv.FormatInt(courseID, 10))
+	var users []User
+	if err := c.Call(ctx, "core_enrol_get_enrolled_users", params, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// Cohorts calls core_cohort_get_cohorts; no ids returns every cohort.
+func (c *Client) Cohorts(ctx context.Context, ids ...int64) ([]Cohort, error) {
+	params := url.Values{}
+	for i, id := range ids {
+		params.Set(fmt.Sprintf("cohortids[%d]", i), strconv.FormatInt(id, 10))
+	}
+	var cohorts []Cohort
+	if err := c.Call(ctx, "core_cohort_get_cohorts", params, &cohorts); err != nil {
+		return nil, err
+	}
+	return cohorts, nil
+}
+
+// CohortMembers calls core_cohort_get_cohort_members and returns user ids per cohort id.
+func (c *Client) CohortMembers(ctx context.Context, ids ...int64) (map[int64][]int64, error) {
+	out := map[int64][]int64{}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	params := url.Values{}
+	for i, id := range ids {
+		params.Set(fmt.Sprintf("cohortids[%d]", i), strconv.FormatInt(id, 10))
+	}
+	var rows []struct {
+		CohortID int64   `json:"cohortid"`
+		UserIDs  []int64 `json:"userids"`
+	}
+	if err := c.Call(ctx, "core_cohort_get_cohort_members", params, &rows); err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.CohortID] = r.UserIDs
+	}
+	return out, nil
+}
+
+// QuizAttempt is an attempt as returned by mod_quiz_get_user_attempts.
+type QuizAttempt struct {
+	ID         int64  `json:"id"`
+	Quiz       int64  `json:"quiz"`
+	UserID     int64  `json:"userid"`
+	Attempt    int    `json:"attempt"`
+	State      string `json:"state"` // inprogress, overdue, finished, abandoned
+	TimeStart  int64  `json:"timestart"`
+	TimeFinish int64  `json:"timefinish"`
+	// TimeCheckState is when Moodle next re-checks the attempt, i.e. when an open
+	// attempt runs out of time.
+	TimeCheckState *int64 `json:"timecheckstate"`
+	Preview        int    `json:"preview"`
+}
+
+// UserAttempts calls mod_quiz_get_user_attempts; status is all, finished or unfinished.
+func (c *Client) UserAttempts(ctx context.Context, quizID, userID int64, status string) ([]QuizAttempt, error) {
+	params := url.Values{}
+	params.Set("quizid", strconv.FormatInt(quizID, 10))
+	params.Set("userid", strconv.FormatInt(userID, 10))
+	params.Set("status", status)
+	params.Set("includepreviews", "0")
+	var body struct {
+		Attempts []QuizAttempt `json:"attempts"`
+	}
+	if err := c.Call(ctx, "mod_quiz_get_user_attempts", params, &body); err != nil {
+		return nil, err
+	}
+	return body.Attempts, nil
+}
@@ -0,0 +1,85 @@
+package moodle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// stubServer answers web service calls with respond, after checking the common parameters.
+func stubServer(t *testing.T, respond func(form url.Values) interface{}) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.URL.Path != "/webservice/rest/server.php" || r.PostForm.Get("moodlewsrestformat") != "json" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`"not found"`))
+			return
+		}
+		if r.PostForm.Get("wstoken") != "tok" {
+			_ = json.NewEncoder(w).Encode(Error{Exception: "moodle_exception", ErrorCode: "invalidtoken", Message: "Invalid token"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(respond(r.PostForm))
+	}))
+	t.Cleanup(srv.Close)
+	return NewClient(srv.URL+"/", "tok")
+}
+
+func TestGetUsersSendsCriterion(t *testing.T) {
+	c := stubServer(t, func(form url.Values) interface{} {
+		if form.Get("wsfunction") != "core_user_get_users" || form.Get("criteria[0][key]") != "email" || form.Get("criteria[0][value]") != "%@school.test" {
+			return Error{Exception: "invalid_parameter_exception", ErrorCode: "invalidparameter", Message: "bad request"}
+		}
+		return map[string]interface{}{"users": []User{{ID: 3, Username: "budi", FirstName: "Budi", LastName: "Santoso"}}}
+	})
+	users, err := c.GetUsers(context.Background(), "email", "%@school.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].DisplayName() != "Budi Santoso" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+}
+
+func TestCallReturnsMoodleException(t *testing.T) {
+	c := stubServer(t, nil)
+	c.Token = "wrong"
+	_, err := c.Cohorts(context.Background())
+	var wsErr *Error
+	if !errors.As(err, &wsErr) || wsErr.ErrorCode != "invalidtoken" {
+		t.Fatalf("want invalidtoken exception, got %v", err)
+	}
+}
+
+func TestCohortMembers(t *testing.T) {
+	c := stubServer(t, func(form url.Values) interface{} {
+		if form.Get("cohortids[0]") != "10" || form.Get("cohortids[1]") != "11" {
+			return Error{Exception: "invalid_parameter_exception", ErrorCode: "invalidparameter", Message: "bad ids"}
+		}
+		return []map[string]interface{}{
+			{"cohortid": 10, "userids": []int64{3, 4}},
+			{"cohortid": 11, "userids": []int64{}},
+		}
+	})
+	members, err := c.CohortMembers(context.Background(), 10, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members[10]) != 2 || members[10][1] != 4 || len(members[11]) != 0 {
+		t.Fatalf("unexpected members %v", members)
+	}
+	if none, err := c.CohortMembers(context.Background()); err != nil || len(none) != 0 {
+		t.Fatalf("no ids should not call Moodle: %v %v", none, err)
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	if err := NewClient("", "").Call(context.Background(), "core_webservice_get_site_info", nil, nil); err == nil {
+		t.Fatal("unconfigured client made a call")
+	}
+}
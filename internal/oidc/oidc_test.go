@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP serves discovery, JWKS and a token endpoint that checks the PKCE verifier
+// against the challenge of the last authorization request.
+type stubIdP struct {
+	srv       *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	// emailVerified is put in the ID token unless nil
+	emailVerified *bool
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.srv.URL,
+			"authorization_endpoint": s.srv.URL + "/authorize",
+			"token_endpoint":         s.srv.URL + "/token",
+			"jwks_uri":               s.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   b64.EncodeToString(key.N.Bytes()),
+			"e":   b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" || CodeChallenge(r.PostForm.Get("code_verifier")) != s.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":   s.srv.URL,
+			"aud":   r.PostForm.Get("client_id"),
+			"sub":   "idp-user-1",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": s.nonce,
+			"email": "Staff@Example.com",
+		}
+		if s.emailVerified != nil {
+			claims["email_verified"] = *s.emailVerified
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+	s.srv = httptest.NewServer(mux)
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *stubIdP) provider() *Provider {
+	return NewProvider(Config{Name: "stub", Issuer: s.srv.URL, ClientID: "seb", RedirectURL: "https://seb.test/callback"})
+}
+
+// authorize records the challenge and nonce of an authorization URL like the
+// provider's authorize endpoint would.
+func (s *stubIdP) authorize(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	s.challenge = q.Get("code_challenge")
+	s.nonce = q.Get("nonce")
+	return q
+}
+
+func TestAuthCodeURLUsesS256PKCE(t *testing.T) {
+	idp := newStubIdP(t)
+	authURL, err := idp.provider().AuthCodeURL(context.Background(), "st", "nc", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.srv.URL+"/authorize?") {
+		t.Fatalf("authorization endpoint not used: %s", authURL)
+	}
+	q := idp.authorize(t, authURL)
+	if q.Get("state") != "st" || q.Get("nonce") != "nc" || q.Get("client_id") != "seb" {
+		t.Fatalf("unexpected query %v", q)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != CodeChallenge("verifier") {
+		t.Fatalf("unexpected PKCE parameters %v", q)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	yes, no := true, false
+	cases := []struct {
+		name          string
+		code          string
+		verifier      string
+		nonce         string
+		emailVerified *bool
+		wantErr       string
+	}{
+		{name: "verified email", code: "good-code", verifier: "verifier", nonce: "nc", emailVerified: &yes},
+		{name: "unverified email", code: "good-code", verifier: "verifier", nonce: "nc", emailVerified: &no},
+		{name: "email_verified omitted", code: "good-code", verifier: "verifier", nonce: "nc"},
+		{name: "wrong PKCE verifier", code: "good-code", verifier: "other", nonce: "nc", wantErr: "invalid_grant"},
+		{name: "bad code", code: "bad-code", verifier: "verifier", nonce: "nc", wantErr: "invalid_grant"},
+		{name: "nonce mismatch", code: "good-code", verifier: "verifier", nonce: "replayed", wantErr: "nonce mismatch"},
+		{name: "empty nonce", code: "good-code", verifier: "verifier", nonce: "", wantErr: "nonce mismatch"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.emailVerified = tc.emailVerified
+			p := idp.provider()
+			authURL, err := p.AuthCodeURL(context.Background(), "st", "nc", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			idp.authorize(t, authURL)
+
+			claims, err := p.Exchange(context.Background(), tc.code, tc.verifier, tc.nonce)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("want error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Email != "Staff@Example.com" || claims.Subject != "idp-user-1" {
+				t.Fatalf("unexpected claims %+v", claims)
+			}
+			switch {
+			case tc.emailVerified == nil && claims.EmailVerified != nil:
+				t.Fatalf("email_verified should be nil, got %v", *claims.EmailVerified)
+			case tc.emailVerified != nil && (claims.EmailVerified == nil || *claims.EmailVerified != *tc.emailVerified):
+				t.Fatalf("email_verified = %v, want %v", claims.EmailVerified, *tc.emailVerified)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsOtherAudience(t *testing.T) {
+	idp := newStubIdP(t)
+	p := idp.provider()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   idp.srv.URL,
+		"aud":   "another-client",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": "nc",
+	})
+	token.Header["kid"] = "k1"
+	raw, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.VerifyIDToken(context.Background(), raw, "nc"); err == nil {
+		t.Fatal("token for another audience was accepted")
+	}
+}
@@ -9,10 +9,11 @@ import (
     "github.com/zaqqye/seb_backend_v1/internal/config"
     "github.com/zaqqye/seb_backend_v1/internal/controllers"
     "github.com/zaqqye/seb_backend_v1/internal/middleware"
+    "github.com/zaqqye/seb_backend_v1/internal/utils"
     "github.com/zaqqye/seb_backend_v1/internal/ws"
 )
 
-func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
+func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs, keys *utils.KeySet) {
     // Controllers
     expiresMins, err := time.ParseDuration(cfg.JWTExpiresIn + "m")
     if err != nil || expiresMins == 0 {
@@ -27,6 +28,7 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
     if err3 != nil || refreshDays <= 0 {
         refreshDays = 30 * 24 * time.Hour
     }
+    throttle := controllers.NewLoginThrottle(db, cfg)
     authCtrl := &controllers.AuthController{
         DB:            db,
         AccessSecret:  cfg.JWTSecret,
@@ -34,14 +36,18 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
         AccessTTL:     accessTTL,
         RefreshTTL:    refreshDays,
         Cfg:           cfg,
+        Hubs:          hubs,
+        Keys:          keys,
+        Throttle:      throttle,
     }
     adminCtrl := &controllers.AdminController{DB: db}
+    resetCtrl := controllers.NewPasswordResetController(db)
     roomCtrl := &controllers.RoomController{DB: db}
     majorCtrl := &controllers.MajorController{DB: db}
     studentStatusCtrl := &controllers.StudentStatusController{DB: db, Hubs: hubs}
     monCtrl := &controllers.MonitoringController{DB: db, Hubs: hubs}
-    assignCtrl := &controllers.AssignmentController{DB: db}
-    oauthCtrl := &controllers.OAuthController{Cfg: cfg}
+    assignCtrl := &controllers.AssignmentController{DB: db, Cfg: cfg, Hubs: hubs}
+    oauthCtrl := &controllers.OAuthController{DB: db, Cfg: cfg, Keys: keys}
 
     // Public
     auth := r.Group("/api/v1/auth")
@@ -49,8 +55,22 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
         // Registration restricted to admin; moved under /api/admin/users
         auth.POST("/login", authCtrl.Login)
         auth.POST("/refresh", authCtrl.Refresh)
+
+        // OpenID Connect login for staff
+        oidcCtrl := controllers.NewOIDCController(db, authCtrl, cfg)
+        auth.GET("/oidc/:provider/start", oidcCtrl.Start)
+        auth.GET("/oidc/:provider/callback", oidcCtrl.Callback)
     }
 
+    // Public keys for verifying tokens we issue (access, Moodle SSO)
+    r.GET("/.well-known/jwks.json", oauthCtrl.JWKS)
+    // Moodle redeems SSO tokens server-to-server (client id/secret auth)
+    r.POST("/api/v1/oauth/moodle/verify", oauthCtrl.VerifyMoodleSSO)
+
+    // Moodle quiz attempts webhook (shared secret); the poller is started by cmd/server
+    quizCtrl := controllers.NewQuizAttemptController(db, hubs, cfg)
+    r.POST("/api/v1/moodle/quiz-attempts/webhook", quizCtrl.Webhook)
+
     // Public SDUI and Config (non-auth; some screens will 401 if role missing)
     sduiCtrl := &controllers.SDUIController{DB: db, Cfg: cfg}
     r.GET("/api/v1/sdui/screens/:name", sduiCtrl.GetScreen)
@@ -62,16 +82,25 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
     authMW := middleware.AuthMiddleware(db, middleware.AuthConfig{
         JWTSecret:    cfg.JWTSecret,
         JWTExpiresIn: expiresMins,
+        Keys:         keys,
     })
     api := r.Group("/api/v1", authMW)
     {
         api.GET("/auth/me", authCtrl.Me)
         api.POST("/auth/logout", authCtrl.Logout)
+        api.POST("/auth/password", authCtrl.ChangePassword)
+
+        // Refresh-token sessions of the current user
+        sessionCtrl := &controllers.SessionController{DB: db}
+        api.GET("/auth/sessions", sessionCtrl.ListMine)
+        api.POST("/auth/sessions/revoke-all", sessionCtrl.RevokeAllMine)
+        api.POST("/auth/sessions/:session_id/revoke", sessionCtrl.RevokeMine)
         api.GET("/oauth/moodle/sso", oauthCtrl.GenerateMoodleSSO)
 
         // Shared room listing (admin + pengawas)
         api.GET("/admin/rooms", middleware.RequireRoles("admin", "pengawas"), roomCtrl.ListRooms)
         api.GET("/admin/rooms/:id/students", middleware.RequireRoles("admin", "pengawas"), assignCtrl.ListStudents)
+        api.GET("/admin/rooms/:id/seats", middleware.RequireRoles("admin", "pengawas"), assignCtrl.SeatMap)
 
         // Admin-only
         admin := api.Group("/admin", middleware.RequireRoles("admin"))
@@ -81,13 +110,29 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
             admin.GET("/users/:user_id", adminCtrl.GetUser)
             admin.PUT("/users/:user_id", adminCtrl.UpdateUser)
             admin.DELETE("/users/:user_id", adminCtrl.DeleteUser)
+            admin.POST("/users/:user_id/restore", adminCtrl.RestoreUser)
             admin.POST("/users/import", adminCtrl.ImportUsers)
+            admin.POST("/users/reset-passwords", resetCtrl.ResetPasswords)
+            admin.GET("/users/:user_id/sessions", sessionCtrl.ListForUser)
+            admin.POST("/users/:user_id/sessions/revoke-all", sessionCtrl.RevokeAllForUser)
+            admin.POST("/users/:user_id/sessions/:session_id/revoke", sessionCtrl.RevokeForUser)
+
+            // Login throttling state
+            lockoutCtrl := &controllers.LoginLockoutController{DB: db, Throttle: throttle}
+            admin.GET("/login-lockouts", lockoutCtrl.List)
+            admin.POST("/login-lockouts/unlock", lockoutCtrl.Unlock)
+            admin.POST("/users/:user_id/unlock-login", lockoutCtrl.UnlockUser)
+
+            // Moodle user/cohort sync (dry run unless {"apply": true})
+            moodleSyncCtrl := controllers.NewMoodleSyncController(db, cfg)
+            admin.POST("/moodle/sync", moodleSyncCtrl.Sync)
 
             // Rooms (Kelas) CRUD
             admin.POST("/rooms", roomCtrl.CreateRoom)
             admin.GET("/rooms/:id", roomCtrl.GetRoom)
             admin.PUT("/rooms/:id", roomCtrl.UpdateRoom)
             admin.DELETE("/rooms/:id", roomCtrl.DeleteRoom)
+            admin.POST("/rooms/:id/restore", roomCtrl.RestoreRoom)
 
             // Majors (Jurusan) CRUD
             admin.GET("/majors", majorCtrl.ListMajors)
@@ -95,14 +140,41 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
             admin.GET("/majors/:id", majorCtrl.GetMajor)
             admin.PUT("/majors/:id", majorCtrl.UpdateMajor)
             admin.DELETE("/majors/:id", majorCtrl.DeleteMajor)
+            admin.POST("/majors/:id/restore", majorCtrl.RestoreMajor)
+            admin.POST("/majors/reconcile-users", majorCtrl.ReconcileUsers)
+
+            // Academic terms: active term scopes assignments and exit codes
+            termCtrl := &controllers.AcademicTermController{DB: db}
+            admin.GET("/terms", termCtrl.ListTerms)
+            admin.POST("/terms", termCtrl.CreateTerm)
+            admin.POST("/terms/rollover", termCtrl.Rollover)
+            admin.GET("/terms/:id", termCtrl.GetTerm)
+            admin.PUT("/terms/:id", termCtrl.UpdateTerm)
+            admin.POST("/terms/:id/activate", termCtrl.ActivateTerm)
+
+            // Classes (rombel) with homeroom teacher and academic year
+            classCtrl := &controllers.ClassController{DB: db}
+            admin.GET("/classes", classCtrl.ListClasses)
+            admin.POST("/classes", classCtrl.CreateClass)
+            admin.GET("/classes/:id", classCtrl.GetClass)
+            admin.PUT("/classes/:id", classCtrl.UpdateClass)
+            admin.DELETE("/classes/:id", classCtrl.DeleteClass)
+            admin.GET("/classes/:id/students", classCtrl.ListStudents)
+            admin.POST("/classes/:id/students", classCtrl.AddStudents)
+            admin.DELETE("/classes/:id/students/:user_id", classCtrl.RemoveStudent)
 
             // Assignments: supervisors and students to rooms
-            assignCtrl := &controllers.AssignmentController{DB: db}
             admin.POST("/rooms/:id/supervisors", assignCtrl.AssignSupervisor)
             admin.DELETE("/rooms/:id/supervisors/:user_id", assignCtrl.UnassignSupervisor)
             admin.GET("/rooms/:id/supervisors", assignCtrl.ListSupervisors)
             admin.POST("/rooms/:id/students", assignCtrl.AssignStudent)
+            // CSV bulk assign/move/remove (dry run unless apply=true)
+            admin.POST("/rooms/assignments/import", assignCtrl.ImportAssignments)
+            admin.POST("/rooms/:id/students/class", assignCtrl.AssignClass)
             admin.DELETE("/rooms/:id/students/:user_id", assignCtrl.UnassignStudent)
+            admin.POST("/rooms/:id/students/:user_id/move", assignCtrl.MoveStudent)
+            admin.PUT("/rooms/:id/students/:user_id/seat", assignCtrl.SetSeat)
+            admin.POST("/rooms/:id/seats/auto", assignCtrl.AutoAssignSeats)
 
             // SDUI screens admin CRUD
             sduiAdmin := &controllers.SDUIAdminController{DB: db}
@@ -111,6 +183,14 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
             admin.GET("/sdui/screens/:id", sduiAdmin.Get)
             admin.PUT("/sdui/screens/:id", sduiAdmin.Update)
             admin.DELETE("/sdui/screens/:id", sduiAdmin.Delete)
+
+            // Alert rules evaluated on student status changes
+            ruleCtrl := &controllers.AlertRuleController{DB: db}
+            admin.GET("/alert-rules", ruleCtrl.List)
+            admin.POST("/alert-rules", ruleCtrl.Create)
+            admin.GET("/alert-rules/:id", ruleCtrl.Get)
+            admin.PUT("/alert-rules/:id", ruleCtrl.Update)
+            admin.DELETE("/alert-rules/:id", ruleCtrl.Delete)
         }
 
         // Pengawas area (and admin)
@@ -152,6 +232,10 @@ func Register(r *gin.Engine, db *gorm.DB, cfg *config.Config, hubs *ws.Hubs) {
             monitoring.GET("/students", monCtrl.ListStudents)
             monitoring.POST("/students/:id/logout", monCtrl.ForceLogout)
             monitoring.POST("/students/:id/allow", monCtrl.AllowExam)
+            monitoring.GET("/students/:id/devices", monCtrl.ListDevices)
+            monitoring.POST("/students/:id/device/reset", monCtrl.ResetDeviceBinding)
+            monitoring.GET("/alerts", monCtrl.ListAlerts)
+            monitoring.POST("/alerts/:id/ack", monCtrl.AcknowledgeAlert)
         }
 
         // SDUI and Config with auth context (role-aware)
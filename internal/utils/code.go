@@ -22,3 +22,31 @@ func GenerateCode(n int) (string, error) {
     return string(b), nil
 }
 
+const passwordAlphabet = "abcdefghjkmnpqrstuvwxyz23456789" // lowercase + digits, no confusable chars
+
+// GeneratePassword returns a random printable password of n characters (min 8) with
+// at least one letter and one digit, using the same crypto source as GenerateCode.
+func GeneratePassword(n int) (string, error) {
+    if n < 8 {
+        n = 8
+    }
+    for {
+        b := make([]byte, n)
+        hasLetter, hasDigit := false, false
+        for i := 0; i < n; i++ {
+            idxBig, err := rand.Int(rand.Reader, big.NewInt(int64(len(passwordAlphabet))))
+            if err != nil {
+                return "", err
+            }
+            b[i] = passwordAlphabet[idxBig.Int64()]
+            if b[i] >= '0' && b[i] <= '9' {
+                hasDigit = true
+            } else {
+                hasLetter = true
+            }
+        }
+        if hasLetter && hasDigit {
+            return string(b), nil
+        }
+    }
+}
@@ -0,0 +1,198 @@
+package utils
+
+import (
+    "crypto"
+    "crypto/ed25519"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "math/big"
+    "os"
+    "strings"
+
+    "github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one asymmetric JWT key. Keys without a private half only verify
+// (e.g. a key rotated out that still has tokens in flight).
+type SigningKey struct {
+    ID      string
+    Method  jwt.SigningMethod
+    Private crypto.Signer
+    Public  crypto.PublicKey
+}
+
+// KeySet signs tokens with its first key and verifies with any of its keys by kid.
+// An empty KeySet (no keys configured) falls back to HS256 with the caller's secret.
+type KeySet struct {
+    keys []*SigningKey
+    byID map[string]*SigningKey
+    // AllowHMAC keeps HS256 tokens valid while clients migrate to the asymmetric keys.
+    AllowHMAC bool
+}
+
+// LoadKeySet parses JWT_SIGNING_KEYS style specs: comma-separated "kid:path/to/key.pem".
+// The first entry must hold a private key (RSA -> RS256, Ed25519 -> EdDSA) and signs new
+// tokens; later entries may be private or public keys and are only used for verification.
+func LoadKeySet(spec string, allowHMAC bool) (*KeySet, error) {
+    ks := &KeySet{byID: map[string]*SigningKey{}, AllowHMAC: allowHMAC}
+    for _, entry := range strings.Split(spec, ",") {
+        entry = strings.TrimSpace(entry)
+        if entry == "" {
+            continue
+        }
+        kid, path, ok := strings.Cut(entry, ":")
+        kid, path = strings.TrimSpace(kid), strings.TrimSpace(path)
+        if !ok || kid == "" || path == "" {
+            return nil, fmt.Errorf("invalid signing key entry %q, expected kid:path", entry)
+        }
+        if _, dup := ks.byID[kid]; dup {
+            return nil, fmt.Errorf("duplicate signing key id %q", kid)
+        }
+        raw, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("signing key %s: %w", kid, err)
+        }
+        key, err := parseSigningKey(kid, raw)
+        if err != nil {
+            return nil, fmt.Errorf("signing key %s: %w", kid, err)
+        }
+        ks.keys = append(ks.keys, key)
+        ks.byID[kid] = key
+    }
+    if len(ks.keys) > 0 && ks.keys[0].Private == nil {
+        return nil, fmt.Errorf("signing key %s: first key must be a private key", ks.keys[0].ID)
+    }
+    if len(ks.keys) == 0 {
+        // Nothing to verify with besides the shared secret
+        ks.AllowHMAC = true
+    }
+    return ks, nil
+}
+
+func parseSigningKey(kid string, raw []byte) (*SigningKey, error) {
+    block, _ := pem.Decode(raw)
+    if block == nil {
+        return nil, errors.New("no PEM block found")
+    }
+    var parsed interface{}
+    var err error
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    case "PRIVATE KEY":
+        parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+    case "RSA PUBLIC KEY":
+        parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+    case "PUBLIC KEY":
+        parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+    default:
+        return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    key := &SigningKey{ID: kid}
+    switch k := parsed.(type) {
+    case *rsa.PrivateKey:
+        key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+    case *rsa.PublicKey:
+        key.Method, key.Public = jwt.SigningMethodRS256, k
+    case ed25519.PrivateKey:
+        key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, k, k.Public()
+    case ed25519.PublicKey:
+        key.Method, key.Public = jwt.SigningMethodEdDSA, k
+    default:
+        return nil, fmt.Errorf("unsupported key type %T (use RSA or Ed25519)", parsed)
+    }
+    return key, nil
+}
+
+// Signer returns the key used for new tokens, or nil when only HS256 is configured.
+func (ks *KeySet) Signer() *SigningKey {
+    if ks == nil || len(ks.keys) == 0 {
+        return nil
+    }
+    return ks.keys[0]
+}
+
+// Sign signs claims with the active key (kid header set), or HS256 with hmacSecret
+// when no asymmetric key is configured.
+func (ks *KeySet) Sign(claims jwt.Claims, hmacSecret string) (string, error) {
+    if signer := ks.Signer(); signer != nil {
+        token := jwt.NewWithClaims(signer.Method, claims)
+        token.Header["kid"] = signer.ID
+        return token.SignedString(signer.Private)
+    }
+    if hmacSecret == "" {
+        return "", errors.New("no signing key configured")
+    }
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(hmacSecret))
+}
+
+// Keyfunc resolves the verification key by kid; HS256 tokens verify with hmacSecret
+// while AllowHMAC is set.
+func (ks *KeySet) Keyfunc(hmacSecret string) jwt.Keyfunc {
+    return func(token *jwt.Token) (interface{}, error) {
+        if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+            if (ks != nil && !ks.AllowHMAC) || hmacSecret == "" {
+                return nil, errors.New("HS256 tokens are no longer accepted")
+            }
+            return []byte(hmacSecret), nil
+        }
+        if ks == nil {
+            return nil, errors.New("no verification keys configured")
+        }
+        kid, _ := token.Header["kid"].(string)
+        key, ok := ks.byID[kid]
+        if !ok {
+            return nil, fmt.Errorf("unknown key id %q", kid)
+        }
+        if token.Method.Alg() != key.Method.Alg() {
+            return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+        }
+        return key.Public, nil
+    }
+}
+
+// JWK is the public part of a SigningKey in RFC 7517 form.
+type JWK struct {
+    Kty string `json:"kty"`
+    Kid string `json:"kid"`
+    Use string `json:"use"`
+    Alg string `json:"alg"`
+    N   string `json:"n,omitempty"`
+    E   string `json:"e,omitempty"`
+    Crv string `json:"crv,omitempty"`
+    X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys for /.well-known/jwks.json.
+func (ks *KeySet) JWKS() []JWK {
+    out := []JWK{}
+    if ks == nil {
+        return out
+    }
+    b64 := base64.RawURLEncoding
+    for _, k := range ks.keys {
+        jwk := JWK{Kid: k.ID, Use: "sig", Alg: k.Method.Alg()}
+        switch pub := k.Public.(type) {
+        case *rsa.PublicKey:
+            jwk.Kty = "RSA"
+            jwk.N = b64.EncodeToString(pub.N.Bytes())
+            jwk.E = b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+        case ed25519.PublicKey:
+            jwk.Kty = "OKP"
+            jwk.Crv = "Ed25519"
+            jwk.X = b64.EncodeToString(pub)
+        default:
+            continue
+        }
+        out = append(out, jwk)
+    }
+    return out
+}
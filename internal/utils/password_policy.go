@@ -0,0 +1,68 @@
+package utils
+
+import (
+    "fmt"
+    "strings"
+    "unicode"
+)
+
+// commonPasswords are always rejected regardless of the configured deny-list.
+var commonPasswords = []string{
+    "123456", "1234567", "12345678", "123456789", "1234567890", "password", "password1",
+    "qwerty", "qwerty123", "abc123", "111111", "000000", "admin123", "iloveyou",
+    "rahasia", "sekolah", "siswa123", "indonesia",
+}
+
+// PasswordPolicy describes the rules for user-chosen passwords. Classes are
+// lowercase, uppercase, digits and symbols.
+type PasswordPolicy struct {
+    MinLength  int
+    MinClasses int
+    DenyList   []string
+}
+
+// Validate checks password against the policy. Values in personal (email, name,
+// NIS, ...) may not be used as or contained in the password.
+func (p PasswordPolicy) Validate(password string, personal ...string) error {
+    if len([]rune(password)) < p.MinLength {
+        return fmt.Errorf("password must be at least %d characters", p.MinLength)
+    }
+    var lower, upper, digit, symbol bool
+    for _, r := range password {
+        switch {
+        case unicode.IsLower(r):
+            lower = true
+        case unicode.IsUpper(r):
+            upper = true
+        case unicode.IsDigit(r):
+            digit = true
+        default:
+            symbol = true
+        }
+    }
+    classes := 0
+    for _, ok := range []bool{lower, upper, digit, symbol} {
+        if ok {
+            classes++
+        }
+    }
+    if classes < p.MinClasses {
+        return fmt.Errorf("password must contain at least %d of: lowercase, uppercase, digits, symbols", p.MinClasses)
+    }
+    normalized := strings.ToLower(password)
+    for _, denied := range append(commonPasswords, p.DenyList...) {
+        if denied = strings.ToLower(strings.TrimSpace(denied)); denied != "" && normalized == denied {
+            return fmt.Errorf("password is too common")
+        }
+    }
+    for _, v := range personal {
+        v = strings.ToLower(strings.TrimSpace(v))
+        if at := strings.Index(v, "@"); at > 0 {
+            v = v[:at]
+        }
+        if len(v) >= 4 && strings.Contains(normalized, v) {
+            return fmt.Errorf("password must not contain your personal details")
+        }
+    }
+    return nil
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+    "bytes"
+    "fmt"
+    "strings"
+)
+
+// TextPDF renders lines of plain text as an A4 PDF in 10pt Courier, starting a new
+// page every linesPerPage lines (or at a "\f" line). It only covers what printable
+// exports need, so no external PDF dependency is pulled in. Characters outside
+// printable ASCII are replaced with '?'.
+func TextPDF(lines []string, linesPerPage int) []byte {
+    if linesPerPage <= 0 {
+        linesPerPage = 60
+    }
+    var pages [][]string
+    var current []string
+    for _, l := range lines {
+        if l == "\f" || len(current) == linesPerPage {
+            pages = append(pages, current)
+            current = nil
+            if l == "\f" {
+                continue
+            }
+        }
+        current = append(current, l)
+    }
+    if len(current) > 0 || len(pages) == 0 {
+        pages = append(pages, current)
+    }
+
+    // Object layout: 1 catalog, 2 page tree, 3 font, then a page + content pair per page
+    var buf bytes.Buffer
+    offsets := []int{}
+    writeObj := func(body string) {
+        offsets = append(offsets, buf.Len())
+        fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+    }
+    buf.WriteString("%PDF-1.4\n")
+
+    kids := make([]string, len(pages))
+    for i := range pages {
+        kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+    }
+    writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+    writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+    writeObj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+    for i, page := range pages {
+        var content strings.Builder
+        content.WriteString("BT\n/F1 10 Tf\n12 TL\n40 800 Td\n")
+        for _, l := range page {
+            fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(l))
+        }
+        content.WriteString("ET")
+        writeObj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+        writeObj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+    }
+
+    xref := buf.Len()
+    fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+    for _, off := range offsets {
+        fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+    }
+    fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+    return buf.Bytes()
+}
+
+func pdfEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        switch {
+        case r == '(' || r == ')' || r == '\\':
+            b.WriteByte('\\')
+            b.WriteRune(r)
+        case r < 32 || r > 126:
+            b.WriteByte('?')
+        default:
+            b.WriteRune(r)
+        }
+    }
+    return b.String()
+}
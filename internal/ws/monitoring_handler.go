@@ -36,7 +36,7 @@ func MonitoringHandler(db *gorm.DB, hub *MonitoringHub) gin.HandlerFunc {
 		allowedRooms := map[string]struct{}{}
 		if !allowAll {
 			var assignments []models.RoomSupervisor
-			if err := db.Where("user_id_ref = ?", user.ID).Find(&assignments).Error; err != nil {
+			if err := db.Where("user_id_ref = ?", user.ID).Where(models.CurrentTermCond("term_id_ref")).Find(&assignments).Error; err != nil {
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 				return
 			}
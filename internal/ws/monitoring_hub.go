@@ -31,6 +31,7 @@ type MonitoringPayload struct {
 	LastAppVersion   string             `json:"app_version,omitempty"`
 	Monitoring       MonitoringSnapshot `json:"monitoring"`
 	Room             MonitoringRoom     `json:"room"`
+	Quiz             *MonitoringQuiz    `json:"quiz"`
 }
 
 // MonitoringSnapshot mirrors the monitoring block returned by the REST API.
@@ -41,12 +42,45 @@ type MonitoringSnapshot struct {
 	BlockedFromExam bool       `json:"blocked_from_exam"`
 	ForceLogoutAt   *time.Time `json:"force_logout_at,omitempty"`
 	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	// UnauthorizedUnlock is true when the latest unlock was not backed by an exit code.
+	UnauthorizedUnlock   bool       `json:"unauthorized_unlock"`
+	UnauthorizedUnlockAt *time.Time `json:"unauthorized_unlock_at,omitempty"`
 }
 
 // MonitoringRoom mirrors the room object in REST responses.
 type MonitoringRoom struct {
-	ID       string `json:"id"`
-	RoomName string `json:"room_name"`
+	ID         string `json:"id"`
+	RoomName   string `json:"room_name"`
+	SeatRow    *int   `json:"seat_row"`
+	SeatColumn *int   `json:"seat_column"`
+}
+
+// MonitoringQuiz is the student's current (or latest) Moodle quiz attempt.
+type MonitoringQuiz struct {
+	AttemptID  int64      `json:"attempt_id"`
+	QuizID     int64      `json:"quiz_id"`
+	State      string     `json:"state"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DueAt      *time.Time `json:"due_at,omitempty"`
+	// TimeRemainingSeconds is set for open attempts with a time limit.
+	TimeRemainingSeconds *int64    `json:"time_remaining_seconds,omitempty"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// MonitoringAlert is pushed to pengawas/admin dashboards when something needs attention.
+// Type distinguishes it from plain status payloads (which carry no type field).
+type MonitoringAlert struct {
+	Type      string    `json:"type"`
+	ID        string    `json:"id"`
+	RuleID    *string   `json:"rule_id,omitempty"`
+	RuleName  string    `json:"rule_name,omitempty"`
+	StudentID string    `json:"student_id,omitempty"`
+	FullName  string    `json:"full_name,omitempty"`
+	RoomID    *string   `json:"room_id,omitempty"`
+	Message   string    `json:"message"`
+	Actions   []string  `json:"actions,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type monitoringMessage struct {
@@ -120,6 +154,22 @@ func (h *MonitoringHub) Broadcast(payload MonitoringPayload) {
 	}
 }
 
+// BroadcastAlert pushes an alert to dashboards allowed to see its room.
+func (h *MonitoringHub) BroadcastAlert(alert MonitoringAlert) {
+	if h == nil {
+		return
+	}
+	data, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("ws: failed to marshal alert: %v", err)
+		return
+	}
+	h.broadcast <- monitoringMessage{
+		roomID:  alert.RoomID,
+		payload: data,
+	}
+}
+
 type monitoringClient struct {
 	hub          *MonitoringHub
 	conn         *websocket.Conn